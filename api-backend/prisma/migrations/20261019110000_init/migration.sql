@@ -0,0 +1,11 @@
+/*
+  Warnings:
+
+  - A unique constraint covering the columns `[sku]` on the table `Product` will be added. If there are existing duplicate values, this will fail.
+
+*/
+-- AlterTable
+ALTER TABLE "Product" ADD COLUMN     "sku" TEXT;
+
+-- CreateIndex
+CREATE UNIQUE INDEX "Product.sku_unique" ON "Product"("sku");
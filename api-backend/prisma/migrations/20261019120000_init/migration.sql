@@ -0,0 +1,14 @@
+-- AlterTable
+ALTER TABLE "Product" ADD COLUMN     "currency" TEXT NOT NULL DEFAULT E'EUR';
+
+-- CreateTable
+CREATE TABLE "ProductPrice" (
+    "productId" INTEGER NOT NULL,
+    "currency" TEXT NOT NULL,
+    "price" DECIMAL(65,30) NOT NULL,
+
+    PRIMARY KEY ("productId","currency")
+);
+
+-- AddForeignKey
+ALTER TABLE "ProductPrice" ADD FOREIGN KEY ("productId") REFERENCES "Product"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,14 @@
+-- AlterTable
+ALTER TABLE "StockMovement" ADD COLUMN     "location" TEXT;
+
+-- CreateTable
+CREATE TABLE "ArticleStock" (
+    "articleId" INTEGER NOT NULL,
+    "location" TEXT NOT NULL,
+    "availableStock" INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY ("articleId","location")
+);
+
+-- AddForeignKey
+ALTER TABLE "ArticleStock" ADD FOREIGN KEY ("articleId") REFERENCES "Article"("id") ON DELETE CASCADE ON UPDATE CASCADE;
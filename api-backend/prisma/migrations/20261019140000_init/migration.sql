@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "StockMovement" ADD COLUMN     "key" TEXT;
+
+-- CreateIndex
+CREATE UNIQUE INDEX "StockMovement.key_unique" ON "StockMovement"("key");
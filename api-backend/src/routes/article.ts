@@ -1,12 +1,15 @@
 import express from 'express';
 import { log } from '../logger';
 import {
+  adjustStock,
   checkArticleHealth,
   get,
   getAll,
+  remove,
   updateStockByProductMade,
   upsert
 } from '../services/article';
+import { stockMovementReasons } from '../services/model';
 import { serializeNonDefaultTypes } from './utils';
 
 export default {
@@ -74,7 +77,11 @@ export default {
     });
 
     /**
-     * Create an article
+     * Create an article or, if there's one with the same `identification`, update its name and stock
+     * Possible returns:
+     * - 200 : the Article written
+     * - 400 : the Article has stock by location and no `location` was given
+     * - 500 : the Article couldn't be written
      */
     app.post(`/${prefix}`, async (req, res) => {
       try {
@@ -91,8 +98,14 @@ export default {
           id: 0
         };
 
-        // invoke the service that will write the received data to the database
-        const creationResult = await upsert(newArticle);
+        // invoke the service that will write the received data to the database. With
+        // a `location`, the `availableStock` is the stock at that location (warehouse)
+        const creationResult = await upsert(newArticle, req.body.location);
+        if (creationResult.locationRequired) {
+          return res.status(400).json({
+            message: 'The Article has stock by location: a `location` must be provided'
+          });
+        }
         if (creationResult.error) {
           return res
             .status(500)
@@ -112,7 +125,81 @@ export default {
     });
 
     /**
-     * Update Article stock based on Product selling event
+     * Change the Article stock by a relative quantity (movement), like
+     * "+5 screws received" or "-2 legs damaged", optionally at a `location`.
+     * A movement with the `key` of one already applied doesn't change the stock again, and the
+     * Article is answered with `alreadyApplied: true`
+     * Possible returns:
+     * - 200 : the Article with the new stock
+     * - 400 : the Article has stock by location and the movement has no `location`
+     * - 404 : the Article doesn't exist
+     * - 409 : the movement would take the stock below zero
+     */
+    app.post(`/${prefix}/stock-movement`, async (req, res) => {
+      try {
+        const identification = parseInt(`${req.body.identification}`, 10);
+        const delta = parseInt(`${req.body.delta}`, 10);
+        const { reason, location, key } = req.body;
+
+        // validate the movement before touching the stock
+        if (Number.isNaN(identification) || Number.isNaN(delta) || delta === 0) {
+          return res.status(400).json({
+            message: '`identification` and a non zero `delta` must be provided'
+          });
+        }
+        if (!stockMovementReasons.includes(reason)) {
+          return res.status(400).json({
+            message: `\`reason\` must be one of: ${stockMovementReasons.join(', ')}`
+          });
+        }
+
+        // invoke the service that will increment the stock on the database
+        const adjustResult = await adjustStock(
+          identification,
+          delta,
+          reason,
+          location,
+          key
+        );
+        if (adjustResult.error) {
+          return res
+            .status(500)
+            .json({ msg: 'There was an error processing your request' });
+        }
+        if (!adjustResult.article) {
+          return res.status(404).send('Not found');
+        }
+        if (adjustResult.locationRequired) {
+          return res.status(400).json({
+            message: 'The Article has stock by location: a `location` must be provided'
+          });
+        }
+        if (adjustResult.insufficientStock) {
+          return res.status(409).json({
+            message: `The stock of the Article${location ? ` at ${location}` : ''} can't go below zero`
+          });
+        }
+
+        // serialize the result with special serializer because of some non-standard types, like `bigint`
+        const articleParsed = serializeNonDefaultTypes(adjustResult.article);
+        return res.json(
+          adjustResult.alreadyApplied
+            ? { ...articleParsed, alreadyApplied: true }
+            : articleParsed
+        );
+      } catch (error) {
+        log.error(
+          'Error invoking `adjustStock` from `article service`. Details:',
+          error
+        );
+        return res
+          .status(500)
+          .send('There was an error updating the Article invetory stock');
+      }
+    });
+
+    /**
+     * Update Article stock based on Product selling event, optionally at a `location`
      */
     app.post(`/${prefix}/stock-update/by/product/:id`, async (req, res) => {
       try {
@@ -124,7 +211,8 @@ export default {
         // invoke the update Stock service
         const updatedStock = await updateStockByProductMade(
           parseInt(req.params.id, 10),
-          quantity
+          quantity,
+          req.body.location
         );
         const articlesParsed = serializeNonDefaultTypes(updatedStock);
         return res.json(articlesParsed);
@@ -138,5 +226,47 @@ export default {
           .send('There was an error updating the Articles invetory stock');
       }
     });
+
+    /**
+     * Remove an article. Articles used by some Product are not removed, unless
+     * the `force=true` query param is sent: then the Article is also removed from
+     * the composition of these Products
+     * Possible returns:
+     * - 200 : the removed Article
+     * - 404 : the Article doesn't exist
+     * - 409 : the Article is used by the Products listed at `usedByProducts`
+     */
+    app.delete(`/${prefix}/:id`, async (req, res) => {
+      try {
+        const removeResult = await remove(
+          parseInt(req.params.id, 10),
+          req.query.force === 'true'
+        );
+        if (removeResult.error) {
+          return res
+            .status(500)
+            .json({ msg: 'There was an error processing your request' });
+        }
+        if (!removeResult.article) {
+          return res.status(404).send('Not found');
+        }
+        if (removeResult.usedByProducts.length > 0) {
+          return res.status(409).json({
+            message: 'The Article is used by some Products',
+            usedByProducts: removeResult.usedByProducts
+          });
+        }
+
+        // serialize the result with special serializer because of some non-standard types, like `bigint`
+        const articleParsed = serializeNonDefaultTypes(removeResult.article);
+        return res.json(articleParsed);
+      } catch (error) {
+        log.error(
+          'Error invoking `remove` from `article service`. Details:',
+          error
+        );
+        return res.status(500).send('There was an error removing the Article');
+      }
+    });
   }
 };
@@ -1,6 +1,13 @@
 import express from 'express';
 import { log } from '../logger';
-import { checkProductHealth, getAll, getAllWithAvailability, upsert } from '../services/product';
+import {
+  checkProductHealth,
+  getAll,
+  getAllWithAvailability,
+  remove,
+  update,
+  upsert
+} from '../services/product';
 import { serializeNonDefaultTypes } from './utils';
 
 export default {
@@ -22,12 +29,15 @@ export default {
       });
 
     /**
-     * Retrieve all the products
+     * Retrieve all the products, optionally filtered by `sku` and `name`
      */
-    app.get(`/${prefix}`, async (_, res) => {
+    app.get(`/${prefix}`, async (req, res) => {
       try {
         // Invoke the service to get all the products on the base
-        const allProducts = await getAll();
+        const allProducts = await getAll({
+          sku: req.query.sku ? req.query.sku.toString() : undefined,
+          name: req.query.name ? req.query.name.toString() : undefined
+        });
 
         // serialize the result with special serializer because of some non-standard types, like `bigint`
         const productsParsed = serializeNonDefaultTypes(allProducts.products);
@@ -42,13 +52,45 @@ export default {
     });
 
     /**
-     * Retrieve single the product
+     * Retrieve all the products with the quantity available at the `location`,
+     * or at all the locations when not provided
+     */
+    app.get(`/${prefix}/availability`, async (req, res) => {
+      try {
+        const allProducts = await getAllWithAvailability(
+          undefined,
+          req.query.location ? req.query.location.toString() : undefined
+        );
+        if (allProducts.error) {
+          return res
+            .status(500)
+            .json({ msg: 'There was an error processing your request' });
+        }
+
+        // serialize the result with special serializer because of some non-standard types, like `bigint`
+        const productsParsed = serializeNonDefaultTypes(allProducts.products);
+        return res.json(productsParsed);
+      } catch (error) {
+        log.error(
+          'Error invoking `getAllWithAvailability` from `product service`. Details:',
+          error
+        );
+        return res
+          .status(500)
+          .send('There was an error fetching the Products availability');
+      }
+    });
+
+    /**
+     * Retrieve single the product, with the quantity available at the `location`
+     * or at all the locations when not provided
      */
     app.get(`/${prefix}/:id`, async (req, res) => {
       try {
         // Invoke the service to get an product by the provided ID
         const retrievedProduct = await getAllWithAvailability(
-          parseInt(req.params.id, 10)
+          parseInt(req.params.id, 10),
+          req.query.location ? req.query.location.toString() : undefined
         );
 
         // serialize the result with special serializer because of some non-standard types, like `bigint`
@@ -85,12 +127,15 @@ export default {
         const basicData = {
           id: 0,
           name: req.body.name,
-          price: req.body.price
+          price: req.body.price,
+          sku: req.body.sku,
+          currency: req.body.currency
         };
         const articles = req.body.articles ? req.body.articles : [];
+        const prices = req.body.prices ? req.body.prices : [];
 
         // invoke the service that will write the received data to the database
-        const creationResult = await upsert(basicData, articles);
+        const creationResult = await upsert(basicData, articles, prices);
         if (creationResult.error) {
           return res
             .status(500)
@@ -107,5 +152,69 @@ export default {
         return res.status(500).send('There was an error creating a Product');
       }
     });
+
+    /**
+     * Update a product, replacing its prices and Article composition. The SKU
+     * is kept when no `sku` is sent and removed when it's `null`
+     */
+    app.put(`/${prefix}/:id`, async (req, res) => {
+      try {
+        const basicData = {
+          id: parseInt(req.params.id, 10),
+          name: req.body.name,
+          price: req.body.price,
+          sku: req.body.sku,
+          currency: req.body.currency
+        };
+        const articles = req.body.articles ? req.body.articles : [];
+        const prices = req.body.prices ? req.body.prices : [];
+
+        // invoke the service that will write the received data to the database
+        const updateResult = await update(basicData, articles, prices);
+        if (updateResult.error) {
+          return res
+            .status(500)
+            .json({ msg: 'There was an error processing your request' });
+        }
+        if (!updateResult.product) {
+          return res.status(404).send('Not found');
+        }
+        // serialize the result with special serializer because of some non-standard types, like `bigint`
+        const productParsed = serializeNonDefaultTypes(updateResult.product);
+        return res.json(productParsed);
+      } catch (error) {
+        log.error(
+          'Error invoking `update` from `product service`. Details:',
+          error
+        );
+        return res.status(500).send('There was an error updating a Product');
+      }
+    });
+
+    /**
+     * Remove a product and its Article composition
+     */
+    app.delete(`/${prefix}/:id`, async (req, res) => {
+      try {
+        const removeResult = await remove(parseInt(req.params.id, 10));
+        if (removeResult.error) {
+          return res
+            .status(500)
+            .json({ msg: 'There was an error processing your request' });
+        }
+        if (!removeResult.product) {
+          return res.status(404).send('Not found');
+        }
+        // serialize the result with special serializer because of some non-standard types, like `bigint`
+        const productParsed = serializeNonDefaultTypes(removeResult.product);
+        return res.json(productParsed);
+      } catch (error) {
+        log.error(
+          'Error invoking `remove` from `product service`. Details:',
+          error
+        );
+        return res.status(500).send('There was an error removing a Product');
+      }
+    });
   }
 };
@@ -1,5 +1,6 @@
-import { Article } from '@prisma/client';
+import { Article, Prisma } from '@prisma/client';
 import { log } from '../../logger';
+import { ArticleWithStocks } from '../model';
 import { prisma } from '../prisma-client';
 import { get as getProduct } from '../product';
 
@@ -8,12 +9,25 @@ import { get as getProduct } from '../product';
 // This way we have a more "procedural" flow, like would do in a Golang idiomatic way
 
 export type ArticleReturnSingle = {
-  article: Article | null;
+  article: ArticleWithStocks | null;
+  // the change was refused because it would take the stock below zero
+  insufficientStock?: boolean;
+  // the change was refused because the Article has stock by location and no location was given
+  locationRequired?: boolean;
+  // the movement with the same key was applied before, so the stock wasn't changed again
+  alreadyApplied?: boolean;
   error: string | null;
 };
 
 export type ArticleReturnList = {
-  articles: Array<Article> | null;
+  articles: Array<ArticleWithStocks> | null;
+  error: string | null;
+};
+
+export type ArticleReturnRemove = {
+  article: Article | null;
+  // IDs of the Products made of the Article, that prevent it from being removed
+  usedByProducts: Array<number>;
   error: string | null;
 };
 
@@ -28,22 +42,84 @@ export type ArticleReturnList = {
 }
 
 /**
- * Writes an Article to the database
+ * Nested write that changes the stock of an Article at the location by the delta,
+ * starting from zero if the Article has no stock there yet
+ */
+const changeStockAt = (articleId: number, location: string, delta: number) => ({
+  upsert: {
+    where: { articleId_location: { articleId, location } },
+    create: { location, availableStock: delta },
+    update: { availableStock: { increment: delta } }
+  }
+});
+
+/**
+ * Writes an Article to the database. Without `id`, the Article is found by the identification,
+ * so writing it again updates it. With a location, the `availableStock` is the stock at that
+ * location and the total of the Article is the sum of its locations.
+ * Once the Article has stock by location, the stock changes without location are refused,
+ * so the total is always the sum of its locations
  *
  * @param article article to be created
+ * @param location location (warehouse) of the `availableStock`
  * @returns the created Article
  */
 export const upsert = async (
-  article: Article
+  article: Article,
+  location?: string | null
 ): Promise<ArticleReturnSingle> => {
   try {
     // get only the necessary attributes to write do Database
     // for instance, the `id` is not passed because the column is autoincrement (serial)
     const { identification, name, availableStock } = article;
-    const articleCreated = await prisma.article.upsert({
-      where: { id: article.id },
+
+    // without `id`, the Article is found by the identification, so the same Article
+    // can be written again, like by the files of each location
+    const where: Prisma.ArticleWhereUniqueInput = article.id
+      ? { id: article.id }
+      : { identification };
+
+    if (!location) {
+      const current = await prisma.article.findUnique({
+        where,
+        include: { stocks: true }
+      });
+      if (current && current.stocks.length > 0) {
+        return { article: current, locationRequired: true, error: null };
+      }
+      const articleCreated = await prisma.article.upsert({
+        where,
+        create: { identification, name, availableStock },
+        update: { identification, name, availableStock },
+        include: { stocks: true }
+      });
+      return {
+        article: articleCreated,
+        error: null
+      };
+    }
+
+    // write the stock of the location and then the total of all of them
+    const articleWritten = await prisma.article.upsert({
+      where,
       create: { identification, name, availableStock },
-      update: { identification, name, availableStock }
+      update: { identification, name }
+    });
+    await prisma.articleStock.upsert({
+      where: {
+        articleId_location: { articleId: articleWritten.id, location }
+      },
+      create: { articleId: articleWritten.id, location, availableStock },
+      update: { availableStock }
+    });
+    const total = await prisma.articleStock.aggregate({
+      where: { articleId: articleWritten.id },
+      _sum: { availableStock: true }
+    });
+    const articleCreated = await prisma.article.update({
+      where: { id: articleWritten.id },
+      data: { availableStock: total._sum.availableStock || 0 },
+      include: { stocks: true }
     });
     return {
       article: articleCreated,
@@ -70,7 +146,8 @@ export const get = async (id: number): Promise<ArticleReturnSingle> => {
     const single = await prisma.article.findUnique({
       where: {
         id
-      }
+      },
+      include: { stocks: true }
     });
     return { article: single, error: null };
   } catch (error) {
@@ -95,7 +172,8 @@ export const getByIdentification = async (
     const single = await prisma.article.findFirst({
       where: {
         identification
-      }
+      },
+      include: { stocks: true }
     });
     return { article: single, error: null };
   } catch (error) {
@@ -119,15 +197,10 @@ export const getAll = async ({
   identification: number | undefined;
 }): Promise<ArticleReturnList> => {
   try {
-    let filter = {};
-    if (identification) {
-      filter = {
-        where: {
-          identification
-        }
-      };
-    }
-    const allArticles = await prisma.article.findMany(filter);
+    const allArticles = await prisma.article.findMany({
+      where: identification ? { identification } : undefined,
+      include: { stocks: true }
+    });
     return { articles: allArticles, error: null };
   } catch (error) {
     log.error('Error fetching all Articles. Details:', error);
@@ -143,13 +216,16 @@ export const getAll = async ({
  * Based on a given Product, it finds its Article composition, checks for
  * the quantity involved in the production of one product. multiply it for the `quantity``
  * of Products made and update (reduce) the inventory of each of the Articles involved
- * and returns this list os used Articles with respective inventory quantity updated
+ * and returns this list os used Articles with respective inventory quantity updated.
+ * With a location, the stock of the Articles at that location is reduced too. Without it,
+ * the Articles must not have stock by location
  *
  * @returns a list of Articles with updated stock quantities
  */
 export const updateStockByProductMade = async (
   productId: number,
-  productQuantity: number
+  productQuantity: number,
+  location?: string | null
 ): Promise<ArticleReturnList> => {
   try {
     const productResult = await getProduct(productId);
@@ -165,6 +241,24 @@ export const updateStockByProductMade = async (
       };
     }
 
+    // the stock of the Articles kept by location can only be changed at a location, otherwise
+    // their total would no longer be the sum of their locations
+    if (!location) {
+      const stocksByLocation = await prisma.articleStock.count({
+        where: {
+          articleId: {
+            in: productResult.product.articles.map((aop) => aop.articleId)
+          }
+        }
+      });
+      if (stocksByLocation > 0) {
+        return {
+          error: `The Articles of the Product with id=${productId} have stock by location: a \`location\` must be provided`,
+          articles: []
+        };
+      }
+    }
+
     // Retrieve all the articles used by the Product passed as param
     // with all the details (current stock, for instance)
     // to check and update the article inventory
@@ -202,7 +296,16 @@ export const updateStockByProductMade = async (
             id: articleFetched.id
           },
           data: {
-            availableStock: newStockQuantity
+            availableStock: newStockQuantity,
+            ...(location
+              ? {
+                  stocks: changeStockAt(
+                    articleFetched.id,
+                    location,
+                    -productQuantity * aop.quantity
+                  )
+                }
+              : {})
           }
         });
 
@@ -228,7 +331,8 @@ export const updateStockByProductMade = async (
         id: {
           in: updatesArticles
         }
-      }
+      },
+      include: { stocks: true }
     });
     return { articles: allArticles, error: null };
   } catch (error) {
@@ -239,3 +343,174 @@ export const updateStockByProductMade = async (
     };
   }
 };
+
+/**
+ * Changes the stock of an Article by a relative quantity (`delta`), registering
+ * the movement with its reason. The increment is done by the database in the
+ * same statement, so concurrent movements of the same Article don't overwrite each other.
+ * The statement only changes a stock that doesn't go below zero, so a movement that would
+ * take it there is refused. A movement with the `key` of a movement already registered is not applied again
+ *
+ * @param identification identification of the Article that had the stock moved
+ * @param delta quantity to add (positive) or remove (negative) from the stock
+ * @param reason reason code of the movement
+ * @param location location (warehouse) of the movement, whose stock is changed together with the total.
+ * Required once the Article has stock by location
+ * @param key identifies the movement at its source, so it's applied only once
+ * @returns the Article with the updated stock, or null Article if it doesn't exist
+ */
+export const adjustStock = async (
+  identification: number,
+  delta: number,
+  reason: string,
+  location?: string | null,
+  key?: string | null
+): Promise<ArticleReturnSingle> => {
+  // stocks changed so far, undone if the movement can't be completed
+  const undo: Array<() => Promise<unknown>> = [];
+  try {
+    // If the article doesn't exist, there's nothing to update
+    const articleFetched = await prisma.article.findUnique({
+      where: { identification },
+      include: { stocks: true }
+    });
+    if (!articleFetched) {
+      return { article: null, error: null };
+    }
+    // the total of an Article with stock by location is the sum of its locations
+    if (!location && articleFetched.stocks.length > 0) {
+      return { article: articleFetched, locationRequired: true, error: null };
+    }
+
+    // a movement sent again (like by a replayed file) is already applied
+    if (key && (await prisma.stockMovement.findUnique({ where: { key } }))) {
+      return { article: articleFetched, alreadyApplied: true, error: null };
+    }
+
+    // the stock at the location, which starts from zero if the Article has none there yet
+    if (location && delta > 0) {
+      await prisma.articleStock.upsert({
+        where: { articleId_location: { articleId: articleFetched.id, location } },
+        create: { articleId: articleFetched.id, location, availableStock: delta },
+        update: { availableStock: { increment: delta } }
+      });
+    } else if (location) {
+      const movedAt = await prisma.articleStock.updateMany({
+        where: {
+          articleId: articleFetched.id,
+          location,
+          availableStock: { gte: -delta }
+        },
+        data: { availableStock: { increment: delta } }
+      });
+      if (movedAt.count === 0) {
+        return { article: articleFetched, insufficientStock: true, error: null };
+      }
+    }
+    if (location) {
+      undo.push(() =>
+        prisma.articleStock.updateMany({
+          where: { articleId: articleFetched.id, location },
+          data: { availableStock: { increment: -delta } }
+        })
+      );
+    }
+
+    // and the total
+    const moved = await prisma.article.updateMany({
+      where: { identification, availableStock: { gte: -delta } },
+      data: { availableStock: { increment: delta } }
+    });
+    if (moved.count === 0) {
+      await Promise.all(undo.map((u) => u()));
+      return { article: articleFetched, insufficientStock: true, error: null };
+    }
+    undo.push(() =>
+      prisma.article.update({
+        where: { identification },
+        data: { availableStock: { increment: -delta } }
+      })
+    );
+
+    await prisma.stockMovement.create({
+      data: {
+        articleId: articleFetched.id,
+        delta,
+        reason,
+        location: location || null,
+        key: key || null
+      }
+    });
+    const articleUpdated = await prisma.article.findUnique({
+      where: { identification },
+      include: { stocks: true }
+    });
+    return { article: articleUpdated, error: null };
+  } catch (error) {
+    // the same movement sent at the same time is registered only once: the other one
+    // is refused by the unique `key`, so its stock change is undone
+    if (
+      key &&
+      error instanceof Prisma.PrismaClientKnownRequestError &&
+      error.code === 'P2002'
+    ) {
+      await Promise.all(undo.map((u) => u()));
+      const articleFetched = await prisma.article.findUnique({
+        where: { identification },
+        include: { stocks: true }
+      });
+      return { article: articleFetched, alreadyApplied: true, error: null };
+    }
+    log.error('Error adjusting the stock of an Article. Details:', error);
+    return {
+      article: null,
+      error:
+        'Error adjusting the stock of an Article. Check the logs for more details'
+    };
+  }
+};
+
+/**
+ * Removes an Article from the database. Articles still used by some Product are
+ * not removed and the IDs of these Products are returned instead
+ *
+ * @param id primary key value of the Article to be removed
+ * @returns the removed Article, or null Article if it doesn't exist
+ */
+export const remove = async (
+  id: number,
+  force = false
+): Promise<ArticleReturnRemove> => {
+  try {
+    const articleFetched = await prisma.article.findUnique({ where: { id } });
+    if (!articleFetched) {
+      return { article: null, usedByProducts: [], error: null };
+    }
+
+    // the relationship restricts the deletion, so check it first to tell who uses it
+    const articlesOnProducts = await prisma.articlesOnProducts.findMany({
+      where: { articleId: id }
+    });
+    if (articlesOnProducts.length > 0 && force) {
+      // when forced, the Article is taken out of the Products composition first
+      await prisma.articlesOnProducts.deleteMany({ where: { articleId: id } });
+    } else if (articlesOnProducts.length > 0) {
+      return {
+        article: articleFetched,
+        usedByProducts: articlesOnProducts.map((aop) => aop.productId),
+        error: null
+      };
+    }
+
+    // remove the stock movements history together with the Article
+    const articleRemoved = await prisma.article.delete({ where: { id } });
+    return { article: articleRemoved, usedByProducts: [], error: null };
+  } catch (error) {
+    log.error('Error removing an Article. Details:', error);
+    return {
+      article: null,
+      usedByProducts: [],
+      error: 'Error removing an Article. Check the logs for more details'
+    };
+  }
+};
@@ -0,0 +1,106 @@
+import { prisma } from '../../prisma-client';
+import { upsert, get } from '..';
+import { adjustStock } from '../article';
+
+const identificationMock = 20211010090012999;
+
+describe('Adjust Article stock by movements', () => {
+  // Before each test, clean the database to run a "clean" test
+  beforeEach(async () => {
+    // clean
+    await prisma.article.deleteMany({});
+  });
+
+  // After all tests, clean the database for any test data inserted
+  afterAll(async () => {
+    // clean
+    await prisma.article.deleteMany({});
+  });
+
+  test('Adjusting the stock of an unknown Article returns null', async () => {
+    const result = await adjustStock(identificationMock, 5, 'received');
+    expect(result.article).toBeNull();
+    expect(result.error).toBeNull();
+  });
+
+  test('Concurrent movements of the same Article are all applied', async () => {
+    const created = await upsert({
+      name: 'Screw',
+      availableStock: 10,
+      identification: BigInt(identificationMock),
+      id: 0
+    });
+    expect(created.error).toBeNull();
+
+    // +5 received, -2 damaged and +1 returned at the same time
+    const results = await Promise.all([
+      adjustStock(identificationMock, 5, 'received'),
+      adjustStock(identificationMock, -2, 'damaged'),
+      adjustStock(identificationMock, 1, 'returned')
+    ]);
+    results.forEach((result) => expect(result.error).toBeNull());
+
+    const fetched = await get(created.article?.id!);
+    expect(fetched.article?.availableStock).toBe(14);
+
+    const movements = await prisma.stockMovement.findMany({
+      where: { articleId: created.article?.id! }
+    });
+    expect(movements.length).toBe(3);
+  });
+
+  test('A movement sent again with the same key is applied only once', async () => {
+    const created = await upsert({
+      name: 'Screw',
+      availableStock: 10,
+      identification: BigInt(identificationMock),
+      id: 0
+    });
+    expect(created.error).toBeNull();
+
+    // like a file replayed after it failed midway, sent once again and twice at the same time
+    const first = await adjustStock(identificationMock, 5, 'received', null, 'GRN-1');
+    expect(first.article?.availableStock).toBe(15);
+    expect(first.alreadyApplied).toBeFalsy();
+    const results = await Promise.all([
+      adjustStock(identificationMock, 5, 'received', null, 'GRN-1'),
+      adjustStock(identificationMock, 5, 'received', null, 'GRN-1')
+    ]);
+    results.forEach((result) => {
+      expect(result.error).toBeNull();
+      expect(result.alreadyApplied).toBe(true);
+    });
+
+    const fetched = await get(created.article?.id!);
+    expect(fetched.article?.availableStock).toBe(15);
+    const movements = await prisma.stockMovement.findMany({
+      where: { articleId: created.article?.id! }
+    });
+    expect(movements.length).toBe(1);
+  });
+
+  test('A movement that would take the stock below zero is refused', async () => {
+    const created = await upsert({
+      name: 'Screw',
+      availableStock: 2,
+      identification: BigInt(identificationMock),
+      id: 0
+    });
+    expect(created.error).toBeNull();
+
+    const refused = await adjustStock(identificationMock, -5, 'damaged');
+    expect(refused.error).toBeNull();
+    expect(refused.insufficientStock).toBe(true);
+
+    // and at a location, where the Article has no stock yet
+    const refusedAt = await adjustStock(identificationMock, -1, 'damaged', 'malmo');
+    expect(refusedAt.insufficientStock).toBe(true);
+
+    const fetched = await get(created.article?.id!);
+    expect(fetched.article?.availableStock).toBe(2);
+    const movements = await prisma.stockMovement.findMany({
+      where: { articleId: created.article?.id! }
+    });
+    expect(movements.length).toBe(0);
+  });
+});
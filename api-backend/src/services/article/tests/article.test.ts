@@ -1,5 +1,11 @@
 import { request } from 'http';
-import { upsert, get, checkArticleHealth } from '..';
+import {
+  upsert,
+  get,
+  checkArticleHealth,
+  adjustStock,
+  updateStockByProductMade
+} from '..';
 import { prisma } from '../../prisma-client';
 
 const identificationMockBigInt = BigInt(20211010090012331);
@@ -36,7 +42,7 @@ describe('Testing CRUD Operations', () => {
     expect(result.article?.identification).toBe(identificationMockBigInt);
   });
 
-  test('Attempt to insert duplicated identification Articles should return error', async () => {
+  test('Insert an Article with the identification of another one updates it', async () => {
     const result = await upsert({
       name: 'Test',
       availableStock: 0,
@@ -47,15 +53,19 @@ describe('Testing CRUD Operations', () => {
     expect(result.error).toBeNull();
     expect(result.article?.identification).toBe(identificationMockBigInt);
 
-    const resultDupl = await upsert({
-      name: 'Test',
-      availableStock: 0,
+    // the files are re-ingested, so the Article is found by the identification instead of duplicated
+    const resultAgain = await upsert({
+      name: 'Test renamed',
+      availableStock: 7,
       identification: identificationMockBigInt,
       id: 0,
     });
 
-    expect(resultDupl.article).toBeNull();
-    expect(resultDupl.error).not.toBeNull();
+    expect(resultAgain.error).toBeNull();
+    expect(resultAgain.article?.id).toBe(result.article?.id);
+    expect(resultAgain.article?.name).toBe('Test renamed');
+    expect(resultAgain.article?.availableStock).toBe(7);
+    expect(await prisma.article.count()).toBe(1);
   });
 
   test('Insert and Update Article', async () => {
@@ -86,6 +96,101 @@ describe('Testing CRUD Operations', () => {
     expect(resultGet.article?.identification).toBe(identificationMockBigInt);
   });
 
+  test('Keep the stock of an Article at each location', async () => {
+    const identification = 11223355;
+    const result = await upsert(
+      {
+        name: 'Screw',
+        availableStock: 100,
+        identification: BigInt(identification),
+        id: 0,
+      },
+      'stockholm',
+    );
+    expect(result.error).toBeNull();
+
+    // the same Article is found by the identification, and the total is the sum of the locations
+    const resultOther = await upsert(
+      {
+        name: 'Screw',
+        availableStock: 40,
+        identification: BigInt(identification),
+        id: 0,
+      },
+      'malmo',
+    );
+    expect(resultOther.article?.id).toBe(result.article?.id);
+    expect(resultOther.article?.availableStock).toBe(140);
+    expect(resultOther.article?.stocks?.length).toBe(2);
+
+    // a movement at a location changes it and the total
+    const resultMoved = await adjustStock(identification, -10, 'damaged', 'malmo');
+    expect(resultMoved.article?.availableStock).toBe(130);
+    const malmo = resultMoved.article?.stocks?.find((s) => s.location === 'malmo');
+    expect(malmo?.availableStock).toBe(30);
+  });
+
+  test('Location upsert after total-only sale', async () => {
+    const identification = 11223366;
+    const stockholm = await upsert(
+      {
+        name: 'Leg',
+        availableStock: 100,
+        identification: BigInt(identification),
+        id: 0,
+      },
+      'stockholm',
+    );
+    await upsert(
+      {
+        name: 'Leg',
+        availableStock: 40,
+        identification: BigInt(identification),
+        id: 0,
+      },
+      'malmo',
+    );
+    const articleId = stockholm.article?.id!;
+    const chair = await prisma.product.create({
+      data: {
+        name: 'Chair',
+        price: 10,
+        articles: { create: [{ articleId, quantity: 4 }] },
+      },
+    });
+
+    // the sales and movements without location are refused, so they can't be undone by
+    // the next inventory of a location
+    const sale = await updateStockByProductMade(chair.id, 1);
+    expect(sale.error).not.toBeNull();
+    const movement = await adjustStock(identification, -2, 'damaged');
+    expect(movement.locationRequired).toBe(true);
+    const total = await upsert({
+      name: 'Leg',
+      availableStock: 10,
+      identification: BigInt(identification),
+      id: 0,
+    });
+    expect(total.locationRequired).toBe(true);
+    expect((await get(articleId)).article?.availableStock).toBe(140);
+
+    // a sale at a location is kept by the next inventory of another location
+    const saleAt = await updateStockByProductMade(chair.id, 1, 'malmo');
+    expect(saleAt.error).toBeNull();
+    const result = await upsert(
+      {
+        name: 'Leg',
+        availableStock: 90,
+        identification: BigInt(identification),
+        id: 0,
+      },
+      'stockholm',
+    );
+    expect(result.article?.availableStock).toBe(126);
+
+    await prisma.product.deleteMany({});
+  });
+
   /**
    * queries the number of rows to check db connection
    */
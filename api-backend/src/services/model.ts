@@ -1,4 +1,16 @@
-import { ArticlesOnProducts, Product } from '@prisma/client';
+import {
+  Article,
+  ArticleStock,
+  ArticlesOnProducts,
+  Prisma,
+  Product,
+  ProductPrice
+} from '@prisma/client';
+
+/**
+ * Article with its stock at each location (warehouse). Its `availableStock` is the total
+ */
+export type ArticleWithStocks = Article & { stocks?: Array<ArticleStock> };
 
 /**
  * Specify quantity of articles used to made a product
@@ -8,9 +20,47 @@ export type ArticlesAssignment = {
   quantity: number;
 };
 
-export type ProductComplete = Product & { articles: Array<ArticlesOnProducts> };
+/**
+ * Price of a Product in a currency
+ */
+export type PriceAssignment = {
+  currency: string;
+  price: Prisma.Decimal | string;
+};
 
+/**
+ * Data to write a Product. The `sku` is optional because Products
+ * created before the SKU existed are identified by the name, and the
+ * `currency` because the prices without it are in EUR
+ */
+export type ProductInput = Omit<Product, 'sku' | 'currency'> & {
+  sku?: string | null;
+  currency?: string | null;
+};
+
+export type ProductComplete = Product & {
+  articles: Array<ArticlesOnProducts>;
+  prices: Array<ProductPrice>;
+};
+
+/**
+ * Product with the quantity that can be made with the stock of its Articles at the
+ * `location`, or at all the locations when it's null
+ */
 export type ProductAvailable = Product & {
+  prices: Array<ProductPrice>;
   articles: Array<any>;
+  location: string | null;
   quantityAvailable: number;
 };
+
+/**
+ * Reason codes accepted for a relative stock change (movement) of an Article
+ */
+export const stockMovementReasons = [
+  'received',
+  'damaged',
+  'returned',
+  'lost',
+  'correction'
+];
@@ -3,8 +3,10 @@ import { log } from '../../logger';
 import { prisma } from '../prisma-client';
 import {
   ArticlesAssignment,
+  PriceAssignment,
   ProductAvailable,
-  ProductComplete
+  ProductComplete,
+  ProductInput
 } from '../model';
 import { get as getArticle } from '../article';
 
@@ -32,6 +34,17 @@ export type ProductReturnList<T extends Product> = {
   return await prisma.product.count();
 }
 
+/**
+ * Change of the SKU of an existing Product: the SKU sent, or none (removed) if it's sent
+ * as null. Without the SKU in the request, the Product keeps its SKU
+ */
+const skuChange = (product: ProductInput): { sku?: string | null } => {
+  if (product.sku === null) {
+    return { sku: null };
+  }
+  return product.sku ? { sku: product.sku } : {};
+};
+
 /**
  * Writes a Product to the database
  *
@@ -39,13 +52,18 @@ export type ProductReturnList<T extends Product> = {
  * @returns the created Product
  */
 export const upsert = async (
-  product: Product,
-  articles: Array<ArticlesAssignment>
+  product: ProductInput,
+  articles: Array<ArticlesAssignment>,
+  prices: Array<PriceAssignment> = []
 ): Promise<ProductReturn<Product>> => {
   try {
     // get only the necessary attributes to write do Database
     // for instance, the `id` is not passed because the column is autoincrement (serial)
     const { name, price } = product;
+    const sku = product.sku || null;
+    const currency = product.currency || 'EUR';
+    // an existing Product keeps its SKU when none is sent, like by the files older than the SKU
+    const skuUpdate = skuChange(product);
 
     const articlesOnProductsCreate = articles.map((article) => ({
       quantity: article.quantity,
@@ -57,14 +75,22 @@ export const upsert = async (
       create: {
         name,
         price,
+        sku,
+        currency,
         articles: {
           createMany: {
             data: articlesOnProductsCreate,
             skipDuplicates: true
           }
+        },
+        prices: {
+          createMany: {
+            data: prices,
+            skipDuplicates: true
+          }
         }
       },
-      update: { name, price }
+      update: { name, price, currency, ...skuUpdate }
     });
     const productComplete = Object.assign(productCreated, { articles: [] });
     return {
@@ -81,6 +107,71 @@ export const upsert = async (
   }
 };
 
+/**
+ * Updates an existing Product, replacing its Article composition and its prices by the given ones.
+ * The SKU is kept if the `sku` is not given and removed if it's null
+ *
+ * @param product Product to be updated, identified by the `id`
+ * @param articles Articles the Product is made of from now on
+ * @param prices prices of the Product in each currency from now on
+ * @returns the updated Product, or null Product if it doesn't exist
+ */
+export const update = async (
+  product: ProductInput,
+  articles: Array<ArticlesAssignment>,
+  prices: Array<PriceAssignment> = []
+): Promise<ProductReturn<ProductComplete>> => {
+  try {
+    const existing = await prisma.product.findUnique({
+      where: { id: product.id }
+    });
+    if (!existing) {
+      return { product: null, error: null };
+    }
+
+    const { name, price } = product;
+    const currency = product.currency || 'EUR';
+    const articlesOnProductsCreate = articles.map((article) => ({
+      quantity: article.quantity,
+      articleId: article.articleId
+    }));
+
+    // remove the current composition and prices and create the new ones in the same write
+    const productUpdated = await prisma.product.update({
+      where: { id: product.id },
+      data: {
+        name,
+        price,
+        currency,
+        ...skuChange(product),
+        articles: {
+          deleteMany: {},
+          createMany: {
+            data: articlesOnProductsCreate,
+            skipDuplicates: true
+          }
+        },
+        prices: {
+          deleteMany: {},
+          createMany: {
+            data: prices,
+            skipDuplicates: true
+          }
+        }
+      },
+      include: { articles: true, prices: true }
+    });
+    return { product: productUpdated, error: null };
+  } catch (error) {
+    log.error('Error updating a Product. Details:', error);
+    return {
+      product: null,
+      error:
+        'Error updating a Product on the database. Check the logs for more details'
+    };
+  }
+};
+
 /**
  * Fetches a single Product with primary key = param id
  *
@@ -94,7 +185,8 @@ export const get = async (
     const retrievedProduct = await prisma.product.findUnique({
       where: {
         id
-      }
+      },
+      include: { prices: true }
     });
 
     // if doesnt find the product, don't waste timing searching for articlesOnProducts
@@ -124,14 +216,32 @@ export const get = async (
 };
 
 /**
- * Fetches a list of Products
+ * Fetches a list of Products, optionally filtered by SKU and/or name
  * TODO: Pagination/Limit
  *
  * @returns a list with all Products
  */
-export const getAll = async (): Promise<ProductReturnList<Product>> => {
+export const getAll = async ({
+  sku,
+  name
+}: {
+  sku?: string;
+  name?: string;
+} = {}): Promise<ProductReturnList<Product>> => {
   try {
-    const allProducts = await prisma.product.findMany({});
+    // filter by the natural keys of the Product, if provided
+    const where: { sku?: string; name?: string } = {};
+    if (sku) {
+      where.sku = sku;
+    }
+    if (name) {
+      where.name = name;
+    }
+    const allProducts = await prisma.product.findMany({
+      where,
+      orderBy: { id: 'asc' },
+      include: { prices: true }
+    });
     return { products: allProducts, error: null };
   } catch (error) {
     log.error('Error fetching all Products. Details:', error);
@@ -145,10 +255,14 @@ export const getAll = async (): Promise<ProductReturnList<Product>> => {
 /**
  * Fetches a list of Products with Articles used
  * TODO: Pagination/Limit
+ * @param id primary key value of the Product, to fetch only it
+ * @param location location (warehouse) whose stock is used to evaluate the quantity available.
+ * If not provided, the total stock of all the locations is used
  * @returns a list with all Products
  */
 export const getAllWithAvailability = async (
-  id?: number
+  id?: number,
+  location?: string
 ): Promise<ProductReturnList<ProductAvailable>> => {
   try {
     // Check how the code above just looks like a GraphQL resolver!
@@ -156,15 +270,10 @@ export const getAllWithAvailability = async (
     // the data we need for this logic. Nice TODO: GraphQL.
 
     // 1) Retrieve all the products that will be returned
-    let filter = {};
-    if (id) {
-      filter = {
-        where: {
-          id
-        }
-      };
-    }
-    const allProducts = await prisma.product.findMany(filter);
+    const allProducts = await prisma.product.findMany({
+      where: id ? { id } : undefined,
+      include: { prices: true }
+    });
 
     // 2) For every Product, fetch the Product composition, that is the Articles and respective
     // quantities from ArticleOnProduct relation
@@ -196,7 +305,8 @@ export const getAllWithAvailability = async (
                 article: {
                   name: '<failed to fetch>',
                   identification: 0,
-                  availableStock: -1
+                  availableStock: -1,
+                  stocks: []
                 }
               };
             }
@@ -214,10 +324,15 @@ export const getAllWithAvailability = async (
         //  find the min stock/quantity ratio among all the Articles needed to know
         // what's the minimum quantity
         //  of Products can be done, because that will the available Product count
+        // at a location, an Article without stock there has none
         const articlesQuantityProducts =
-          articlesOnProductsWithArticleDetails.map((apdetail) =>
-            Math.floor(apdetail.article?.availableStock! / apdetail.quantity)
-          );
+          articlesOnProductsWithArticleDetails.map((apdetail) => {
+            const stock = location
+              ? apdetail.article?.stocks?.find((s) => s.location === location)
+                  ?.availableStock || 0
+              : apdetail.article?.availableStock!;
+            return Math.floor(stock / apdetail.quantity);
+          });
         // among the array of how many Products can be made by each Article, get the min
         // because that will be the available Product count
         const quantityAvailable = Math.min.apply(
@@ -229,6 +344,7 @@ export const getAllWithAvailability = async (
         return {
           ...product,
           articles: articlesOnProductsWithArticleDetails,
+          location: location || null,
           quantityAvailable
         };
       })
@@ -243,3 +359,28 @@ export const getAllWithAvailability = async (
     };
   }
 };
+
+/**
+ * Removes a Product and its Article composition from the database
+ *
+ * @param id primary key value of the Product to be removed
+ * @returns the removed Product, or null Product if it doesn't exist
+ */
+export const remove = async (id: number): Promise<ProductReturn<Product>> => {
+  try {
+    const productFetched = await prisma.product.findUnique({ where: { id } });
+    if (!productFetched) {
+      return { product: null, error: null };
+    }
+
+    // the composition (ArticlesOnProducts) is removed by the cascade of the relationship
+    const productRemoved = await prisma.product.delete({ where: { id } });
+    return { product: productRemoved, error: null };
+  } catch (error) {
+    log.error('Error removing a Product. Details:', error);
+    return {
+      product: null,
+      error: 'Error removing a Product. Check the logs for more details'
+    };
+  }
+};
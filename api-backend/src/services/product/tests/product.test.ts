@@ -1,6 +1,6 @@
 import { Prisma } from '@prisma/client';
 import { prisma } from '../../prisma-client';
-import { upsert as upserProduct, getAll, get as getProduct, checkProductHealth } from '..';
+import { upsert as upserProduct, update as updateProduct, getAll, get as getProduct, checkProductHealth } from '..';
 import { upsert as upserArticle } from '../../article';
 import { request } from 'http';
 
@@ -324,4 +324,153 @@ describe('Testing Product relationship with Article', () => {
       expect(res.statusCode).toEqual(200);
     })
   });
-});
\ No newline at end of file
+});
+/**
+ * Those tests aims to validate the update of a Product by its natural key (SKU)
+ */
+describe('Testing Product update by SKU', () => {
+  // Before each test, clean the database to run a "clean" test
+  beforeEach(async () => {
+    // clean
+    await prisma.product.deleteMany({});
+    await prisma.article.deleteMany({});
+  });
+
+  // After all tests, clean the database for any test data inserted
+  afterAll(async () => {
+    // clean
+    await prisma.product.deleteMany({});
+    await prisma.article.deleteMany({});
+  });
+
+  test('Update the price and replace the composition of a Product', async () => {
+    const resultArticle1 = await upserArticle({
+      name: 'Article 1',
+      availableStock: 5,
+      identification: BigInt(11223344),
+      id: 0,
+    });
+    const resultArticle2 = await upserArticle({
+      name: 'Article 2',
+      availableStock: 7,
+      identification: BigInt(55667788),
+      id: 0,
+    });
+
+    const result = await upserProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        sku: 'CHAIR-01',
+        id: 0,
+      },
+      [{ articleId: resultArticle1.article?.id!, quantity: 4 }],
+    );
+    expect(result.error).toBeNull();
+
+    // find it by the SKU, like the database updater does
+    const resultFind = await getAll({ sku: 'CHAIR-01' });
+    expect(resultFind.products?.length).toBe(1);
+
+    const resultUpdate = await updateProduct(
+      {
+        name: 'Dining Chair',
+        price: new Prisma.Decimal(49.9),
+        sku: 'CHAIR-01',
+        id: resultFind.products![0].id,
+      },
+      [{ articleId: resultArticle2.article?.id!, quantity: 2 }],
+    );
+    expect(resultUpdate.error).toBeNull();
+    expect(resultUpdate.product?.price.toNumber()).toBe(49.9);
+    expect(resultUpdate.product?.articles.length).toBe(1);
+    expect(resultUpdate.product?.articles[0].articleId).toBe(resultArticle2.article?.id);
+
+    // no duplicates were created
+    const resultGet = await getAll();
+    expect(resultGet.products?.length).toBe(1);
+  });
+
+  test('Keep the SKU of a Product updated without it', async () => {
+    const result = await upserProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        sku: 'CHAIR-01',
+        id: 0,
+      },
+      [],
+    );
+    expect(result.error).toBeNull();
+
+    // like a products file older than the SKU, re-ingested
+    const resultUpdate = await updateProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        id: result.product?.id!,
+      },
+      [],
+    );
+    expect(resultUpdate.product?.sku).toBe('CHAIR-01');
+
+    // only an explicit null removes it
+    const resultCleared = await updateProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        sku: null,
+        id: result.product?.id!,
+      },
+      [],
+    );
+    expect(resultCleared.product?.sku).toBeNull();
+  });
+
+  test('Keep the price of a Product in each currency', async () => {
+    const result = await upserProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        currency: 'EUR',
+        id: 0,
+      },
+      [],
+      [
+        { currency: 'EUR', price: priceDecimal },
+        { currency: 'SEK', price: new Prisma.Decimal(169) },
+      ],
+    );
+    expect(result.error).toBeNull();
+    expect(result.product?.currency).toBe('EUR');
+
+    // the prices are replaced, like the composition
+    const resultUpdate = await updateProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        currency: 'EUR',
+        id: result.product?.id!,
+      },
+      [],
+      [{ currency: 'SEK', price: new Prisma.Decimal(159) }],
+    );
+    expect(resultUpdate.error).toBeNull();
+    expect(resultUpdate.product?.prices.length).toBe(1);
+    expect(resultUpdate.product?.prices[0].currency).toBe('SEK');
+    expect(resultUpdate.product?.prices[0].price.toNumber()).toBe(159);
+  });
+
+  test('Updating an unknown Product returns null', async () => {
+    const resultUpdate = await updateProduct(
+      {
+        name: 'Dining Chair',
+        price: priceDecimal,
+        id: 999999,
+      },
+      [],
+    );
+    expect(resultUpdate.product).toBeNull();
+    expect(resultUpdate.error).toBeNull();
+  });
+});
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"database-autoupdater/replay"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Start serves the admin HTTP endpoints at the address. It blocks, so it's meant to run in a go routine.
+// Endpoints:
+//   - POST /replay: moves failed files back to the incoming folder. The filters are the query params
+//     `domain`, `olderThan` and `newerThan` (durations like `30m`), `errorContains`,
+//     `onlyFailedRecords` and `dryRun` (booleans)
+func Start(address, incomingFolder, failFolder string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replay", replayHandler(incomingFolder, failFolder))
+
+	logrus.Infof("Admin endpoints listening at %s", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logrus.Errorf("Error serving the admin endpoints at %s. Details: %s", address, err)
+	}
+}
+
+func replayHandler(incomingFolder, failFolder string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		options, err := replayOptions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+			return
+		}
+		options.IncomingFolder = incomingFolder
+		options.FailFolder = failFolder
+
+		entries, err := replay.Run(options)
+		if err != nil {
+			logrus.Errorf("Error replaying the failed files. Details: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// replayOptions reads the replay filters from the query params
+func replayOptions(r *http.Request) (replay.Options, error) {
+	query := r.URL.Query()
+	options := replay.Options{
+		Domain:        query.Get("domain"),
+		ErrorContains: query.Get("errorContains"),
+	}
+
+	var err error
+	if options.OlderThan, err = parseDuration(query.Get("olderThan")); err != nil {
+		return options, err
+	}
+	if options.NewerThan, err = parseDuration(query.Get("newerThan")); err != nil {
+		return options, err
+	}
+	if options.OnlyFailedRecords, err = parseBool(query.Get("onlyFailedRecords")); err != nil {
+		return options, err
+	}
+	if options.DryRun, err = parseBool(query.Get("dryRun")); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
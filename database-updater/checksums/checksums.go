@@ -0,0 +1,240 @@
+package checksums
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database-autoupdater/helpers"
+	"database-autoupdater/reports"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix is the extension of the checksum files: the sidecar of a single file, named after it
+// (e.g.: inventory.json.sha256), or a manifest listing several files of its folder
+const Suffix = ".sha256"
+
+// Options of the verification of the incoming files
+type Options struct {
+	// Wait is how long a file waits for its checksum to arrive or, when it doesn't match yet,
+	// for the file to be completely written. Zero verifies the file only once
+	Wait time.Duration
+	// Interval is how often the checksum is looked for while waiting
+	Interval time.Duration
+	// Required rejects the files without checksum once the Wait is over
+	Required bool
+}
+
+// MismatchError tells that the content of the file doesn't have the expected checksum,
+// usually because the file was truncated by the transfer
+type MismatchError struct {
+	File     string
+	Expected string
+	Actual   string
+	Size     int64
+}
+
+func (e MismatchError) Error() string {
+	return fmt.Sprintf("the checksum of %s (%d bytes) is %s instead of %s. The file is incomplete or corrupted", e.File, e.Size, e.Actual, e.Expected)
+}
+
+// IsChecksumFile tells whether the file is a checksum sidecar or manifest, so it's not taken as data
+func IsChecksumFile(filePath string) bool {
+	return strings.HasSuffix(filePath, Suffix)
+}
+
+// Verify checks the file against its checksum, found at its sidecar or at a manifest of its folder,
+// waiting for the checksum (or the rest of the file) up to the options Wait. The sidecar is removed once
+// the file is checked, while a manifest loses the entry of the file once it's verified, and it's removed
+// once all the files it lists are verified. It returns nil, without error, if the file has no checksum and it's not required
+func Verify(filePath string, options Options) (*reports.Checksum, error) {
+	interval := options.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(options.Wait)
+	for {
+		checksum, err := check(filePath)
+		if err == nil && checksum != nil && checksum.Actual != checksum.Expected {
+			err = MismatchError{File: filepath.Base(filePath), Expected: checksum.Expected, Actual: checksum.Actual, Size: checksum.Size}
+		}
+
+		verified := err == nil && checksum != nil
+		if verified || !time.Now().Before(deadline) {
+			if err == nil && checksum == nil && options.Required {
+				err = fmt.Errorf("no checksum of %s was found (a %s sidecar or a manifest of its folder)", filepath.Base(filePath), filepath.Base(filePath)+Suffix)
+			}
+			if checksum != nil && checksum.Source == filepath.Base(filePath)+Suffix {
+				os.Remove(filePath + Suffix)
+			} else if verified {
+				if err := removeEntry(filepath.Join(filepath.Dir(filePath), checksum.Source), filepath.Base(filePath)); err != nil {
+					return checksum, err
+				}
+			}
+			return checksum, err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// check computes the checksum of the file and finds the expected one. The checksum is nil if none is found
+func check(filePath string) (*reports.Checksum, error) {
+	expected, source, err := Lookup(filePath)
+	if err != nil || expected == "" {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := helpers.HashFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error computing the checksum of %s: %s", filePath, err)
+	}
+	return &reports.Checksum{Algorithm: "sha256", Source: source, Expected: expected, Actual: actual, Size: info.Size()}, nil
+}
+
+// Lookup finds the expected SHA-256 hash of the file at its sidecar or, without sidecar, at the manifests
+// of its folder, the newest first: a file sent again is listed by the manifest sent with it. It returns
+// the hash and the name of the checksum file, or an empty hash if none lists the file
+func Lookup(filePath string) (string, string, error) {
+	name := filepath.Base(filePath)
+	sidecar := filePath + Suffix
+	if _, err := os.Stat(sidecar); err == nil {
+		entries, err := read(sidecar)
+		if err != nil {
+			return "", "", err
+		}
+		// a sidecar may have only the hash, without the file name
+		for _, e := range entries {
+			if e.name == "" || e.name == name {
+				return e.hash, filepath.Base(sidecar), nil
+			}
+		}
+		return "", "", fmt.Errorf("the checksum file %s doesn't list %s", filepath.Base(sidecar), name)
+	}
+
+	manifests, err := newestFirst(filepath.Join(filepath.Dir(filePath), "*"+Suffix))
+	if err != nil {
+		return "", "", err
+	}
+	for _, manifest := range manifests {
+		entries, err := read(manifest)
+		if err != nil {
+			return "", "", err
+		}
+		for _, e := range entries {
+			if e.name == name {
+				return e.hash, filepath.Base(manifest), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// newestFirst lists the files matching the pattern, the last modified first
+func newestFirst(pattern string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	modified := map[string]time.Time{}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modified[path] = info.ModTime()
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return modified[paths[i]].After(modified[paths[j]]) })
+	return paths, nil
+}
+
+// manifestsMutex serializes the changes of the manifests, shared by the files verified concurrently
+var manifestsMutex sync.Mutex
+
+// removeEntry removes the lines of the verified file from the manifest, so a file sent again later with the
+// same name isn't checked against it, and removes the manifest once it doesn't list any other file
+func removeEntry(manifest, name string) error {
+	manifestsMutex.Lock()
+	defer manifestsMutex.Unlock()
+
+	content, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading the checksum file %s: %s", manifest, err)
+	}
+	kept := []string{}
+	listed := 0
+	for _, line := range strings.Split(string(content), "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			kept = append(kept, line)
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) == 2 && filepath.Base(strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")) == name {
+			continue
+		}
+		kept = append(kept, line)
+		listed++
+	}
+	if listed == 0 {
+		if err := os.Remove(manifest); err != nil {
+			return fmt.Errorf("error removing the checksum file %s: %s", manifest, err)
+		}
+		return nil
+	}
+	if err := ioutil.WriteFile(manifest, []byte(strings.Join(kept, "\n")), 0666); err != nil {
+		return fmt.Errorf("error writing the checksum file %s: %s", manifest, err)
+	}
+	return nil
+}
+
+// entry is a line of a checksum file
+type entry struct {
+	hash string
+	name string
+}
+
+// read parses a checksum file in the format of sha256sum: one `<hash>  <name>` line per file, where
+// the name may be prefixed with `*` (binary mode). Blank lines and lines starting with # are ignored
+func read(checksumPath string) ([]entry, error) {
+	content, err := ioutil.ReadFile(checksumPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the checksum file %s: %s", checksumPath, err)
+	}
+	entries := []entry{}
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		hash := strings.ToLower(fields[0])
+		if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("invalid SHA-256 hash at line %d of the checksum file %s", line, filepath.Base(checksumPath))
+		}
+		e := entry{hash: hash}
+		if len(fields) == 2 {
+			e.name = filepath.Base(strings.TrimPrefix(strings.TrimSpace(fields[1]), "*"))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// WriteSidecar writes the sidecar of a file with the hash of the content, so the file can be
+// verified like any other when it's placed (e.g.: replayed) at the incoming folder
+func WriteSidecar(filePath string, content []byte) error {
+	hash := sha256.Sum256(content)
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hash[:]), filepath.Base(filePath))
+	return ioutil.WriteFile(filePath+Suffix, []byte(line), 0666)
+}
@@ -0,0 +1,105 @@
+package checksums
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hashOf(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestVerify(t *testing.T) {
+	folder := t.TempDir()
+	content := `{"inventory": []}`
+	filePath := filepath.Join(folder, "inventory.json")
+	ioutil.WriteFile(filePath, []byte(content), 0666)
+
+	// without checksum the file is processed, unless it's required
+	checksum, err := Verify(filePath, Options{})
+	assert.Nil(t, err)
+	assert.Nil(t, checksum)
+	_, err = Verify(filePath, Options{Required: true})
+	assert.NotNil(t, err)
+
+	// a sidecar with only the hash. It's removed once the file is verified
+	ioutil.WriteFile(filePath+Suffix, []byte(hashOf(content)+"\n"), 0666)
+	checksum, err = Verify(filePath, Options{Required: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "inventory.json.sha256", checksum.Source)
+	assert.Equal(t, hashOf(content), checksum.Actual)
+	_, err = os.Stat(filePath + Suffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// a truncated file doesn't match the sidecar
+	ioutil.WriteFile(filePath+Suffix, []byte(fmt.Sprintf("%s  inventory.json\n", hashOf(content+"\n"))), 0666)
+	checksum, err = Verify(filePath, Options{})
+	assert.IsType(t, MismatchError{}, err)
+	assert.Equal(t, hashOf(content+"\n"), checksum.Expected)
+
+	// a manifest listing several files, in the format of sha256sum
+	manifest := fmt.Sprintf("# batch of 2021-10-01\n%s *products.json\n%s  inventory.json\n", hashOf("{}"), hashOf(content))
+	ioutil.WriteFile(filepath.Join(folder, "manifest"+Suffix), []byte(manifest), 0666)
+	checksum, err = Verify(filePath, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, "manifest.sha256", checksum.Source)
+
+	// the entry of the verified file is removed, and the manifest once it lists no other file
+	listed, err := read(filepath.Join(folder, "manifest"+Suffix))
+	assert.Nil(t, err)
+	assert.Equal(t, []entry{{hash: hashOf("{}"), name: "products.json"}}, listed)
+	productsPath := filepath.Join(folder, "products.json")
+	ioutil.WriteFile(productsPath, []byte("{}"), 0666)
+	_, err = Verify(productsPath, Options{Required: true})
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(folder, "manifest"+Suffix))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLookupNewestManifest(t *testing.T) {
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "inventory.json")
+
+	// the file sent again is listed by the manifest sent with it, not by an older one
+	ioutil.WriteFile(filepath.Join(folder, "monday"+Suffix), []byte(hashOf("old")+"  inventory.json\n"), 0666)
+	ioutil.WriteFile(filepath.Join(folder, "tuesday"+Suffix), []byte(hashOf("new")+"  inventory.json\n"), 0666)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	os.Chtimes(filepath.Join(folder, "tuesday"+Suffix), yesterday, yesterday)
+	os.Chtimes(filepath.Join(folder, "monday"+Suffix), yesterday.Add(-24*time.Hour), yesterday.Add(-24*time.Hour))
+	hash, source, err := Lookup(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, hashOf("new"), hash)
+	assert.Equal(t, "tuesday.sha256", source)
+}
+
+func TestVerifyWait(t *testing.T) {
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "orders.json")
+	ioutil.WriteFile(filePath, []byte(`{"orders": [`), 0666)
+
+	// the sidecar arrives first and the file is completed later
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ioutil.WriteFile(filePath+Suffix, []byte(hashOf(`{"orders": []}`)), 0666)
+		time.Sleep(20 * time.Millisecond)
+		ioutil.WriteFile(filePath, []byte(`{"orders": []}`), 0666)
+	}()
+	checksum, err := Verify(filePath, Options{Wait: time.Second, Interval: 5 * time.Millisecond, Required: true})
+	assert.Nil(t, err)
+	assert.Equal(t, checksum.Expected, checksum.Actual)
+
+	// the file is rejected if it's still incomplete once the wait is over
+	ioutil.WriteFile(filePath, []byte(`{"orders": [`), 0666)
+	ioutil.WriteFile(filePath+Suffix, []byte(hashOf(`{"orders": []}`)), 0666)
+	_, err = Verify(filePath, Options{Wait: 20 * time.Millisecond, Interval: 5 * time.Millisecond})
+	assert.IsType(t, MismatchError{}, err)
+}
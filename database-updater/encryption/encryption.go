@@ -0,0 +1,256 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Extensions of the encrypted incoming files. The name without it tells the format of the content, like
+// inventory.json.age or inventory.xlsx.gpg
+const (
+	AgeSuffix = ".age"
+	GPGSuffix = ".gpg"
+)
+
+// SignatureSuffix is the extension of the detached OpenPGP signature of an encrypted file, named after
+// it (e.g.: inventory.json.gpg.sig). It signs the encrypted file, as it was placed
+const SignatureSuffix = ".sig"
+
+// Config tells where the keys are. Every file is optional, but an encrypted file can't be read without the
+// key of its format
+type Config struct {
+	// AgeIdentityFile has the age identities (AGE-SECRET-KEY-1...), one per line, like the output of age-keygen
+	AgeIdentityFile string
+	// GPGKeyringFile is the OpenPGP secret keyring, armored or binary, like the output of gpg --export-secret-keys
+	GPGKeyringFile string
+	// GPGPassphraseFile has the passphrase of the protected secret keys of the keyring
+	GPGPassphraseFile string
+	// SignersKeyringFile is the OpenPGP public keyring of the allow-listed suppliers. When set, every
+	// encrypted file must have a detached signature made by one of its keys
+	SignersKeyringFile string
+}
+
+// Keys are the keys loaded from the files of a Config
+type Keys struct {
+	AgeIdentities []age.Identity
+	GPGKeyring    openpgp.EntityList
+	Signers       openpgp.EntityList
+}
+
+// Result tells how an encrypted file was read
+type Result struct {
+	// Method is `age` or `gpg`
+	Method string
+	// Signer is the identity of the key that signed the file, if a signature was required
+	Signer string
+}
+
+// IsEncrypted tells whether the file is encrypted, by its extension
+func IsEncrypted(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == AgeSuffix || ext == GPGSuffix
+}
+
+// IsSignature tells whether the file is a detached signature, so it's not taken as data
+func IsSignature(filePath string) bool {
+	return strings.HasSuffix(filePath, SignatureSuffix)
+}
+
+// PlainPath is the path of the file without the extension of the encryption, which tells the format of the content
+func PlainPath(filePath string) string {
+	if !IsEncrypted(filePath) {
+		return filePath
+	}
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath))
+}
+
+// Load reads the keys of the config. The keys of an empty config are empty
+func Load(config Config) (*Keys, error) {
+	keys := &Keys{}
+	if config.AgeIdentityFile != "" {
+		in, err := os.Open(config.AgeIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the age identity file %s: %s", config.AgeIdentityFile, err)
+		}
+		defer in.Close()
+		if keys.AgeIdentities, err = age.ParseIdentities(in); err != nil {
+			return nil, fmt.Errorf("error reading the age identity file %s: %s", config.AgeIdentityFile, err)
+		}
+	}
+
+	if config.GPGKeyringFile != "" {
+		keyring, err := readKeyring(config.GPGKeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		if config.GPGPassphraseFile != "" {
+			passphrase, err := ioutil.ReadFile(config.GPGPassphraseFile)
+			if err != nil {
+				return nil, fmt.Errorf("error reading the OpenPGP passphrase file %s: %s", config.GPGPassphraseFile, err)
+			}
+			if err := unlock(keyring, bytes.TrimRight(passphrase, "\r\n")); err != nil {
+				return nil, err
+			}
+		}
+		keys.GPGKeyring = keyring
+	}
+
+	if config.SignersKeyringFile != "" {
+		signers, err := readKeyring(config.SignersKeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		keys.Signers = signers
+	}
+	return keys, nil
+}
+
+// readKeyring reads an OpenPGP keyring, armored or binary
+func readKeyring(keyringFile string) (openpgp.EntityList, error) {
+	content, err := ioutil.ReadFile(keyringFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the OpenPGP keyring %s: %s", keyringFile, err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the OpenPGP keyring %s: %s", keyringFile, err)
+	}
+	return keyring, nil
+}
+
+// unlock decrypts the protected private keys of the keyring with the passphrase
+func unlock(keyring openpgp.EntityList, passphrase []byte) error {
+	for _, entity := range keyring {
+		privateKeys := []*packet.PrivateKey{entity.PrivateKey}
+		for _, subkey := range entity.Subkeys {
+			privateKeys = append(privateKeys, subkey.PrivateKey)
+		}
+		for _, key := range privateKeys {
+			if key != nil && key.Encrypted {
+				if err := key.Decrypt(passphrase); err != nil {
+					return fmt.Errorf("error unlocking the OpenPGP key %s: %s", key.KeyIdShortString(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Decrypt verifies the signature of the encrypted file, if the keys have signers, and decrypts its
+// content in memory. The signature is waited for up to signatureWait, for the suppliers that place it
+// after the file. The content of files that are not encrypted is returned as it is
+func Decrypt(filePath string, content []byte, keys *Keys, signatureWait time.Duration) ([]byte, *Result, error) {
+	if !IsEncrypted(filePath) {
+		return content, nil, nil
+	}
+	result := &Result{}
+	if len(keys.Signers) > 0 {
+		signer, err := verifySignature(filePath, content, keys.Signers, signatureWait)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Signer = signer
+	}
+
+	var plain io.Reader
+	var err error
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case AgeSuffix:
+		result.Method = "age"
+		plain, err = decryptAge(content, keys.AgeIdentities)
+	case GPGSuffix:
+		result.Method = "gpg"
+		plain, err = decryptGPG(content, keys.GPGKeyring)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decrypting %s: %s", filepath.Base(filePath), err)
+	}
+	decrypted, err := ioutil.ReadAll(plain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decrypting %s: %s", filepath.Base(filePath), err)
+	}
+	return decrypted, result, nil
+}
+
+func decryptAge(content []byte, identities []age.Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identity is configured")
+	}
+	var in io.Reader = bytes.NewReader(content)
+	if bytes.HasPrefix(content, []byte(armor.Header)) {
+		in = armor.NewReader(in)
+	}
+	return age.Decrypt(in, identities...)
+}
+
+func decryptGPG(content []byte, keyring openpgp.EntityList) (io.Reader, error) {
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no OpenPGP keyring is configured")
+	}
+	message, err := openpgp.ReadMessage(dearmor(content), keyring, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return message.UnverifiedBody, nil
+}
+
+// signatureInterval is how often the signature is looked for while waiting for it
+var signatureInterval = time.Second
+
+// verifySignature checks the detached signature of the encrypted file against the allow-listed
+// keys, returning the identity of the signer
+func verifySignature(filePath string, content []byte, signers openpgp.EntityList, wait time.Duration) (string, error) {
+	deadline := time.Now().Add(wait)
+	signature, err := ioutil.ReadFile(filePath + SignatureSuffix)
+	for os.IsNotExist(err) && time.Now().Before(deadline) {
+		time.Sleep(signatureInterval)
+		signature, err = ioutil.ReadFile(filePath + SignatureSuffix)
+	}
+	if err != nil {
+		return "", fmt.Errorf("the signature %s of the encrypted file is required: %s", filepath.Base(filePath)+SignatureSuffix, err)
+	}
+	var signer *openpgp.Entity
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(signers, bytes.NewReader(content), bytes.NewReader(signature), nil)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(signers, bytes.NewReader(content), bytes.NewReader(signature), nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("the signature of %s is not valid or not made by an allow-listed key: %s", filepath.Base(filePath), err)
+	}
+	names := []string{}
+	for name := range signer.Identities {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return signer.PrimaryKey.KeyIdString(), nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// dearmor returns the binary content of an armored OpenPGP message, or the content as it is
+func dearmor(content []byte) io.Reader {
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("-----BEGIN")) {
+		if block, err := pgparmor.Decode(bytes.NewReader(content)); err == nil {
+			return block.Body
+		}
+	}
+	return bytes.NewReader(content)
+}
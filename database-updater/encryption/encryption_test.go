@@ -0,0 +1,130 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+const inventory = `{"inventory": [{"art_id": "1", "name": "leg", "stock": "12"}]}`
+
+// writeKeyring writes the keys of the entities to an armored keyring, the private or the public ones
+func writeKeyring(t *testing.T, keyringFile string, private bool, entities ...*openpgp.Entity) {
+	var buffer bytes.Buffer
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	w, err := armor.Encode(&buffer, blockType, nil)
+	assert.Nil(t, err)
+	for _, entity := range entities {
+		if private {
+			assert.Nil(t, entity.SerializePrivate(w, nil))
+		} else {
+			assert.Nil(t, entity.Serialize(w))
+		}
+	}
+	w.Close()
+	assert.Nil(t, ioutil.WriteFile(keyringFile, buffer.Bytes(), 0666))
+}
+
+func TestDecryptAge(t *testing.T) {
+	folder := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+	identityFile := filepath.Join(folder, "keys.txt")
+	ioutil.WriteFile(identityFile, []byte("# created by age-keygen\n"+identity.String()+"\n"), 0666)
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	assert.Nil(t, err)
+	w.Write([]byte(inventory))
+	w.Close()
+
+	keys, err := Load(Config{AgeIdentityFile: identityFile})
+	assert.Nil(t, err)
+	decrypted, result, err := Decrypt("article/inventory.json.age", encrypted.Bytes(), keys, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, inventory, string(decrypted))
+	assert.Equal(t, "age", result.Method)
+	assert.Equal(t, "article/inventory.json", PlainPath("article/inventory.json.age"))
+
+	// without identities, the file can't be read
+	_, _, err = Decrypt("article/inventory.json.age", encrypted.Bytes(), &Keys{}, 0)
+	assert.NotNil(t, err)
+
+	// the files not encrypted are returned as they are
+	decrypted, result, err = Decrypt("article/inventory.json", []byte(inventory), &Keys{}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+	assert.Equal(t, inventory, string(decrypted))
+}
+
+func TestDecryptGPGSigned(t *testing.T) {
+	folder := t.TempDir()
+	config := &packet.Config{DefaultHash: crypto.SHA256}
+	warehouse, err := openpgp.NewEntity("Warehouse", "", "warehouse@example.com", config)
+	assert.Nil(t, err)
+	supplier, err := openpgp.NewEntity("Acme", "", "acme@example.com", config)
+	assert.Nil(t, err)
+	stranger, err := openpgp.NewEntity("Stranger", "", "stranger@example.com", config)
+	assert.Nil(t, err)
+
+	keyringFile := filepath.Join(folder, "secring.asc")
+	writeKeyring(t, keyringFile, true, warehouse)
+	signersFile := filepath.Join(folder, "suppliers.asc")
+	writeKeyring(t, signersFile, false, supplier)
+
+	// the supplier encrypts the file to the warehouse key and signs the encrypted file
+	var encrypted bytes.Buffer
+	w, err := openpgp.Encrypt(&encrypted, openpgp.EntityList{warehouse}, nil, nil, config)
+	assert.Nil(t, err)
+	w.Write([]byte(inventory))
+	w.Close()
+	filePath := filepath.Join(folder, "inventory.json.gpg")
+	ioutil.WriteFile(filePath, encrypted.Bytes(), 0666)
+	var signature bytes.Buffer
+	assert.Nil(t, openpgp.ArmoredDetachSign(&signature, supplier, bytes.NewReader(encrypted.Bytes()), config))
+	ioutil.WriteFile(filePath+SignatureSuffix, signature.Bytes(), 0666)
+
+	keys, err := Load(Config{GPGKeyringFile: keyringFile, SignersKeyringFile: signersFile})
+	assert.Nil(t, err)
+	decrypted, result, err := Decrypt(filePath, encrypted.Bytes(), keys, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, inventory, string(decrypted))
+	assert.Equal(t, "gpg", result.Method)
+	assert.Equal(t, "Acme <acme@example.com>", result.Signer)
+
+	// a signature of a key out of the allow-list is rejected
+	signature.Reset()
+	openpgp.DetachSign(&signature, stranger, bytes.NewReader(encrypted.Bytes()), config)
+	ioutil.WriteFile(filePath+SignatureSuffix, signature.Bytes(), 0666)
+	_, _, err = Decrypt(filePath, encrypted.Bytes(), keys, 0)
+	assert.NotNil(t, err)
+
+	// and so is a file without signature
+	_, _, err = Decrypt(filepath.Join(folder, "products.json.gpg"), encrypted.Bytes(), keys, 0)
+	assert.NotNil(t, err)
+
+	// unless it arrives while the file waits for it
+	signatureInterval = 5 * time.Millisecond
+	defer func() { signatureInterval = time.Second }()
+	signature.Reset()
+	openpgp.DetachSign(&signature, supplier, bytes.NewReader(encrypted.Bytes()), config)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(folder, "products.json.gpg"+SignatureSuffix), signature.Bytes(), 0666)
+	}()
+	_, result, err = Decrypt(filepath.Join(folder, "products.json.gpg"), encrypted.Bytes(), keys, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme <acme@example.com>", result.Signer)
+}
@@ -1,4 +1,90 @@
 package globals
 
+import (
+	"database-autoupdater/encryption"
+	"database-autoupdater/mappings"
+	"database-autoupdater/money"
+	"database-autoupdater/units"
+	"database-autoupdater/warehouseclient"
+	"net/http"
+	"time"
+)
+
 var WarehouseArticleEndpoint string
 var WarehouseProductEndpoint string
+
+// WarehouseHTTPClient does the requests to the Warehouse API. If nil, one with the default timeout is used
+var WarehouseHTTPClient *http.Client
+
+// Warehouse returns the client of the Warehouse API at the configured endpoints
+func Warehouse() *warehouseclient.Client {
+	return warehouseclient.New(WarehouseArticleEndpoint, WarehouseProductEndpoint, WarehouseHTTPClient)
+}
+
+// PriceCurrency is the currency of the prices of the Warehouse. The incoming prices without currency code are in it
+var PriceCurrency = money.DefaultCurrency
+
+// PriceRounding is the rule the incoming prices are rounded with before they're written to the Warehouse
+var PriceRounding = money.DefaultRounding
+
+// SalesCurrencies are the currencies the Products are sold in. The Warehouse keeps a price of each
+// Product in all of them, converting the missing ones with the exchange rates. The PriceCurrency always is one
+var SalesCurrencies []money.Currency
+
+// ExchangeRatesFile is the path of the JSON file with the exchange rates the incoming prices in other
+// currencies are converted with. It's read again when some price is converted, so the rates can be updated
+// while running. If empty, there are no rates and the prices must be in the currencies they are written in
+var ExchangeRatesFile string
+
+// Units are the units of measure and pack sizes the incoming stock of the Articles can be in, loaded once at
+// startup from the units file. Without units file, the stock must be in the base unit (`piece`)
+var Units = units.UnitsOfMeasure{BaseUnit: units.DefaultBaseUnit}
+
+// Locations are the sites (warehouses) the stock of the Articles is kept at, like `stockholm`. When set, every
+// inventory, movement and order record must tell one of them. If empty, the records may tell any location or none,
+// and the records without a location change only the total stock of the Articles
+var Locations []string
+
+// IncomingDataFolder is the root folder where the incoming files of all domains are placed
+var IncomingDataFolder string
+
+// XLSXLayoutFile is the path of the JSON file that describes the sheets and
+// columns of the incoming .xlsx files. If empty, the default layout is used
+var XLSXLayoutFile string
+
+// Mappings are the field mappings of the supplier formats that don't follow the standard incoming
+// JSON, loaded and checked once at startup from the --mappingConfigFile. A change of the file needs a
+// restart. If empty, no mapping is applied
+var Mappings mappings.Config
+
+// ArticleFullSync enables the full-sync (mirror) mode for Articles: the Articles
+// absent from an inventory file are removed from the Warehouse after it's applied
+var ArticleFullSync bool
+
+// ProductFullSync enables the full-sync (mirror) mode for Products: the Products
+// absent from a products file are removed from the Warehouse after it's applied
+var ProductFullSync bool
+
+// FullSyncMaxRemovePercent is the maximum percentage of the items of the Warehouse that
+// a full-sync can remove. Above it, the file is not applied at all
+var FullSyncMaxRemovePercent float64
+
+// WatcherMode selects how the folders are watched: `auto` (default), `notify` or `poll`
+var WatcherMode string
+
+// PollInterval is how often the polling watchers list the folders
+var PollInterval time.Duration
+
+// PollFolders are the folders, relative to the incoming data folder, always watched by polling
+var PollFolders []string
+
+// ChecksumWait is how long an incoming file waits for its checksum (sidecar or manifest) to arrive and match
+var ChecksumWait time.Duration
+
+// RequireChecksum rejects the incoming files without checksum once the ChecksumWait is over
+var RequireChecksum bool
+
+// EncryptionKeys are the keys of the incoming encrypted files, loaded once at startup: the age identities
+// and the OpenPGP keyring to decrypt them and, when set, the public keys of the allow-listed suppliers
+// whose detached signature each encrypted file must have
+var EncryptionKeys = &encryption.Keys{}
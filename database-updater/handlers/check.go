@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"database-autoupdater/globals"
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+)
+
+// Domains are the kinds of incoming data files, named after their folders
+var Domains = []string{"article", "product", "movement", "order"}
+
+// Validate checks an incoming file of the domain without the Warehouse API: it must be decoded
+// (with the xlsx layout or the field mapping of its folder) and every record must be converted to the
+// Warehouse model like the handlers do before applying it. The file is not moved. An error is returned if
+// the file or some record is invalid, and the report tells the outcome of every record
+func Validate(filePath, domain string) (*reports.Report, error) {
+	report := newReport(filePath, domain)
+
+	file, err := decodeFile(filePath, domain)
+	if err != nil {
+		report.Finish(err)
+		return report, err
+	}
+	reasons := reasonsOf(validateRecords(file))
+	for i := 1; i <= file.count(); i++ {
+		if reason, ok := reasons[i]; ok {
+			report.Add(i, reports.RecordRejected, reason)
+			continue
+		}
+		report.Add(i, reports.RecordValid, "")
+	}
+
+	report.Finish(nil)
+	if rejected := len(report.Rejected()); rejected > 0 {
+		return report, fmt.Errorf("%d of %d records are invalid", rejected, file.count())
+	}
+	return report, nil
+}
+
+// Plan tells what ingesting the file would change in the Warehouse, without changing it. The file is
+// validated first, like Validate does, and then each record is checked against the current state of the
+// Warehouse. In full-sync mode, the report has the preview of the items that would be removed
+func Plan(filePath, domain string) (*reports.Report, error) {
+	report := newReport(filePath, domain)
+
+	file, err := decodeFile(filePath, domain)
+	if err != nil {
+		report.Finish(err)
+		return report, err
+	}
+
+	// like the handlers, an invalid record rejects the whole file, except for the order lines, which are
+	// fulfilled one by one
+	err = validateRecords(file)
+	if err != nil && domain != "order" {
+		rejectInvalid(report, file.count(), err)
+		report.Finish(nil)
+		return report, fmt.Errorf("%d of %d records are invalid", len(report.Rejected()), file.count())
+	}
+	reasons := reasonsOf(err)
+
+	// the full-sync is checked like the handlers do, before any record
+	switch domain {
+	case "article":
+		if isFullSync(filePath, domain) {
+			_, report.Sync, err = planArticleRemoval(file.inventory)
+		}
+	case "product":
+		if isFullSync(filePath, domain) {
+			_, report.Sync, err = planProductRemoval(file.products)
+		}
+	}
+	if err == nil && report.Sync != nil {
+		err = checkRemovalThreshold(report.Sync)
+	}
+	if err != nil {
+		report.Finish(err)
+		return report, err
+	}
+
+	// the Products are listed only if some order line references a Product by name
+	var products []model.ProductWarehouse
+	for i, record := range file.records() {
+		if reason, ok := reasons[i+1]; ok {
+			report.Add(i+1, reports.RecordRejected, reason)
+			continue
+		}
+		message, err := planRecord(record, &products)
+		if err != nil {
+			report.Add(i+1, reports.RecordRejected, err.Error())
+			continue
+		}
+		report.Add(i+1, reports.RecordPlanned, message)
+	}
+
+	report.Finish(nil)
+	if rejected := len(report.Rejected()); rejected > 0 {
+		return report, fmt.Errorf("%d of %d records would be rejected", rejected, file.count())
+	}
+	return report, nil
+}
+
+// decodedFile is an incoming file decoded as the records of its domain
+type decodedFile struct {
+	domain    string
+	inventory model.Inventory
+	products  model.IncomingProducts
+	movements model.Movements
+	orders    model.Orders
+}
+
+// decodeFile reads the incoming file of the domain, decrypting it if needed
+func decodeFile(filePath, domain string) (decodedFile, error) {
+	file := decodedFile{domain: domain}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return file, err
+	}
+	content, decodePath, err := decryptContent(filePath, content, nil)
+	if err != nil {
+		return file, err
+	}
+
+	switch domain {
+	case "article":
+		file.inventory, err = decodeInventory(decodePath, content)
+	case "product":
+		file.products, err = decodeProducts(decodePath, content)
+	case "movement":
+		file.movements, err = decodeMovements(decodePath, content)
+	case "order":
+		file.orders, err = decodeOrders(decodePath, content)
+	default:
+		err = fmt.Errorf("invalid domain %q. Must be one of: %s", domain, strings.Join(Domains, ", "))
+	}
+	return file, err
+}
+
+// records lists the records of the file, in order
+func (f decodedFile) records() []interface{} {
+	records := []interface{}{}
+	for _, a := range f.inventory.Inventory {
+		records = append(records, a)
+	}
+	for _, p := range f.products.Products {
+		records = append(records, p)
+	}
+	for _, m := range f.movements.Movements {
+		records = append(records, m)
+	}
+	for _, o := range f.orders.Orders {
+		records = append(records, o)
+	}
+	return records
+}
+
+func (f decodedFile) count() int {
+	return len(f.inventory.Inventory) + len(f.products.Products) + len(f.movements.Movements) + len(f.orders.Orders)
+}
+
+// validateRecords converts the records of the file with the converters of the handlers, without the
+// Warehouse API: the Articles of the Products are only checked to be valid identifications. The invalid
+// records are returned as RecordErrors
+func validateRecords(file decodedFile) error {
+	var err error
+	switch file.domain {
+	case "article":
+		_, err = convertArticles(file.inventory)
+	case "product":
+		_, err = convertProducts(file.products, anyArticleIDs)
+	case "movement":
+		_, err = convertMovements(file.movements)
+	case "order":
+		var recordErrors RecordErrors
+		for i, line := range file.orders.Orders {
+			if _, _, err := parseOrderLine(line); err != nil {
+				recordErrors = append(recordErrors, RecordError{Record: i + 1, Err: err})
+			}
+		}
+		if len(recordErrors) > 0 {
+			err = recordErrors
+		}
+	}
+	return err
+}
+
+// anyArticleIDs takes every valid identification of the Articles of the Product as an existing Article
+func anyArticleIDs(productIncoming model.ProductIncoming) (map[int64]int32, error) {
+	articleIDs := map[int64]int32{}
+	for _, articleIncoming := range productIncoming.ContainArticles {
+		if id, err := model.ParseIdentification("art_id", articleIncoming.ArtId); err == nil {
+			articleIDs[id] = 0
+		}
+	}
+	return articleIDs, nil
+}
+
+// planRecord tells what applying a valid record would change in the Warehouse
+func planRecord(record interface{}, products *[]model.ProductWarehouse) (string, error) {
+	switch r := record.(type) {
+	case model.ArticleIncoming:
+		id, _ := model.ParseIdentification("art_id", strings.TrimSpace(r.ArtId))
+		article, err := GetArticleByIdentification(id)
+		if err != nil {
+			return "", err
+		}
+		// the stock is planned as it would be written: in the base unit of the Article, at its location
+		stock, location := r.Stock, ""
+		if converted, err := model.ConvertArticleIncomingToWarehouse(r); err == nil {
+			stock, location = strconv.Itoa(int(converted.AvailableStock)), converted.Location
+		}
+		switch {
+		case r.Operation() == model.OperationDelete && article == nil:
+			return fmt.Sprintf("Article %d already absent", id), nil
+		case r.Operation() == model.OperationDelete:
+			return fmt.Sprintf("delete Article %d (%s)", id, article.Name), nil
+		case article == nil:
+			return fmt.Sprintf("create Article %d (%s) with stock %s%s", id, r.Name, stock, atLocation(location)), nil
+		default:
+			return fmt.Sprintf("update Article %d (%s): stock%s %d -> %s", id, r.Name, atLocation(location), stockAt(*article, location), stock), nil
+		}
+	case model.ProductIncoming:
+		product, err := FindProduct(strings.TrimSpace(r.Sku), r.Name)
+		if err != nil {
+			return "", err
+		}
+		// the price is planned as it would be written: exact, in the currency of the Warehouse and rounded
+		price, _, _ := model.ConvertPrices(r)
+		switch {
+		case r.Operation() == model.OperationDelete && product == nil:
+			return fmt.Sprintf("Product %q already absent", r.Name), nil
+		case r.Operation() == model.OperationDelete:
+			return fmt.Sprintf("delete Product %d (%s)", product.ID, product.Name), nil
+		case product == nil:
+			return fmt.Sprintf("create Product %q with price %s %s", r.Name, price, globals.PriceCurrency), nil
+		case product.Price.Equal(price):
+			return fmt.Sprintf("update Product %d (%s): price unchanged (%s %s)", product.ID, product.Name, product.Price, globals.PriceCurrency), nil
+		default:
+			return fmt.Sprintf("update Product %d (%s): price %s -> %s %s", product.ID, product.Name, product.Price, price, globals.PriceCurrency), nil
+		}
+	case model.ArticleMovementIncoming:
+		movement, err := model.ConvertArticleMovementIncomingToWarehouse(r)
+		if err != nil {
+			return "", err
+		}
+		article, err := GetArticleByIdentification(movement.Identification)
+		if err != nil {
+			return "", err
+		}
+		if article == nil {
+			return "", fmt.Errorf("Article %d not found", movement.Identification)
+		}
+		stock := stockAt(*article, movement.Location)
+		return fmt.Sprintf("stock of Article %d (%s)%s: %d -> %d", article.Identification, article.Name, atLocation(movement.Location), stock, stock+movement.Delta), nil
+	case model.OrderLineIncoming:
+		product, quantity, err := resolveOrderLine(r, products)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d of Product %q (%d available%s)", quantity, product.Name, product.QuantityAvailable, atLocation(product.Location)), nil
+	}
+	return "", fmt.Errorf("unknown record %T", record)
+}
+
+// stockAt is the stock of the Article at the location or, if empty, its total stock
+func stockAt(article model.ArticleWarehouse, location string) int32 {
+	if location == "" {
+		return article.AvailableStock
+	}
+	for _, s := range article.Stocks {
+		if s.Location == location {
+			return s.AvailableStock
+		}
+	}
+	return 0
+}
+
+// atLocation tells the location in the messages, if any
+func atLocation(location string) string {
+	if location == "" {
+		return ""
+	}
+	return " at " + location
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database-autoupdater/model"
+	"database-autoupdater/money"
+	"database-autoupdater/reports"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the sample files are valid
+	report, err := Validate("test-data/inventory.json", "article")
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusSuccess, report.Status)
+	report, err = Validate("test-data/products.json", "product")
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusSuccess, report.Status)
+
+	// each invalid record is reported, without the Warehouse API
+	ordersFile := fmt.Sprintf("%s/%s", incomingDataFolder, "orders.json")
+	ioutil.WriteFile(ordersFile, []byte(`{"orders": [
+		{"product": "Dining Chair", "quantity": "1"},
+		{"product": "", "quantity": "1"},
+		{"product": "2", "quantity": "-1"}
+	]}`), 0666)
+	report, err = Validate(ordersFile, "order")
+	assert.Equal(t, "2 of 3 records are invalid", err.Error())
+	assert.Equal(t, reports.StatusPartial, report.Status)
+	assert.Equal(t, "missing product", report.Records[1].Message)
+	assert.Equal(t, `invalid quantity "-1": must be an integer from 1 to 2147483647`, report.Records[2].Message)
+
+	// the file is not moved
+	_, err = os.Stat(ordersFile)
+	assert.Nil(t, err)
+
+	_, err = Validate(ordersFile, "foo")
+	assert.NotNil(t, err)
+
+	// the records are checked like ingest does: an Article written without name keeps its name
+	inventoryFile := fmt.Sprintf("%s/%s", incomingDataFolder, "inventory.json")
+	ioutil.WriteFile(inventoryFile, []byte(`{"inventory": [
+		{"art_id": "1", "stock": "3"},
+		{"op": "remove", "art_id": "1"}
+	]}`), 0666)
+	report, err = Validate(inventoryFile, "article")
+	assert.Equal(t, "1 of 2 records are invalid", err.Error())
+	assert.Equal(t, reports.RecordValid, report.Records[0].Status)
+	assert.Equal(t, "invalid op \"remove\": must be `upsert` or `delete`", report.Records[1].Message)
+}
+
+func TestPlan(t *testing.T) {
+	setup()
+	defer teardown()
+
+	warehouse := fakeWarehouse(t)
+	warehouse.AddArticle(1, "leg", 10)
+
+	inventoryFile := fmt.Sprintf("%s/%s", incomingDataFolder, "inventory.json")
+	ioutil.WriteFile(inventoryFile, []byte(`{"inventory": [
+		{"art_id": "1", "name": "leg", "stock": "12"},
+		{"op": "delete", "art_id": "1"}
+	]}`), 0666)
+
+	report, err := Plan(inventoryFile, "article")
+	assert.Nil(t, err)
+	assert.Equal(t, "update Article 1 (leg): stock 10 -> 12", report.Records[0].Message)
+	assert.Equal(t, "delete Article 1 (leg)", report.Records[1].Message)
+
+	// an invalid record rejects the whole file, like ingest does
+	ioutil.WriteFile(inventoryFile, []byte(`{"inventory": [
+		{"art_id": "1", "name": "leg", "stock": "12"},
+		{"art_id": "2", "name": "screw", "stock": "many"}
+	]}`), 0666)
+	report, err = Plan(inventoryFile, "article")
+	assert.Equal(t, "1 of 2 records are invalid", err.Error())
+	assert.Equal(t, reports.RecordSkipped, report.Records[0].Status)
+	assert.Equal(t, reports.RecordRejected, report.Records[1].Status)
+
+	// nothing was changed
+	assert.Equal(t, 0, warehouse.Requests("POST", ""))
+	assert.Equal(t, 0, warehouse.Requests("DELETE", ""))
+	assert.Equal(t, 1, len(warehouse.Articles()))
+}
+
+func TestPlanProductPrices(t *testing.T) {
+	setup()
+	defer teardown()
+
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 10)
+	warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair", Price: money.MustParseDecimal("43.51"), Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+	warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Table", Price: money.MustParseDecimal("99.99"), Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+
+	// the prices are compared exactly, so a price written with more digits is the same price
+	productsFile := fmt.Sprintf("%s/%s", incomingDataFolder, "products.json")
+	ioutil.WriteFile(productsFile, []byte(`{"products": [
+		{"name": "Dining Chair", "price": "43.510", "contain_articles": [{"art_id": "1", "amount_of": "4"}]},
+		{"name": "Dining Table", "price": "109.994 EUR", "contain_articles": [{"art_id": "1", "amount_of": "4"}]},
+		{"name": "Stool", "price": "19", "contain_articles": [{"art_id": "1", "amount_of": "3"}]}
+	]}`), 0666)
+
+	report, err := Plan(productsFile, "product")
+	assert.Nil(t, err)
+	assert.Equal(t, "update Product 2 (Dining Chair): price unchanged (43.51 EUR)", report.Records[0].Message)
+	assert.Equal(t, "update Product 3 (Dining Table): price 99.99 -> 109.99 EUR", report.Records[1].Message)
+	assert.Equal(t, `create Product "Stool" with price 19.00 EUR`, report.Records[2].Message)
+}
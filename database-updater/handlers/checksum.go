@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"database-autoupdater/checksums"
+	"database-autoupdater/globals"
+	"database-autoupdater/reports"
+)
+
+// verifyChecksum checks the incoming file against its sidecar or manifest checksum, if any, before it's
+// read. The outcome is added to the report, so a rejected file tells the checksum expected and the actual one
+func verifyChecksum(filePath string, report *reports.Report) error {
+	checksum, err := checksums.Verify(filePath, checksums.Options{Wait: globals.ChecksumWait, Required: globals.RequireChecksum})
+	if report != nil {
+		report.Checksum = checksum
+	}
+	return err
+}
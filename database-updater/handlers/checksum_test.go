@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"database-autoupdater/checksums"
+	"database-autoupdater/reports"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleArticleIncomingDataFileChecksumMismatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the sidecar tells the content of the complete file, but the file was truncated
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, inventoryFileName)
+	checksums.WriteSidecar(incomingFile, []byte(`{"inventory": [{"art_id": "1", "name": "leg", "stock": "12"}, {"art_id": "2", "name": "screw", "stock": "17"}]}`))
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [{"art_id": "1", "name": "leg", "st`), 0666)
+
+	err := HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.IsType(t, checksums.MismatchError{}, err)
+
+	report, err := reports.Read(processedPath(failProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusFail, report.Status)
+	assert.Equal(t, "inventory.json.sha256", report.Checksum.Source)
+	assert.NotEqual(t, report.Checksum.Expected, report.Checksum.Actual)
+}
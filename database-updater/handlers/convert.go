@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+)
+
+// RecordError tells which record of an incoming file couldn't be converted to the Warehouse model and why
+type RecordError struct {
+	// Record is the position of the record in the file, starting at 1
+	Record int
+	Err    error
+}
+
+func (e RecordError) Error() string {
+	return fmt.Sprintf("record #%d: %s", e.Record, e.Err)
+}
+
+func (e RecordError) Unwrap() error {
+	return e.Err
+}
+
+// RecordErrors holds all the records of a file that couldn't be converted, so
+// all of them can be reported at once instead of one at a time
+type RecordErrors []RecordError
+
+func (e RecordErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, re := range e {
+		msgs[i] = re.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// convertArticles converts the Articles to write before any of them is applied. The tombstone
+// records are only checked, so their Article is nil
+func convertArticles(inventory model.Inventory) ([]*model.ArticleWarehouse, error) {
+	converted := make([]*model.ArticleWarehouse, len(inventory.Inventory))
+	var recordErrors RecordErrors
+	for i, articleIncoming := range inventory.Inventory {
+		op, err := model.ParseOperation("op", articleIncoming.Op)
+		switch {
+		case err != nil:
+		case op == model.OperationDelete:
+			_, _, err = model.ConvertArticleDeletion(articleIncoming)
+		default:
+			converted[i], err = model.ConvertArticleIncomingToWarehouse(articleIncoming)
+		}
+		if err != nil {
+			recordErrors = append(recordErrors, RecordError{Record: i + 1, Err: err})
+		}
+	}
+	if len(recordErrors) > 0 {
+		return nil, recordErrors
+	}
+	return converted, nil
+}
+
+// convertProducts converts the Products to write before any of them is applied, with the IDs of their
+// Articles told by articleIDs. The tombstone records are only checked, so their Product is nil
+func convertProducts(products model.IncomingProducts, articleIDs func(model.ProductIncoming) (map[int64]int32, error)) ([]*model.ProductWarehouse, error) {
+	converted := make([]*model.ProductWarehouse, len(products.Products))
+	var recordErrors RecordErrors
+	for i, productIncoming := range products.Products {
+		op, err := model.ParseOperation("op", productIncoming.Op)
+		switch {
+		case err != nil:
+		case op == model.OperationDelete:
+			err = model.CheckProductDeletion(productIncoming)
+		default:
+			var ids map[int64]int32
+			if ids, err = articleIDs(productIncoming); err == nil {
+				converted[i], err = model.ConvertProductIncomingToWarehouse(productIncoming, ids)
+			}
+		}
+		if err != nil {
+			recordErrors = append(recordErrors, RecordError{Record: i + 1, Err: err})
+		}
+	}
+	if len(recordErrors) > 0 {
+		return nil, recordErrors
+	}
+	return converted, nil
+}
+
+// resolveArticleIDs finds the IDs of the Articles the Product is made of by their identification at
+// the Warehouse API. The identifications that are invalid or unknown are left out, so the conversion
+// of the Product tells about them
+func resolveArticleIDs(productIncoming model.ProductIncoming) (map[int64]int32, error) {
+	articleIDs := map[int64]int32{}
+	for _, articleIncoming := range productIncoming.ContainArticles {
+		id, err := model.ParseIdentification("art_id", articleIncoming.ArtId)
+		if err != nil {
+			continue
+		}
+		article, err := GetArticleByIdentification(id)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving the Article %d of the Product: %w", id, err)
+		}
+		if article != nil {
+			articleIDs[id] = article.ID
+		}
+	}
+	return articleIDs, nil
+}
+
+// convertMovements converts all the stock movements before any of them is sent
+func convertMovements(movements model.Movements) ([]model.ArticleMovementWarehouse, error) {
+	converted := []model.ArticleMovementWarehouse{}
+	var recordErrors RecordErrors
+	for i, movementIncoming := range movements.Movements {
+		movementWarehouse, err := model.ConvertArticleMovementIncomingToWarehouse(movementIncoming)
+		if err != nil {
+			recordErrors = append(recordErrors, RecordError{Record: i + 1, Err: err})
+			continue
+		}
+		converted = append(converted, *movementWarehouse)
+	}
+	if len(recordErrors) > 0 {
+		return nil, recordErrors
+	}
+	return converted, nil
+}
+
+// rejectInvalid registers the records of the RecordErrors as rejected, with their
+// reason, and the others, that weren't applied because of them, as skipped
+func rejectInvalid(report *reports.Report, total int, err error) {
+	reasons := reasonsOf(err)
+	for i := 1; i <= total; i++ {
+		if reason, ok := reasons[i]; ok {
+			report.Add(i, reports.RecordRejected, reason)
+			continue
+		}
+		report.Add(i, reports.RecordSkipped, "")
+	}
+}
+
+// reasonsOf returns why each record of the RecordErrors is invalid, by its position
+func reasonsOf(err error) map[int]string {
+	var recordErrors RecordErrors
+	errors.As(err, &recordErrors)
+	reasons := map[int]string{}
+	for _, re := range recordErrors {
+		reasons[re.Record] = re.Err.Error()
+	}
+	return reasons
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"database-autoupdater/encryption"
+	"database-autoupdater/globals"
+	"database-autoupdater/reports"
+)
+
+// decryptContent decrypts the content of an encrypted (.age or .gpg) file in memory, so it's never written in
+// clear, and returns it with the path to decode it as: the name without the extension of the encryption.
+// The signature, when required, is waited for like the checksum. The content of other files is returned as it is
+func decryptContent(filePath string, content []byte, report *reports.Report) ([]byte, string, error) {
+	if !encryption.IsEncrypted(filePath) {
+		return content, filePath, nil
+	}
+	decrypted, result, err := encryption.Decrypt(filePath, content, globals.EncryptionKeys, globals.ChecksumWait)
+	if err != nil {
+		return nil, filePath, err
+	}
+	if report != nil {
+		report.Encryption = result.Method
+		report.Signer = result.Signer
+	}
+	return decrypted, encryption.PlainPath(filePath), nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"bytes"
+	"database-autoupdater/encryption"
+	"database-autoupdater/globals"
+	"database-autoupdater/reports"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEncrypted(t *testing.T) {
+	setup()
+	defer teardown()
+
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+	globals.EncryptionKeys = &encryption.Keys{AgeIdentities: []age.Identity{identity}}
+	defer func() { globals.EncryptionKeys = &encryption.Keys{} }()
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	assert.Nil(t, err)
+	w.Write([]byte(`{"inventory": [{"art_id": "1", "name": "leg", "stock": "12"}]}`))
+	w.Close()
+
+	// the content is decrypted in memory and decoded as the JSON file it names
+	inventoryFile := fmt.Sprintf("%s/%s", incomingDataFolder, "inventory.json.age")
+	ioutil.WriteFile(inventoryFile, encrypted.Bytes(), 0666)
+	report, err := Validate(inventoryFile, "article")
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusSuccess, report.Status)
+	assert.Equal(t, 1, len(report.Records))
+
+	// without the identity, the file can't be read
+	globals.EncryptionKeys = &encryption.Keys{}
+	_, err = Validate(inventoryFile, "article")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/model"
+	"database-autoupdater/warehouseclient/warehousetest"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fuzzWarehouse starts a fake Warehouse API, with the Articles of the sample files, for the records
+// decoded by the fuzz targets to be applied
+func fuzzWarehouse(f *testing.F) *warehousetest.Server {
+	warehouse := warehousetest.NewServer()
+	f.Cleanup(warehouse.Close)
+	globals.WarehouseArticleEndpoint = warehouse.ArticleEndpoint()
+	globals.WarehouseProductEndpoint = warehouse.ProductEndpoint()
+	for i, name := range []string{"leg", "screw", "seat", "table top"} {
+		warehouse.AddArticle(int64(i+1), name, 10)
+	}
+	// the errors of the invalid records are expected, so they're not logged
+	logrus.SetLevel(logrus.PanicLevel)
+	f.Cleanup(func() { logrus.SetLevel(logrus.InfoLevel) })
+	return warehouse
+}
+
+// checkRecordErrors fails the fuzz target if the conversion error doesn't tell, for each record, which
+// field is invalid or which Article is unknown
+func checkRecordErrors(t *testing.T, err error) {
+	var recordErrors RecordErrors
+	if !errors.As(err, &recordErrors) {
+		t.Fatalf("the conversion error is not a RecordErrors: %v", err)
+	}
+	for _, re := range recordErrors {
+		var invalidField model.InvalidFieldError
+		var unknownArticle model.UnknownArticleError
+		if !errors.As(re, &invalidField) && !errors.As(re, &unknownArticle) {
+			t.Errorf("unexpected conversion error of record #%d: %v", re.Record, re.Err)
+		}
+	}
+}
+
+// FuzzDecodeInventory decodes any content as an inventory file and applies its Articles: invalid
+// content and records must be errors, never a crash. The sample files of test-data are its seed
+// corpus, at testdata/fuzz
+func FuzzDecodeInventory(f *testing.F) {
+	fuzzWarehouse(f)
+	f.Add([]byte(`{"inventory": [{"art_id": "one", "name": "leg", "stock": "12"}]}`))
+	f.Add([]byte(`{"inventory": [{"op": "delete", "art_id": "1", "force": "yes"}]}`))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		inventory, err := decodeInventory("inventory.json", content)
+		if err != nil {
+			return
+		}
+		validateRecords(decodedFile{domain: "article", inventory: inventory})
+		converted, err := convertArticles(inventory)
+		if err != nil {
+			checkRecordErrors(t, err)
+			return
+		}
+		for i, article := range inventory.Inventory {
+			applyArticle(article, converted[i])
+		}
+	})
+}
+
+// FuzzDecodeProducts decodes any content as a products file and applies its Products: invalid
+// content and records must be errors, never a crash
+func FuzzDecodeProducts(f *testing.F) {
+	fuzzWarehouse(f)
+	f.Add([]byte(`{"products": [{"name": "Chair", "price": "cheap", "contain_articles": []}]}`))
+	f.Add([]byte(`{"products": [{"name": "Chair", "price": "1", "contain_articles": [{"art_id": "99", "amount_of": "1"}]}]}`))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		products, err := decodeProducts("products.json", content)
+		if err != nil {
+			return
+		}
+		validateRecords(decodedFile{domain: "product", products: products})
+		converted, err := convertProducts(products, resolveArticleIDs)
+		if err != nil {
+			checkRecordErrors(t, err)
+			return
+		}
+		for i, product := range products.Products {
+			applyProduct(product, converted[i])
+		}
+	})
+}
+
+// FuzzDecodeMovements decodes any content as a stock movement file and converts its movements: invalid
+// content and records must be errors, never a crash
+func FuzzDecodeMovements(f *testing.F) {
+	fuzzWarehouse(f)
+	f.Add([]byte(`{"movements": [{"art_id": "1", "delta": "+5", "reason": "received"}]}`))
+	f.Add([]byte(`{"movements": [{"art_id": "1", "delta": "0", "reason": "lost"}]}`))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		movements, err := decodeMovements("movements.json", content)
+		if err != nil {
+			return
+		}
+		validateRecords(decodedFile{domain: "movement", movements: movements})
+		if _, err := convertMovements(movements); err != nil {
+			checkRecordErrors(t, err)
+		}
+	})
+}
@@ -2,28 +2,39 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"database-autoupdater/globals"
 	"database-autoupdater/model"
+	"database-autoupdater/readers"
+	"database-autoupdater/reports"
 
 	"github.com/sirupsen/logrus"
 )
 
-//HandleIncomingDataFile prepares an function to handle incoming data for a given domain
+// HandleIncomingDataFile prepares an function to handle incoming data for a given domain
 func HandleArticleIncomingDataFile(filePath, sucessfulFoder, failFolder string) error {
 	logrus.Debugf("Incoming data for a new Article. File name: %s", filePath)
 
-	// Resolve file name. Used to move from the folders
-	fileName := filepath.Base(filePath)
+	report := newReport(filePath, "article")
+
+	// verify the file against its checksum, if any, so truncated transfers are not ingested
+	if err := verifyChecksum(filePath, report); err != nil {
+		logrus.Errorf("Error verifying the checksum of incoming Article file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
 
 	// Open the received JSON File
 	jsonFile, err := os.Open(filePath)
 	if err != nil {
 		logrus.Errorf("Error opening incoming Article file. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		moveTo(filePath, failFolder)
 		return err
 	}
 
@@ -35,53 +46,96 @@ func HandleArticleIncomingDataFile(filePath, sucessfulFoder, failFolder string)
 	if err != nil {
 		logrus.Errorf("Error reading bytes of incoming Article file. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		writeReport(moveTo(filePath, failFolder), report, err)
 		return err
 	}
 
-	var inventory model.Inventory
-	// unmarshal byteArray into article
-	err = json.Unmarshal(byteValue, &inventory)
+	// decrypt the encrypted files in memory, with the configured keys
+	byteValue, decodePath, err := decryptContent(filePath, byteValue, report)
+	if err != nil {
+		logrus.Errorf("Error decrypting incoming Article file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decode the bytes into the inventory, based on the file format
+	inventory, err := decodeInventory(decodePath, byteValue)
 	if err != nil {
 		logrus.Errorf("Error unmarshalling bytes of incoming Article to correspondant var. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// convert all the Articles before writing any of them, so the invalid records are
+	// all reported at once and the file isn't partially applied
+	converted, err := convertArticles(inventory)
+	if err != nil {
+		logrus.Errorf("Error converting the Articles of incoming Article file. Moving to %s folder. Details: %s", failFolder, err)
+		rejectInvalid(report, len(inventory.Inventory), err)
+		writeReport(moveTo(filePath, failFolder), report, err)
 		return err
 	}
 
-	// convert the ArticleIncoming to ArticleWarehouse
+	// in full-sync mode, check what would be removed before changing anything
+	var articlesToRemove []model.ArticleWarehouse
+	if isFullSync(filePath, "article") {
+		defer lockFullSync("article")()
+		articlesToRemove, report.Sync, err = planArticleRemoval(inventory)
+		if err == nil {
+			err = checkRemovalThreshold(report.Sync)
+		}
+		if err != nil {
+			logrus.Errorf("Error preparing the full-sync of Articles. Moving to %s folder. Details: %s", failFolder, err)
+			writeReport(moveTo(filePath, failFolder), report, err)
+			return err
+		}
+	}
+
+	// write (or remove) each Article of the file
 	for i := 0; i < len(inventory.Inventory); i++ {
-		articleWarehouse := model.ConvertArticleIncomingToWarehouse(inventory.Inventory[i])
 		// Good candidate to run in a separate go routine of to put this in a queue
 		// but now, lets keep it sync and simple
-		// Create Article in the Warehouse API
-		err := PostArticle(*articleWarehouse)
+		message, err := applyArticle(inventory.Inventory[i], converted[i])
 		if err != nil {
 			// for now we will quit the full execution
-			logrus.Errorf("Error posting an Article to the Warehouse Database. Details: %s", err)
-			os.Rename(filePath, failFolder+"/"+fileName)
+			logrus.Errorf("Error applying an Article to the Warehouse Database. Details: %s", err)
+			rejectFrom(report, i+1, len(inventory.Inventory), err)
+			writeReport(moveTo(filePath, failFolder), report, err)
 			return err
 		}
+		report.Add(i+1, reports.RecordApplied, message)
+	}
+
+	// remove the Articles absent from the file
+	if report.Sync != nil {
+		removeArticles(articlesToRemove, report.Sync)
 	}
 
 	logrus.Debugf("New Article data succesfully ingested. Moving to %s folder", sucessfulFoder)
 
 	// move to sucess folder
-	os.Rename(filePath, sucessfulFoder+"/"+fileName)
+	writeReport(moveTo(filePath, sucessfulFoder), report, nil)
 	return nil
 }
 func HandleProductIncomingDataFile(filePath, sucessfulFoder, failFolder string) error {
 	logrus.Debugf("Incoming data for a new Product. File name: %s", filePath)
 
-	// Resolve file name. Used to move from the folders
-	fileName := filepath.Base(filePath)
+	report := newReport(filePath, "product")
+
+	// verify the file against its checksum, if any, so truncated transfers are not ingested
+	if err := verifyChecksum(filePath, report); err != nil {
+		logrus.Errorf("Error verifying the checksum of incoming Product file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
 
 	// Open the received JSON File
 	jsonFile, err := os.Open(filePath)
 	if err != nil {
 		logrus.Errorf("Error opening incoming Product file. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		moveTo(filePath, failFolder)
 		return err
 	}
 
@@ -93,38 +147,310 @@ func HandleProductIncomingDataFile(filePath, sucessfulFoder, failFolder string)
 	if err != nil {
 		logrus.Errorf("Error reading bytes of incoming Product file. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		writeReport(moveTo(filePath, failFolder), report, err)
 		return err
 	}
 
-	var products model.IncomingProducts
-	// unmarshal byteArray into product
-	err = json.Unmarshal(byteValue, &products)
+	// decrypt the encrypted files in memory, with the configured keys
+	byteValue, decodePath, err := decryptContent(filePath, byteValue, report)
+	if err != nil {
+		logrus.Errorf("Error decrypting incoming Product file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decode the bytes into the products, based on the file format
+	products, err := decodeProducts(decodePath, byteValue)
 	if err != nil {
 		logrus.Errorf("Error unmarshalling bytes of incoming Product array to correspondant var. Moving to %s folder. Details: %s", failFolder, err)
 		// move the file to the error folder
-		os.Rename(filePath, failFolder+"/"+fileName)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// convert all the Products before writing any of them, so the invalid records are
+	// all reported at once and the file isn't partially applied
+	converted, err := convertProducts(products, resolveArticleIDs)
+	if err != nil {
+		logrus.Errorf("Error converting the Products of incoming Product file. Moving to %s folder. Details: %s", failFolder, err)
+		rejectInvalid(report, len(products.Products), err)
+		writeReport(moveTo(filePath, failFolder), report, err)
 		return err
 	}
 
-	// convert the ProductIncoming to ArticleWarehouse
+	// in full-sync mode, check what would be removed before changing anything
+	var productsToRemove []model.ProductWarehouse
+	if isFullSync(filePath, "product") {
+		defer lockFullSync("product")()
+		productsToRemove, report.Sync, err = planProductRemoval(products)
+		if err == nil {
+			err = checkRemovalThreshold(report.Sync)
+		}
+		if err != nil {
+			logrus.Errorf("Error preparing the full-sync of Products. Moving to %s folder. Details: %s", failFolder, err)
+			writeReport(moveTo(filePath, failFolder), report, err)
+			return err
+		}
+	}
+
+	// write (or remove) each Product of the file
 	for i := 0; i < len(products.Products); i++ {
-		productWarehouse := model.ConvertProductIncomingToWarehouse(products.Products[i])
 		// Good candidate to run in a separate go routine of to put this in a queue
 		// but now, lets keep it sync and simple
-		// Create Product in the Warehouse API
-		err := PostProduct(*productWarehouse)
+		message, err := applyProduct(products.Products[i], converted[i])
 		if err != nil {
 			// for now we will quit the full execution
-			logrus.Errorf("Error posting an Product to the Warehouse Database. Details: %s", err)
-			os.Rename(filePath, failFolder+"/"+fileName)
+			logrus.Errorf("Error applying a Product to the Warehouse Database. Details: %s", err)
+			rejectFrom(report, i+1, len(products.Products), err)
+			writeReport(moveTo(filePath, failFolder), report, err)
 			return err
 		}
+		report.Add(i+1, reports.RecordApplied, message)
+	}
+
+	// remove the Products absent from the file
+	if report.Sync != nil {
+		removeProducts(productsToRemove, report.Sync)
 	}
 
 	logrus.Debugf("New Product data succesfully ingested. Moving to %s folder", sucessfulFoder)
 
 	// move to sucess folder
-	os.Rename(filePath, sucessfulFoder+"/"+fileName)
+	writeReport(moveTo(filePath, sucessfulFoder), report, nil)
+	return nil
+}
+
+// applyArticle creates the Article, already converted to the Warehouse model, in the Warehouse
+// or, for tombstone records (`delete` operation), removes it
+func applyArticle(articleIncoming model.ArticleIncoming, articleWarehouse *model.ArticleWarehouse) (string, error) {
+	switch articleIncoming.Operation() {
+	case model.OperationUpsert:
+		// Create Article in the Warehouse API
+		return "", PostArticle(*articleWarehouse)
+	case model.OperationDelete:
+		return deleteArticle(articleIncoming)
+	default:
+		return "", fmt.Errorf("invalid operation %q. Must be `upsert` or `delete`", articleIncoming.Op)
+	}
+}
+
+// applyProduct creates or updates the Product, already converted to the Warehouse model, in the
+// Warehouse or, for tombstone records (`delete` operation), removes it
+func applyProduct(productIncoming model.ProductIncoming, productWarehouse *model.ProductWarehouse) (string, error) {
+	switch productIncoming.Operation() {
+	case model.OperationUpsert:
+		// Create or update the Product in the Warehouse API
+		return "", UpsertProduct(*productWarehouse)
+	case model.OperationDelete:
+		return deleteProduct(productIncoming)
+	default:
+		return "", fmt.Errorf("invalid operation %q. Must be `upsert` or `delete`", productIncoming.Op)
+	}
+}
+
+// deleteArticle removes the Article of a tombstone record. Articles still used by
+// some Product are removed only if the record is forced
+func deleteArticle(articleIncoming model.ArticleIncoming) (string, error) {
+	id, force, err := model.ConvertArticleDeletion(articleIncoming)
+	if err != nil {
+		return "", err
+	}
+
+	article, err := GetArticleByIdentification(id)
+	if err != nil {
+		return "", err
+	}
+	if article == nil {
+		return fmt.Sprintf("Article %d already absent", id), nil
+	}
+	if err := DeleteArticle(article.ID, force); err != nil {
+		return "", fmt.Errorf("error deleting the Article %d: %s", id, err)
+	}
+	return fmt.Sprintf("Article %d deleted", id), nil
+}
+
+// deleteProduct removes the Product of a tombstone record, found by SKU or name
+func deleteProduct(productIncoming model.ProductIncoming) (string, error) {
+	product, err := FindProduct(strings.TrimSpace(productIncoming.Sku), productIncoming.Name)
+	if err != nil {
+		return "", err
+	}
+	if product == nil {
+		return fmt.Sprintf("Product %q already absent", productIncoming.Name), nil
+	}
+	if err := DeleteProduct(product.ID); err != nil {
+		return "", fmt.Errorf("error deleting the Product %q: %s", productIncoming.Name, err)
+	}
+	return fmt.Sprintf("Product %q deleted", productIncoming.Name), nil
+}
+
+// rejectFrom registers the record that stopped the processing of the file as
+// rejected and the records after it, that weren't processed, as skipped
+func rejectFrom(report *reports.Report, index, total int, err error) {
+	report.Add(index, reports.RecordRejected, err.Error())
+	for i := index + 1; i <= total; i++ {
+		report.Add(i, reports.RecordSkipped, "")
+	}
+}
+
+// HandleMovementIncomingDataFile handles the files with relative stock changes (movements) of Articles.
+// Each movement is sent with a key, so a movement of a replayed file isn't applied twice, and
+// the outcome of every movement is written to a report next to the processed file
+func HandleMovementIncomingDataFile(filePath, sucessfulFoder, failFolder string) error {
+	logrus.Debugf("Incoming data for new Article stock movements. File name: %s", filePath)
+
+	report := newReport(filePath, "movement")
+
+	// verify the file against its checksum, if any, so truncated transfers are not ingested
+	if err := verifyChecksum(filePath, report); err != nil {
+		logrus.Errorf("Error verifying the checksum of incoming stock movement file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// Open the received JSON File
+	jsonFile, err := os.Open(filePath)
+	if err != nil {
+		logrus.Errorf("Error opening incoming stock movement file. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		moveTo(filePath, failFolder)
+		return err
+	}
+
+	// defer the closing the file
+	defer jsonFile.Close()
+
+	// get the byte content of the file
+	byteValue, err := ioutil.ReadAll(jsonFile)
+	if err != nil {
+		logrus.Errorf("Error reading bytes of incoming stock movement file. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decrypt the encrypted files in memory, with the configured keys
+	byteValue, decodePath, err := decryptContent(filePath, byteValue, report)
+	if err != nil {
+		logrus.Errorf("Error decrypting incoming stock movement file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decode the bytes into the movements
+	movements, err := decodeMovements(decodePath, byteValue)
+	if err != nil {
+		logrus.Errorf("Error unmarshalling bytes of incoming stock movements to correspondant var. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// convert all the movements before sending any of them, so an invalid
+	// record doesn't leave the file partially applied
+	movementsWarehouse, err := convertMovements(movements)
+	if err != nil {
+		logrus.Errorf("Error converting the stock movements. Moving to %s folder. Details: %s", failFolder, err)
+		rejectInvalid(report, len(movements.Movements), err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// each movement changes the stock by itself, so a rejected one doesn't stop the others. The
+	// movements with `movement_id` are applied only once, even if received again
+	for i, movementWarehouse := range movementsWarehouse {
+		// Apply the movement in the Warehouse API
+		moved, err := PostArticleMovement(movementWarehouse)
+		if err != nil {
+			logrus.Errorf("Error posting an Article stock movement to the Warehouse Database. Details: %s", err)
+			report.Add(i+1, reports.RecordRejected, err.Error())
+			continue
+		}
+		if moved.AlreadyApplied {
+			report.Add(i+1, reports.RecordAlreadyApplied, fmt.Sprintf("movement %s already applied. Stock of Article %d: %d", movementWarehouse.Key, moved.Identification, moved.AvailableStock))
+			continue
+		}
+		report.Add(i+1, reports.RecordApplied, fmt.Sprintf("stock of Article %d: %d", moved.Identification, moved.AvailableStock))
+	}
+
+	rejected := report.Rejected()
+	if len(rejected) > 0 {
+		err := fmt.Errorf("%d of %d stock movements were rejected", len(rejected), len(movementsWarehouse))
+		logrus.Errorf("Error applying the stock movements. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, nil)
+		return err
+	}
+
+	logrus.Debugf("New stock movement data succesfully ingested. Moving to %s folder", sucessfulFoder)
+
+	// move to sucess folder
+	writeReport(moveTo(filePath, sucessfulFoder), report, nil)
 	return nil
 }
+
+// decodeInventory unmarshals the content of an incoming Article file. Excel
+// files (.xlsx) are read with the configured layout, JSON files of folders with a
+// field mapping are converted by it and any other file is read as standard JSON
+func decodeInventory(filePath string, content []byte) (model.Inventory, error) {
+	var inventory model.Inventory
+	if strings.EqualFold(filepath.Ext(filePath), ".xlsx") {
+		layout, err := readers.LoadLayout(globals.XLSXLayoutFile)
+		if err != nil {
+			return inventory, err
+		}
+		return readers.ReadInventory(content, layout.Article)
+	}
+	content, err := applyMapping(filePath, "article", content)
+	if err != nil {
+		return inventory, err
+	}
+	err = json.Unmarshal(content, &inventory)
+	return inventory, err
+}
+
+// decodeProducts unmarshals the content of an incoming Product file. Excel
+// files (.xlsx) are read with the configured layout, JSON files of folders with a
+// field mapping are converted by it and any other file is read as standard JSON
+func decodeProducts(filePath string, content []byte) (model.IncomingProducts, error) {
+	var products model.IncomingProducts
+	if strings.EqualFold(filepath.Ext(filePath), ".xlsx") {
+		layout, err := readers.LoadLayout(globals.XLSXLayoutFile)
+		if err != nil {
+			return products, err
+		}
+		return readers.ReadProducts(content, layout.Product)
+	}
+	content, err := applyMapping(filePath, "product", content)
+	if err != nil {
+		return products, err
+	}
+	err = json.Unmarshal(content, &products)
+	return products, err
+}
+
+// decodeMovements unmarshals the content of an incoming stock movement file. JSON
+// files of folders with a field mapping are converted by it and any other file is read as standard JSON
+func decodeMovements(filePath string, content []byte) (model.Movements, error) {
+	var movements model.Movements
+	content, err := applyMapping(filePath, "movement", content)
+	if err != nil {
+		return movements, err
+	}
+	err = json.Unmarshal(content, &movements)
+	return movements, err
+}
+
+// applyMapping converts the content of a supplier file to the standard incoming
+// JSON if there's a field mapping for the folder the file was placed in.
+// Otherwise the content is returned as it is
+func applyMapping(filePath, domain string, content []byte) ([]byte, error) {
+	mapping := globals.Mappings.ForFile(globals.IncomingDataFolder, filePath)
+	if mapping == nil {
+		return content, nil
+	}
+	if mapping.Domain != domain {
+		return nil, fmt.Errorf("the mapping of folder %q is for the %s domain and can't be used for %s files", mapping.Folder, mapping.Domain, domain)
+	}
+	logrus.Debugf("Applying the field mapping of folder %s to %s", mapping.Folder, filePath)
+	return mapping.Apply(content)
+}
@@ -3,8 +3,17 @@ package handlers
 import (
 	"database-autoupdater/globals"
 	"database-autoupdater/helpers"
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+	"database-autoupdater/units"
+	"database-autoupdater/warehouseclient/warehousetest"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,7 +22,6 @@ import (
 var baseTestFolder, incomingDataFolder, successProcessedFolder, failProcessedFolder, domain string
 
 func setup() error {
-	globals.WarehouseArticleEndpoint = "http://localhost:4000/article"
 	baseTestFolder = "test-folder"
 
 	domain = "foo"
@@ -45,12 +53,41 @@ func setup() error {
 
 	return nil
 }
+
+// processedPath finds the file received with the name at the processed folder, where it was moved
+// under a unique name. The last one processed is returned
+func processedPath(folder, fileName string) string {
+	ext := filepath.Ext(fileName)
+	matches, _ := filepath.Glob(filepath.Join(folder, strings.TrimSuffix(fileName, ext)+".*"+ext))
+	files := []string{}
+	for _, match := range matches {
+		if !reports.IsReport(match) {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	sort.Strings(files)
+	return files[len(files)-1]
+}
+
 func teardown() {
 	os.RemoveAll(baseTestFolder)
 }
 
+// fakeWarehouse starts a fake Warehouse API and points the handlers to it
+func fakeWarehouse(t *testing.T) *warehousetest.Server {
+	warehouse := warehousetest.NewServer()
+	t.Cleanup(warehouse.Close)
+	globals.WarehouseArticleEndpoint = warehouse.ArticleEndpoint()
+	globals.WarehouseProductEndpoint = warehouse.ProductEndpoint()
+	return warehouse
+}
+
 func TestHandleArticleIncomingDataFile(t *testing.T) {
 	setup()
+	warehouse := fakeWarehouse(t)
 
 	inventoryFileName := "inventory.json"
 	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, inventoryFileName)
@@ -71,19 +108,27 @@ func TestHandleArticleIncomingDataFile(t *testing.T) {
 		t.Fail()
 	}
 
-	f, err := os.Stat(successProcessedFolder + "/" + inventoryFileName)
+	f, err := os.Stat(processedPath(successProcessedFolder, inventoryFileName))
 	if err != nil {
 		t.Fail()
 	}
 
-	// check the file is in the success place
-	assert.Equal(t, f.Name(), inventoryFileName)
+	// check the file is in the success place, named after the received one
+	assert.True(t, strings.HasPrefix(f.Name(), "inventory."))
+
+	// the Articles of the file are at the Warehouse
+	assert.Equal(t, 4, len(warehouse.Articles()))
+	assert.Equal(t, int32(17), warehouse.Article(2).AvailableStock)
 
 	teardown()
 }
 
 func TestHandleProductIncomingDataFile(t *testing.T) {
 	setup()
+	warehouse := fakeWarehouse(t)
+	for i, name := range []string{"leg", "screw", "seat", "table top"} {
+		warehouse.AddArticle(int64(i+1), name, 10)
+	}
 
 	productsFileName := "products.json"
 	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, productsFileName)
@@ -104,13 +149,215 @@ func TestHandleProductIncomingDataFile(t *testing.T) {
 		t.Fail()
 	}
 
-	f, err := os.Stat(successProcessedFolder + "/" + productsFileName)
+	f, err := os.Stat(processedPath(successProcessedFolder, productsFileName))
 	if err != nil {
 		t.Fail()
 	}
 
-	// check the file is in the success place
-	assert.Equal(t, f.Name(), productsFileName)
+	// check the file is in the success place, named after the received one
+	assert.True(t, strings.HasPrefix(f.Name(), "products."))
+
+	// the Products of the file are at the Warehouse, made of the Articles with the identifications of the file
+	chair := warehouse.Product("Dining Chair")
+	assert.NotNil(t, chair)
+	// the price is exact, not the closest float32
+	assert.Equal(t, "43.51", chair.Price.String())
+	assert.Equal(t, "EUR", chair.Currency)
+	assert.Equal(t, []model.PriceWarehouse{{Currency: "EUR", Price: chair.Price}}, chair.Prices)
+	assert.Equal(t, warehouse.Article(3).ID, chair.Articles[2].ArticleID)
+	assert.Equal(t, 2, len(warehouse.Products()))
 
 	teardown()
 }
+
+func TestHandleArticleIncomingDataFileTombstone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Warehouse API with the Article 1, used by a Product, and the Article 2
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 0)
+	warehouse.AddArticle(2, "screw", 0)
+	warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair", Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+
+	// the Article 3 doesn't exist, so its removal is just reported
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, inventoryFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [
+		{"op": "delete", "art_id": "2"},
+		{"op": "delete", "art_id": "3"},
+		{"op": "delete", "art_id": "1", "force": "true"}
+	]}`), 0666)
+
+	err := HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warehouse.Articles()))
+	assert.Equal(t, 0, len(warehouse.Product("Dining Chair").Articles))
+
+	report, err := reports.Read(processedPath(successProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, "Article 2 deleted", report.Records[0].Message)
+	assert.Equal(t, "Article 3 already absent", report.Records[1].Message)
+	assert.Equal(t, "Article 1 deleted", report.Records[2].Message)
+
+	// without force, an Article used by some Product is kept and the file fails
+	leg = warehouse.AddArticle(1, "leg", 0)
+	warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Table", Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [{"op": "delete", "art_id": "1"}]}`), 0666)
+
+	err = HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(warehouse.Articles()))
+	_, err = os.Stat(processedPath(failProcessedFolder, inventoryFileName))
+	assert.Nil(t, err)
+
+	// the tombstones and the operations are checked before anything is applied
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [
+		{"art_id": "4", "name": "seat", "stock": "2"},
+		{"op": "delete", "art_id": "1", "force": "yes"},
+		{"op": "remove", "art_id": "1"}
+	]}`), 0666)
+	err = HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Equal(t, "record #2: invalid force \"yes\": must be `true` or `false`; record #3: invalid op \"remove\": must be `upsert` or `delete`", err.Error())
+	assert.Nil(t, warehouse.Article(4))
+}
+
+func TestHandleArticleIncomingDataFileInvalidRecord(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+
+	// all the Articles that can't be converted are rejected, with the reason, and nothing is applied
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, inventoryFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [
+		{"art_id": "one", "name": "leg", "stock": "12"},
+		{"art_id": "2", "name": "screw", "stock": "17"},
+		{"art_id": "3", "name": "seat", "stock": "lots"}
+	]}`), 0666)
+
+	err := HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	var recordErrors RecordErrors
+	assert.True(t, errors.As(err, &recordErrors))
+	assert.Equal(t, 2, len(recordErrors))
+	assert.Equal(t, 0, len(warehouse.Articles()))
+
+	report, err := reports.Read(processedPath(failProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusFail, report.Status)
+	assert.Equal(t, []reports.Record{
+		{Index: 1, Status: reports.RecordRejected, Message: `invalid art_id "one": must be an integer`},
+		{Index: 2, Status: reports.RecordSkipped},
+		{Index: 3, Status: reports.RecordRejected, Message: `invalid stock "lots": must be an integer`},
+	}, report.Records)
+}
+
+func TestHandleProductIncomingDataFileUnknownArticle(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+	warehouse.AddArticle(1, "leg", 12)
+
+	// a Product made of an Article that doesn't exist is rejected
+	productsFileName := "products.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, productsFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"products": [
+		{"name": "Dining Chair", "price": "43.51", "contain_articles": [{"art_id": "1", "amount_of": "4"}, {"art_id": "99", "amount_of": "1"}]}
+	]}`), 0666)
+
+	err := HandleProductIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	var recordErrors RecordErrors
+	assert.True(t, errors.As(err, &recordErrors))
+	assert.Equal(t, RecordErrors{{Record: 1, Err: model.UnknownArticleError{ArtId: "99"}}}, recordErrors)
+	assert.Equal(t, 0, len(warehouse.Products()))
+
+	report, err := reports.Read(processedPath(failProcessedFolder, productsFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, `Article with art_id "99" not found`, report.Records[0].Message)
+}
+
+func TestHandleArticleIncomingDataFileUnits(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+
+	unitsFile := baseTestFolder + "/units.json"
+	ioutil.WriteFile(unitsFile, []byte(`{"articles": {"2": {"packs": {"box": 100}}}}`), 0666)
+	loaded, err := units.Load(unitsFile)
+	assert.Nil(t, err)
+	globals.Units = loaded
+	defer func() { globals.Units, _ = units.Load("") }()
+
+	// the screws reported in boxes are posted as single screws, like the Products use them
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, inventoryFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [
+		{"art_id": "1", "name": "leg", "stock": "12"},
+		{"art_id": "2", "name": "screw", "stock": "3", "unit": "box"}
+	]}`), 0666)
+
+	err = HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(12), warehouse.Article(1).AvailableStock)
+	assert.Equal(t, int32(300), warehouse.Article(2).AvailableStock)
+
+	// a unit not declared for the Article rejects the record
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [{"art_id": "1", "name": "leg", "stock": "1", "unit": "box"}]}`), 0666)
+	err = HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(12), warehouse.Article(1).AvailableStock)
+
+	report, err := reports.Read(processedPath(failProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, `invalid unit "box": isn't a unit of the Article 1. Must be one of: piece`, report.Records[0].Message)
+}
+
+func TestHandleMovementIncomingDataFile(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+	warehouse.AddArticle(1, "leg", 12)
+
+	// the movement of an unknown Article is rejected and the others are applied
+	movementsFileName := "movements.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, movementsFileName)
+	content := []byte(`{"movements": [
+		{"art_id": "1", "delta": "+5", "reason": "received"},
+		{"art_id": "2", "delta": "+1", "reason": "received"},
+		{"art_id": "1", "delta": "-2", "reason": "damaged"}
+	]}`)
+	ioutil.WriteFile(incomingFile, content, 0666)
+
+	err := HandleMovementIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Equal(t, "1 of 3 stock movements were rejected", err.Error())
+	assert.Equal(t, int32(15), warehouse.Article(1).AvailableStock)
+
+	report, err := reports.Read(processedPath(failProcessedFolder, movementsFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusPartial, report.Status)
+	assert.Equal(t, reports.RecordApplied, report.Records[0].Status)
+	assert.Equal(t, "error POSTing stock movement to Warehouse API. Article with identification 2 not found", report.Records[1].Message)
+	assert.Equal(t, reports.RecordApplied, report.Records[2].Status)
+
+	// the same movements received again, like the next day, are new movements
+	ioutil.WriteFile(incomingFile, []byte(`{"movements": [{"art_id": "1", "delta": "+5", "reason": "received"}]}`), 0666)
+	err = HandleMovementIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(20), warehouse.Article(1).AvailableStock)
+
+	// unless they have the same `movement_id`: then they are applied only once
+	incomingFile = fmt.Sprintf("%s/%s", incomingDataFolder, "grn.json")
+	ioutil.WriteFile(incomingFile, []byte(`{"movements": [
+		{"movement_id": "GRN-1", "art_id": "1", "delta": "+5", "reason": "received"},
+		{"movement_id": "GRN-1", "art_id": "1", "delta": "+5", "reason": "received"}
+	]}`), 0666)
+	err = HandleMovementIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(25), warehouse.Article(1).AvailableStock)
+
+	report, err = reports.Read(processedPath(successProcessedFolder, "grn.json") + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.RecordApplied, report.Records[0].Status)
+	assert.Equal(t, reports.RecordAlreadyApplied, report.Records[1].Status)
+	assert.Equal(t, "movement GRN-1 already applied. Stock of Article 1: 25", report.Records[1].Message)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandleOrderIncomingDataFile handles the sales order files. Each order line consumes the stock
+// of the Articles of a Product. Lines with not enough stock are rejected and the others are
+// fulfilled. The outcome of every line is written to a report next to the processed file
+func HandleOrderIncomingDataFile(filePath, sucessfulFoder, failFolder string) error {
+	logrus.Debugf("Incoming data for new sales Orders. File name: %s", filePath)
+
+	report := newReport(filePath, "order")
+
+	// verify the file against its checksum, if any, so truncated transfers are not ingested
+	if err := verifyChecksum(filePath, report); err != nil {
+		logrus.Errorf("Error verifying the checksum of incoming Order file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// Open the received JSON File
+	jsonFile, err := os.Open(filePath)
+	if err != nil {
+		logrus.Errorf("Error opening incoming Order file. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		moveTo(filePath, failFolder)
+		return err
+	}
+
+	// defer the closing the file
+	defer jsonFile.Close()
+
+	// get the byte content of the file
+	byteValue, err := ioutil.ReadAll(jsonFile)
+	if err != nil {
+		logrus.Errorf("Error reading bytes of incoming Order file. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decrypt the encrypted files in memory, with the configured keys
+	byteValue, decodePath, err := decryptContent(filePath, byteValue, report)
+	if err != nil {
+		logrus.Errorf("Error decrypting incoming Order file. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// decode the bytes into the orders
+	orders, err := decodeOrders(decodePath, byteValue)
+	if err != nil {
+		logrus.Errorf("Error unmarshalling bytes of incoming Orders to correspondant var. Moving to %s folder. Details: %s", failFolder, err)
+		// move the file to the error folder
+		writeReport(moveTo(filePath, failFolder), report, err)
+		return err
+	}
+
+	// the Products are listed only if some line references a Product by name
+	var products []model.ProductWarehouse
+
+	for i, line := range orders.Orders {
+		index := i + 1
+
+		product, quantity, err := resolveOrderLine(line, &products)
+		if err != nil {
+			report.Add(index, reports.RecordRejected, err.Error())
+			continue
+		}
+
+		// consume the stock of the Articles of the Product, at the location of the line
+		err = PostStockUpdateByProduct(product.ID, quantity, product.Location)
+		if err != nil {
+			report.Add(index, reports.RecordRejected, fmt.Sprintf("error updating the stock of Product %q: %s", product.Name, err))
+			continue
+		}
+		report.Add(index, reports.RecordFulfilled, fmt.Sprintf("%d of Product %q", quantity, product.Name))
+	}
+
+	rejected := report.Rejected()
+	if len(rejected) > 0 {
+		err := fmt.Errorf("%d of %d order lines were rejected", len(rejected), len(orders.Orders))
+		logrus.Errorf("Error fulfilling sales Orders. Moving to %s folder. Details: %s", failFolder, err)
+		writeReport(moveTo(filePath, failFolder), report, nil)
+		return err
+	}
+
+	logrus.Debugf("New Order data succesfully ingested. Moving to %s folder", sucessfulFoder)
+
+	// move to sucess folder
+	writeReport(moveTo(filePath, sucessfulFoder), report, nil)
+	return nil
+}
+
+// resolveOrderLine finds the ordered Product, by ID or name, and checks whether there's enough stock at the
+// location of the line to make the quantity ordered. A number is taken as a name when no Product has that ID,
+// since a Product may be named like one. The Products are listed only if some line references a Product by
+// name. The Location of the returned Product is the one of the line
+func resolveOrderLine(line model.OrderLineIncoming, products *[]model.ProductWarehouse) (*model.ProductAvailabilityWarehouse, int32, error) {
+	quantity, location, err := parseOrderLine(line)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// resolve the Product by ID or, if there's none with that ID, by name
+	var product *model.ProductAvailabilityWarehouse
+	if id, err := strconv.ParseInt(strings.TrimSpace(line.Product), 10, 32); err == nil {
+		product, err = GetProductAvailability(int32(id), location)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error checking the availability of Product %d: %s", id, err)
+		}
+	}
+	if product == nil {
+		if *products == nil {
+			*products, err = GetProducts()
+			if err != nil {
+				return nil, 0, fmt.Errorf("error listing the Products to resolve %q: %s", line.Product, err)
+			}
+		}
+		productID, err := findProductByName(*products, line.Product)
+		if err != nil {
+			return nil, 0, err
+		}
+		product, err = GetProductAvailability(productID, location)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error checking the availability of Product %d: %s", productID, err)
+		}
+		if product == nil {
+			return nil, 0, fmt.Errorf("Product %q not found", line.Product)
+		}
+	}
+
+	// check whether there's enough stock to make the quantity of Products ordered
+	product.Location = location
+	if product.QuantityAvailable < quantity {
+		return nil, 0, fmt.Errorf("insufficient stock for Product %q%s: %d ordered and %d available", product.Name, atLocation(location), quantity, product.QuantityAvailable)
+	}
+	return product, quantity, nil
+}
+
+// parseOrderLine checks the values of the order line, returning the quantity ordered and its location
+func parseOrderLine(line model.OrderLineIncoming) (int32, string, error) {
+	if strings.TrimSpace(line.Product) == "" {
+		return 0, "", fmt.Errorf("missing product")
+	}
+	quantity, err := model.ParseQuantity("quantity", strings.TrimSpace(line.Quantity))
+	if err != nil {
+		return 0, "", err
+	}
+	location, err := model.ParseLocation("location", line.Location)
+	return quantity, location, err
+}
+
+// findProductByName returns the ID of the single Product with the name
+func findProductByName(products []model.ProductWarehouse, name string) (int32, error) {
+	found := []model.ProductWarehouse{}
+	for _, p := range products {
+		if strings.EqualFold(strings.TrimSpace(p.Name), strings.TrimSpace(name)) {
+			found = append(found, p)
+		}
+	}
+	if len(found) == 0 {
+		return 0, fmt.Errorf("Product %q not found", name)
+	}
+	if len(found) > 1 {
+		return 0, fmt.Errorf("Product %q is ambiguous: %d Products have this name. Use the Product ID instead", name, len(found))
+	}
+	return found[0].ID, nil
+}
+
+// decodeOrders unmarshals the content of an incoming sales order file. JSON files of
+// folders with a field mapping are converted by it and any other file is read as standard JSON
+func decodeOrders(filePath string, content []byte) (model.Orders, error) {
+	var orders model.Orders
+	content, err := applyMapping(filePath, "order", content)
+	if err != nil {
+		return orders, err
+	}
+	err = json.Unmarshal(content, &orders)
+	return orders, err
+}
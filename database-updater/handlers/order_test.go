@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleOrderIncomingDataFile(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Warehouse API with a chair that can be made twice and a table without stock
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 8)
+	top := warehouse.AddArticle(2, "table top", 0)
+	chair := warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair", Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+	table := warehouse.AddProduct(model.ProductWarehouse{Name: "Dinning Table", Articles: []model.ProductArticlesWarehouse{{ArticleID: top.ID, Quantity: 1}}})
+
+	ordersFileName := "orders.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, ordersFileName)
+	ioutil.WriteFile(incomingFile, []byte(fmt.Sprintf(`{"orders": [
+		{"product": "dining chair", "quantity": "1"},
+		{"product": "%[2]d", "quantity": "1"},
+		{"product": "%[1]d", "quantity": "2"},
+		{"product": "Sofa", "quantity": "1"},
+		{"product": "%[1]d", "quantity": "1"}
+	]}`, chair.ID, table.ID)), 0666)
+
+	err := HandleOrderIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Equal(t, "3 of 5 order lines were rejected", err.Error())
+
+	// the rejected lines didn't consume stock
+	assert.Equal(t, int32(0), warehouse.Article(1).AvailableStock)
+	assert.Equal(t, int32(0), warehouse.Article(2).AvailableStock)
+	assert.Equal(t, 2, warehouse.Requests("POST", "/article/stock-update/by/product"))
+
+	report, err := reports.Read(processedPath(failProcessedFolder, ordersFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusPartial, report.Status)
+	statuses := []string{}
+	for _, r := range report.Records {
+		statuses = append(statuses, r.Status)
+	}
+	assert.Equal(t, []string{reports.RecordFulfilled, reports.RecordRejected, reports.RecordRejected, reports.RecordRejected, reports.RecordFulfilled}, statuses)
+	assert.Equal(t, `insufficient stock for Product "Dining Chair": 2 ordered and 1 available`, report.Records[2].Message)
+	assert.Equal(t, `Product "Sofa" not found`, report.Records[3].Message)
+}
+
+func TestHandleOrderIncomingDataFileNumericName(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// a Product named like a number, which isn't the ID of any Product
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 8)
+	chair := warehouse.AddProduct(model.ProductWarehouse{Name: "1984", Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+	assert.NotEqual(t, int32(1984), chair.ID)
+
+	ordersFileName := "orders.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, ordersFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"orders": [{"product": "1984", "quantity": "1"}]}`), 0666)
+
+	err := HandleOrderIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), warehouse.Article(1).AvailableStock)
+}
+
+func TestHandleOrderIncomingDataFileLocations(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+	globals.Locations = []string{"stockholm", "malmo"}
+	defer func() { globals.Locations = nil }()
+
+	// the legs are kept at two sites: the stock of each one is the total of the Article
+	inventoryFile := fmt.Sprintf("%s/%s", incomingDataFolder, "inventory.json")
+	ioutil.WriteFile(inventoryFile, []byte(`{"inventory": [
+		{"art_id": "1", "name": "leg", "stock": "8", "location": "Stockholm"},
+		{"art_id": "1", "name": "leg", "stock": "4", "location": "malmo"}
+	]}`), 0666)
+	err := HandleArticleIncomingDataFile(inventoryFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(12), warehouse.Article(1).AvailableStock)
+	chair := warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair", Articles: []model.ProductArticlesWarehouse{{ArticleID: warehouse.Article(1).ID, Quantity: 4}}})
+
+	// each line is fulfilled with the stock of its site only
+	ordersFileName := "orders.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingDataFolder, ordersFileName)
+	ioutil.WriteFile(incomingFile, []byte(fmt.Sprintf(`{"orders": [
+		{"product": "%[1]d", "quantity": "1", "location": "malmo"},
+		{"product": "%[1]d", "quantity": "1", "location": "malmo"},
+		{"product": "%[1]d", "quantity": "2", "location": "stockholm"},
+		{"product": "%[1]d", "quantity": "1", "location": "oslo"}
+	]}`, chair.ID)), 0666)
+
+	err = HandleOrderIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Equal(t, "2 of 4 order lines were rejected", err.Error())
+	assert.Equal(t, int32(0), warehouse.Article(1).AvailableStock)
+
+	report, err := reports.Read(processedPath(failProcessedFolder, ordersFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.RecordFulfilled, report.Records[0].Status)
+	assert.Equal(t, `insufficient stock for Product "Dining Chair" at malmo: 1 ordered and 0 available`, report.Records[1].Message)
+	assert.Equal(t, reports.RecordFulfilled, report.Records[2].Status)
+	assert.Equal(t, `invalid location "oslo": must be one of: stockholm, malmo`, report.Records[3].Message)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"os"
+
+	"database-autoupdater/encryption"
+	"database-autoupdater/helpers"
+	"database-autoupdater/reports"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newReport creates the report of the file with the folder and supplier it was placed at
+func newReport(filePath, domain string) *reports.Report {
+	report := reports.New(filePath, domain)
+	source := SourceOf(filePath)
+	report.Folder = source.Folder
+	report.Supplier = source.Supplier
+	if source.Supplier != "" {
+		logrus.Debugf("File %s is from the supplier %s", filePath, source.Supplier)
+	}
+	return report
+}
+
+// moveTo moves the processed file to the folder under a unique name, so files received with the same
+// name are all kept, and returns where it was moved to. If the move fails, the file is left at the
+// incoming folder and an empty path is returned
+func moveTo(filePath, folder string) string {
+	processedPath, err := helpers.MoveFile(filePath, folder)
+	if err != nil {
+		logrus.Errorf("Error moving the file %s to %s folder. Details: %s", filePath, folder, err)
+		return ""
+	}
+	logrus.Infof("File %s moved to %s", filePath, processedPath)
+	// the detached signature of an encrypted file goes along with it, so it can be verified again when replayed
+	if _, err := os.Stat(filePath + encryption.SignatureSuffix); err == nil {
+		if err := os.Rename(filePath+encryption.SignatureSuffix, processedPath+encryption.SignatureSuffix); err != nil {
+			logrus.Errorf("Error moving the signature of %s. Details: %s", filePath, err)
+		}
+	}
+	return processedPath
+}
+
+// writeReport finishes the report and writes it next to the processed file. Without a processed
+// file (the move failed) the report is only logged, so it's not taken as data at the incoming folder
+func writeReport(processedPath string, report *reports.Report, err error) {
+	report.Finish(err)
+	if processedPath == "" {
+		logrus.Errorf("The processing report of %s was not written because the file couldn't be moved. Status: %s", report.File, report.Status)
+		return
+	}
+	report.Path = processedPath
+	reportPath, err := reports.Write(processedPath, report)
+	if err != nil {
+		logrus.Errorf("Error writing the processing report. Details: %s", err)
+		return
+	}
+	logrus.Debugf("Processing report written to %s", reportPath)
+}
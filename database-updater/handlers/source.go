@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+
+	"database-autoupdater/globals"
+)
+
+// Source tells where an incoming file was placed
+type Source struct {
+	// Folder is the folder of the file, relative to the incoming data folder. E.g.: `article/acme/2021-10-01`
+	Folder string
+	// Supplier is the subfolder of the domain folder where the file was placed (E.g.: `acme` for
+	// `article/acme/2021-10-01`) or, for folders with a field mapping out of the domain folders, the
+	// name of the mapping folder. Empty for the files placed directly at the domain folder
+	Supplier string
+}
+
+// SourceOf resolves the folder and supplier of an incoming file
+func SourceOf(filePath string) Source {
+	rel, err := filepath.Rel(globals.IncomingDataFolder, filepath.Dir(filePath))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return Source{}
+	}
+	source := Source{Folder: filepath.ToSlash(rel)}
+
+	segments := strings.Split(source.Folder, "/")
+	for _, domain := range Domains {
+		if segments[0] == domain {
+			if len(segments) > 1 {
+				source.Supplier = segments[1]
+			}
+			return source
+		}
+	}
+
+	if mapping := globals.Mappings.ForFile(globals.IncomingDataFolder, filePath); mapping != nil {
+		source.Supplier = filepath.Base(filepath.Clean(mapping.Folder))
+	}
+	return source
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"database-autoupdater/globals"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceOf(t *testing.T) {
+	globals.IncomingDataFolder = "incoming"
+
+	assert.Equal(t, Source{Folder: "article/acme/2021-10-01", Supplier: "acme"}, SourceOf("incoming/article/acme/2021-10-01/inventory.json"))
+	assert.Equal(t, Source{Folder: "article"}, SourceOf("incoming/article/inventory.json"))
+	assert.Equal(t, Source{}, SourceOf("elsewhere/inventory.json"))
+}
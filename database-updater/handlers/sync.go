@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/model"
+	"database-autoupdater/reports"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// isFullSync tells whether the file must be applied in full-sync (mirror) mode. The
+// mode is enabled by domain and applies only to files placed directly at the domain folder,
+// because the files of supplier subfolders don't have all the items of the Warehouse
+func isFullSync(filePath, domain string) bool {
+	enabled := (domain == "article" && globals.ArticleFullSync) || (domain == "product" && globals.ProductFullSync)
+	if !enabled {
+		return false
+	}
+	domainFolder := filepath.Clean(filepath.Join(globals.IncomingDataFolder, domain))
+	return filepath.Clean(filepath.Dir(filePath)) == domainFolder
+}
+
+// fullSyncs serializes the full-syncs of each domain. The files are handled concurrently, and the
+// full-sync of a file would remove the items another file just wrote
+var fullSyncs = map[string]*sync.Mutex{"article": {}, "product": {}}
+
+// lockFullSync waits until no other file of the domain is in full-sync and returns the unlock function.
+// It's held from the listing of the items of the Warehouse until the removal of the absent ones
+func lockFullSync(domain string) func() {
+	fullSyncs[domain].Lock()
+	return fullSyncs[domain].Unlock
+}
+
+// planArticleRemoval lists the Articles of the Warehouse that are absent from the inventory file
+func planArticleRemoval(inventory model.Inventory) ([]model.ArticleWarehouse, *reports.Sync, error) {
+	existing, err := GetArticles()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing the Articles for the full-sync: %s", err)
+	}
+
+	inFile := map[int64]bool{}
+	for _, a := range inventory.Inventory {
+		if id, err := strconv.ParseInt(strings.TrimSpace(a.ArtId), 10, 64); err == nil {
+			inFile[id] = true
+		}
+	}
+
+	toRemove := []model.ArticleWarehouse{}
+	sync := newSync(len(existing))
+	for _, a := range existing {
+		if !inFile[a.Identification] {
+			toRemove = append(toRemove, a)
+			sync.ToRemove = append(sync.ToRemove, describeArticle(a))
+		}
+	}
+	return toRemove, sync, nil
+}
+
+// planProductRemoval lists the Products of the Warehouse that are absent from the products file.
+// The Products are matched like UpsertProduct does: by SKU and, for the ones without SKU, by name
+func planProductRemoval(products model.IncomingProducts) ([]model.ProductWarehouse, *reports.Sync, error) {
+	existing, err := GetProducts()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing the Products for the full-sync: %s", err)
+	}
+
+	toRemove := []model.ProductWarehouse{}
+	sync := newSync(len(existing))
+	for _, e := range existing {
+		found := false
+		for _, p := range products.Products {
+			sku := strings.TrimSpace(p.Sku)
+			if (sku != "" && sku == e.Sku) || (p.Name == e.Name && (sku == "" || e.Sku == "")) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			toRemove = append(toRemove, e)
+			sync.ToRemove = append(sync.ToRemove, describeProduct(e))
+		}
+	}
+	return toRemove, sync, nil
+}
+
+// checkRemovalThreshold aborts the full-sync if more than the configured percentage
+// of the items of the Warehouse would be removed. That's usually a truncated or wrong file
+func checkRemovalThreshold(sync *reports.Sync) error {
+	if sync.Existing == 0 || len(sync.ToRemove) == 0 {
+		return nil
+	}
+	percent := float64(len(sync.ToRemove)) * 100 / float64(sync.Existing)
+	if percent > sync.MaxRemovePercent {
+		sync.Aborted = true
+		return fmt.Errorf("full-sync aborted: %d of %d items (%.1f%%) would be removed and the maximum is %.1f%%", len(sync.ToRemove), sync.Existing, percent, sync.MaxRemovePercent)
+	}
+	return nil
+}
+
+// removeArticles deletes the Articles absent from the file, registering the outcome in the sync report
+func removeArticles(articles []model.ArticleWarehouse, sync *reports.Sync) {
+	for _, a := range articles {
+		if err := DeleteArticle(a.ID, false); err != nil {
+			logrus.Warnf("Full-sync couldn't remove the Article %s. Details: %s", describeArticle(a), err)
+			sync.NotRemoved = append(sync.NotRemoved, fmt.Sprintf("%s: %s", describeArticle(a), err))
+			continue
+		}
+		sync.Removed = append(sync.Removed, describeArticle(a))
+	}
+}
+
+// removeProducts deletes the Products absent from the file, registering the outcome in the sync report
+func removeProducts(products []model.ProductWarehouse, sync *reports.Sync) {
+	for _, p := range products {
+		if err := DeleteProduct(p.ID); err != nil {
+			logrus.Warnf("Full-sync couldn't remove the Product %s. Details: %s", describeProduct(p), err)
+			sync.NotRemoved = append(sync.NotRemoved, fmt.Sprintf("%s: %s", describeProduct(p), err))
+			continue
+		}
+		sync.Removed = append(sync.Removed, describeProduct(p))
+	}
+}
+
+func newSync(existing int) *reports.Sync {
+	return &reports.Sync{
+		Existing:         existing,
+		MaxRemovePercent: globals.FullSyncMaxRemovePercent,
+		ToRemove:         []string{},
+		Removed:          []string{},
+		NotRemoved:       []string{},
+	}
+}
+
+func describeArticle(a model.ArticleWarehouse) string {
+	return fmt.Sprintf("%d (%s)", a.Identification, a.Name)
+}
+
+func describeProduct(p model.ProductWarehouse) string {
+	if p.Sku != "" {
+		return fmt.Sprintf("%s (%s)", p.Sku, p.Name)
+	}
+	return p.Name
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/helpers"
+	"database-autoupdater/reports"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleArticleIncomingDataFileFullSync(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the Warehouse has the 4 Articles of the file and a discontinued one
+	warehouse := fakeWarehouse(t)
+	for i := int64(1); i <= 5; i++ {
+		warehouse.AddArticle(i, fmt.Sprintf("article %d", i), 0)
+	}
+
+	globals.IncomingDataFolder = baseTestFolder + "/incoming"
+	globals.ArticleFullSync = true
+	globals.FullSyncMaxRemovePercent = 25
+	defer func() { globals.ArticleFullSync = false }()
+
+	// the full-sync applies only to the domain folder
+	incomingArticleFolder := globals.IncomingDataFolder + "/article"
+	os.MkdirAll(incomingArticleFolder, 0777)
+
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingArticleFolder, inventoryFileName)
+	_, err := helpers.CopyFile("test-data/"+inventoryFileName, incomingFile)
+	assert.Nil(t, err)
+
+	err = HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, warehouse.Requests("POST", "/article"))
+	assert.Equal(t, 4, len(warehouse.Articles()))
+	assert.Nil(t, warehouse.Article(5))
+
+	report, err := reports.Read(processedPath(successProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5 (article 5)"}, report.Sync.ToRemove)
+	assert.Equal(t, []string{"5 (article 5)"}, report.Sync.Removed)
+}
+
+func TestHandleArticleIncomingDataFileFullSyncAborted(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the Warehouse has many more Articles than the file
+	warehouse := fakeWarehouse(t)
+	for i := int64(1); i <= 20; i++ {
+		warehouse.AddArticle(i, fmt.Sprintf("article %d", i), 0)
+	}
+
+	globals.IncomingDataFolder = baseTestFolder + "/incoming"
+	globals.ArticleFullSync = true
+	globals.FullSyncMaxRemovePercent = 10
+	defer func() { globals.ArticleFullSync = false }()
+
+	incomingArticleFolder := globals.IncomingDataFolder + "/article"
+	os.MkdirAll(incomingArticleFolder, 0777)
+
+	inventoryFileName := "inventory.json"
+	incomingFile := fmt.Sprintf("%s/%s", incomingArticleFolder, inventoryFileName)
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [{"art_id": "1", "name": "leg", "stock": "12"}]}`), 0666)
+
+	err := HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	assert.NotNil(t, err)
+
+	// nothing was applied
+	assert.Equal(t, 0, warehouse.Requests("POST", "/article"))
+	assert.Equal(t, 20, len(warehouse.Articles()))
+
+	report, err := reports.Read(processedPath(failProcessedFolder, inventoryFileName) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.True(t, report.Sync.Aborted)
+	assert.Equal(t, 19, len(report.Sync.ToRemove))
+	assert.Equal(t, "full-sync aborted: 19 of 20 items (95.0%) would be removed and the maximum is 10.0%", report.Error)
+}
+
+func TestFullSyncOneAtATime(t *testing.T) {
+	setup()
+	defer teardown()
+	warehouse := fakeWarehouse(t)
+	warehouse.AddArticle(1, "leg", 12)
+
+	globals.IncomingDataFolder = baseTestFolder + "/incoming"
+	globals.ArticleFullSync = true
+	globals.FullSyncMaxRemovePercent = 100
+	defer func() { globals.ArticleFullSync = false }()
+	incomingArticleFolder := globals.IncomingDataFolder + "/article"
+	os.MkdirAll(incomingArticleFolder, 0777)
+	incomingFile := incomingArticleFolder + "/inventory.json"
+	ioutil.WriteFile(incomingFile, []byte(`{"inventory": [{"art_id": "2", "name": "screw", "stock": "17"}]}`), 0666)
+
+	// while the full-sync of another file is running, the file waits before listing the Articles
+	unlock := lockFullSync("article")
+	done := make(chan error)
+	go func() {
+		done <- HandleArticleIncomingDataFile(incomingFile, successProcessedFolder, failProcessedFolder)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, warehouse.Requests("GET", "/article"))
+	assert.Equal(t, 0, warehouse.Requests("POST", "/article"))
+
+	unlock()
+	assert.Nil(t, <-done)
+	assert.Nil(t, warehouse.Article(1))
+	assert.Equal(t, int32(17), warehouse.Article(2).AvailableStock)
+}
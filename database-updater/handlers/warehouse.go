@@ -1,90 +1,169 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"database-autoupdater/globals"
 	"database-autoupdater/model"
-	"encoding/json"
+	"database-autoupdater/warehouseclient"
+	"errors"
 	"fmt"
-	"net/http"
-	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 func PostArticle(article model.ArticleWarehouse) error {
+	logrus.Debugf("Posting new Article to Warehouse API. URL: %s", globals.WarehouseArticleEndpoint)
+	_, err := globals.Warehouse().CreateArticle(context.Background(), article)
+	return err
+}
+func PostProduct(product model.ProductWarehouse) error {
+	logrus.Debugf("Posting new Product to Warehouse API. URL: %s", globals.WarehouseProductEndpoint)
+	_, err := globals.Warehouse().CreateProduct(context.Background(), product)
+	return err
+}
 
-	url := globals.WarehouseArticleEndpoint
-	logrus.Debugf("Posting new Article to Warehouse API. URL: %s", url)
-
-	var httpClient = &http.Client{Timeout: 30 * time.Second}
-	payloadBuf := new(bytes.Buffer)
-	err := json.NewEncoder(payloadBuf).Encode(article)
-
-	if err != nil {
-		logrus.Errorf("Error encoding the request body to Post a new Article to Warehouse API. Details: %s", err)
-		return err
+// PostArticleMovement sends a relative stock change of an Article to the Warehouse API,
+// which increments the current stock instead of replacing it. A movement that would take the stock
+// below zero is refused. It returns the Article with the new stock, and whether the movement was
+// already applied before, by its key
+func PostArticleMovement(movement model.ArticleMovementWarehouse) (*model.MovedStockWarehouse, error) {
+	logrus.Debugf("Posting new Article stock movement to Warehouse API. URL: %s/stock-movement", globals.WarehouseArticleEndpoint)
+	article, err := globals.Warehouse().MoveArticleStock(context.Background(), movement)
+	if errors.Is(err, warehouseclient.ErrNotFound) {
+		return nil, fmt.Errorf("error POSTing stock movement to Warehouse API. Article with identification %d not found", movement.Identification)
 	}
-	req, err := http.NewRequest("POST", url, payloadBuf)
-	if err != nil {
-		logrus.Errorf("Error preparing the request to Post a new Article to Warehouse API. Details: %s", err)
-		return err
+	if errors.Is(err, warehouseclient.ErrConflict) {
+		return nil, fmt.Errorf("insufficient stock of Article %d%s for a movement of %d", movement.Identification, atLocation(movement.Location), movement.Delta)
 	}
-	req.Header.Add("Content-Type", "application/json")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		logrus.Errorf("Error doing the request to Post a new Article to Warehouse API. Details: %s", err)
-		return err
+	return article, err
+}
+
+// GetProducts fetches all the Products from Warehouse
+func GetProducts() ([]model.ProductWarehouse, error) {
+	logrus.Debugf("Getting all Products from Warehouse API. URL: %s", globals.WarehouseProductEndpoint)
+	return globals.Warehouse().ListProducts(context.Background(), warehouseclient.ProductFilter{})
+}
+
+// GetAvailability fetches all the Products with the quantity available from Warehouse,
+// with the stock at the location or, if empty, the total stock of all the locations
+func GetAvailability(location string) ([]model.ProductAvailabilityWarehouse, error) {
+	logrus.Debugf("Getting the availability of all Products at %q from Warehouse API", location)
+	return globals.Warehouse().ListAvailability(context.Background(), location)
+}
+
+// GetProductAvailability fetches a Product with the quantity available from Warehouse, with the
+// stock at the location or, if empty, the total stock. Returns nil if the Product doesn't exist
+func GetProductAvailability(id int32, location string) (*model.ProductAvailabilityWarehouse, error) {
+	logrus.Debugf("Getting the availability of Product %d at %q from Warehouse API", id, location)
+	product, err := globals.Warehouse().GetProduct(context.Background(), id, location)
+	if errors.Is(err, warehouseclient.ErrNotFound) {
+		return nil, nil
 	}
-	defer resp.Body.Close()
+	return product, err
+}
 
-	if resp.StatusCode > 299 {
-		return fmt.Errorf("error POSTing to Warehouse API. Status: %s", resp.Status)
+// PostStockUpdateByProduct reduces the stock of the Articles used to make
+// the given quantity of the Product, at the location if any
+func PostStockUpdateByProduct(productID int32, quantity int32, location string) error {
+	logrus.Debugf("Posting stock update by Product %d to Warehouse API", productID)
+	_, err := globals.Warehouse().UpdateStockByProduct(context.Background(), productID, quantity, location)
+	var stockUpdateErr *warehouseclient.StockUpdateError
+	if errors.As(err, &stockUpdateErr) {
+		return fmt.Errorf("error POSTing stock update to Warehouse API. Details: %s", stockUpdateErr.Message)
 	}
+	return err
+}
 
-	var jsonResp map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&jsonResp)
+// UpsertProduct creates the Product in Warehouse or, if it already exists, updates
+// its price and composition. The Product is found by its SKU and, when there's
+// no Product with the SKU yet, by its name, so re-ingesting a file doesn't duplicate Products
+func UpsertProduct(product model.ProductWarehouse) error {
+	existing, err := FindProduct(product.Sku, product.Name)
 	if err != nil {
-		logrus.Errorf("Error decoding the response of the Post a new Article to Warehouse API. Details: %s", err)
 		return err
 	}
-	return nil
+	if existing == nil {
+		return PostProduct(product)
+	}
+	logrus.Debugf("Product %q already exists with ID %d. Updating it", product.Name, existing.ID)
+	return PutProduct(existing.ID, product)
 }
-func PostProduct(product model.ProductWarehouse) error {
 
-	url := globals.WarehouseProductEndpoint
-	logrus.Debugf("Posting new Product to Warehouse API. URL: %s", url)
-
-	var httpClient = &http.Client{Timeout: 30 * time.Second}
-	payloadBuf := new(bytes.Buffer)
-	err := json.NewEncoder(payloadBuf).Encode(product)
+// FindProduct fetches the Product with the SKU from Warehouse. If the SKU is empty or no
+// Product has it, the Product with the name (and no SKU yet) is returned. Returns nil if not found
+func FindProduct(sku, name string) (*model.ProductWarehouse, error) {
+	if sku != "" {
+		products, err := globals.Warehouse().ListProducts(context.Background(), warehouseclient.ProductFilter{Sku: sku})
+		if err != nil {
+			return nil, err
+		}
+		if len(products) > 0 {
+			return &products[0], nil
+		}
+	}
 
+	products, err := globals.Warehouse().ListProducts(context.Background(), warehouseclient.ProductFilter{Name: name})
 	if err != nil {
-		logrus.Errorf("Error encoding the request body to Post a new Product to Warehouse API. Details: %s", err)
-		return err
+		return nil, err
 	}
-	req, err := http.NewRequest("POST", url, payloadBuf)
-	if err != nil {
-		logrus.Errorf("Error preparing the request to Post a new Product to Warehouse API. Details: %s", err)
-		return err
+	candidates := []model.ProductWarehouse{}
+	for _, p := range products {
+		// a Product with another SKU is another Product, even with the same name
+		if sku == "" || p.Sku == "" {
+			candidates = append(candidates, p)
+		}
 	}
-	req.Header.Add("Content-Type", "application/json")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		logrus.Errorf("Error doing the request to Post a new Product to Warehouse API. Details: %s", err)
-		return err
+	if len(candidates) == 0 {
+		return nil, nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode > 299 {
-		return fmt.Errorf("error POSTing to Warehouse API. Status: %s", resp.Status)
+	if len(candidates) > 1 {
+		logrus.Warnf("There are %d Products named %q. Using the oldest one (ID %d)", len(candidates), name, candidates[0].ID)
 	}
+	return &candidates[0], nil
+}
 
-	var jsonResp map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&jsonResp)
-	if err != nil {
-		logrus.Errorf("Error decoding the response of the Post a new Product to Warehouse API. Details: %s", err)
-		return err
+// PutProduct updates the price and composition of an existing Product in Warehouse
+func PutProduct(id int32, product model.ProductWarehouse) error {
+	logrus.Debugf("Updating Product %d in Warehouse API", id)
+	_, err := globals.Warehouse().UpdateProduct(context.Background(), id, product)
+	return err
+}
+
+// GetArticles fetches all the Articles from Warehouse
+func GetArticles() ([]model.ArticleWarehouse, error) {
+	logrus.Debugf("Getting all Articles from Warehouse API. URL: %s", globals.WarehouseArticleEndpoint)
+	return globals.Warehouse().ListArticles(context.Background(), warehouseclient.ArticleFilter{})
+}
+
+// GetArticleByIdentification fetches the Article with the identification of the incoming
+// files from Warehouse. Returns nil if not found
+func GetArticleByIdentification(id int64) (*model.ArticleWarehouse, error) {
+	logrus.Debugf("Getting an Article by identification %d from Warehouse API", id)
+	return globals.Warehouse().GetArticleByIdentification(context.Background(), id)
+}
+
+// DeleteArticle removes an Article from Warehouse. The Warehouse API refuses to remove
+// Articles that are still used by some Product, unless forced. When forced, the Article
+// is removed from the composition of these Products too
+func DeleteArticle(id int32, force bool) error {
+	logrus.Debugf("Deleting Article %d from Warehouse API", id)
+	return deleteResult(globals.Warehouse().DeleteArticle(context.Background(), id, force), "Article")
+}
+
+// DeleteProduct removes a Product from Warehouse
+func DeleteProduct(id int32) error {
+	logrus.Debugf("Deleting Product %d from Warehouse API", id)
+	return deleteResult(globals.Warehouse().DeleteProduct(context.Background(), id), "Product")
+}
+
+// deleteResult tells the outcome of a removal: an item that doesn't exist anymore is already removed
+func deleteResult(err error, kind string) error {
+	switch {
+	case errors.Is(err, warehouseclient.ErrConflict):
+		return fmt.Errorf("the %s is still used by some Product", kind)
+	case errors.Is(err, warehouseclient.ErrNotFound):
+		logrus.Debugf("The %s was already removed from Warehouse API", kind)
+		return nil
 	}
-	return nil
+	return err
 }
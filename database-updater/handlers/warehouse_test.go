@@ -1,23 +1,121 @@
 package handlers
 
 import (
-	"database-autoupdater/globals"
+	"context"
 	"database-autoupdater/model"
+	"database-autoupdater/money"
+	"database-autoupdater/warehouseclient"
+	"database-autoupdater/warehouseclient/warehousetest"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPostArticle(t *testing.T) {
-	globals.WarehouseArticleEndpoint = "http://localhost:4000/article"
+	warehouse := fakeWarehouse(t)
 	article := model.ArticleWarehouse{
 		Identification: 9999,
 		Name:           "Article Test",
 		AvailableStock: 22,
 	}
 	err := PostArticle(article)
-	if err != nil {
-		t.Fail()
-	}
+	assert.Nil(t, err)
+	assert.Equal(t, int32(22), warehouse.Article(9999).AvailableStock)
+
+	// the Warehouse API failing is an error
+	warehouse.Inject(warehousetest.Fault{Method: "POST", Path: "/article", Status: http.StatusInternalServerError, Times: 1})
+	err = PostArticle(article)
+	assert.NotNil(t, err)
 }
+
 func TestPostProduct(t *testing.T) {
-	// TO DO
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 12)
+	product := model.ProductWarehouse{
+		Name:     "Dining Chair",
+		Price:    money.MustParseDecimal("43.51"),
+		Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}},
+	}
+	err := PostProduct(product)
+	assert.Nil(t, err)
+
+	created, err := FindProduct("", "Dining Chair")
+	assert.Nil(t, err)
+	availability, err := GetProductAvailability(created.ID, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), availability.QuantityAvailable)
+
+	// a Product made of an Article that doesn't exist is refused
+	product.Name = "Dining Table"
+	product.Articles = []model.ProductArticlesWarehouse{{ArticleID: 99, Quantity: 1}}
+	err = PostProduct(product)
+	assert.NotNil(t, err)
+}
+
+func TestUpsertProduct(t *testing.T) {
+	// Warehouse API with a Product created before the SKU existed
+	warehouse := fakeWarehouse(t)
+	warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair"})
+
+	// the existing Product is found by name and gets the SKU
+	err := UpsertProduct(model.ProductWarehouse{Sku: "CHAIR-01", Name: "Dining Chair", Price: money.MustParseDecimal("43.51")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, warehouse.Requests("PUT", "/product"))
+	assert.Equal(t, 0, warehouse.Requests("POST", "/product"))
+
+	// from now on it's found by the SKU, even if renamed
+	err = UpsertProduct(model.ProductWarehouse{Sku: "CHAIR-01", Name: "Dining Chair Oak", Price: money.MustParseDecimal("45")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, warehouse.Requests("PUT", "/product"))
+	assert.Equal(t, 0, warehouse.Requests("POST", "/product"))
+	assert.Equal(t, "45", warehouse.Product("Dining Chair Oak").Price.String())
+
+	// a Product with another SKU is created, even with a known name
+	err = UpsertProduct(model.ProductWarehouse{Sku: "CHAIR-02", Name: "Dining Chair", Price: money.MustParseDecimal("43.51")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, warehouse.Requests("POST", "/product"))
+	assert.Equal(t, 2, len(warehouse.Products()))
+}
+
+func TestDeleteFromWarehouse(t *testing.T) {
+	warehouse := fakeWarehouse(t)
+	leg := warehouse.AddArticle(1, "leg", 12)
+	chair := warehouse.AddProduct(model.ProductWarehouse{Name: "Dining Chair", Articles: []model.ProductArticlesWarehouse{{ArticleID: leg.ID, Quantity: 4}}})
+
+	err := DeleteArticle(leg.ID, false)
+	assert.Equal(t, "the Article is still used by some Product", err.Error())
+
+	// an item already removed is not an error
+	assert.Nil(t, DeleteProduct(chair.ID))
+	assert.Nil(t, DeleteProduct(chair.ID))
+	assert.Nil(t, DeleteArticle(leg.ID, false))
+	assert.Equal(t, 0, len(warehouse.Articles()))
+}
+
+func TestWarehouseFaults(t *testing.T) {
+	warehouse := fakeWarehouse(t)
+	warehouse.AddArticle(1, "leg", 12)
+
+	// a Warehouse API that doesn't answer in time is an error, instead of blocking the updater
+	warehouse.Inject(warehousetest.Fault{Path: "/article", Latency: time.Second})
+	client := warehouseclient.New(warehouse.ArticleEndpoint(), warehouse.ProductEndpoint(), &http.Client{Timeout: 50 * time.Millisecond})
+	_, err := client.ListArticles(context.Background(), warehouseclient.ArticleFilter{})
+	assert.NotNil(t, err)
+	warehouse.ClearFaults()
+
+	// an unknown Article of a stock movement is reported with its identification
+	_, err = PostArticleMovement(model.ArticleMovementWarehouse{Identification: 2, Delta: 1, Reason: "received"})
+	assert.Equal(t, "error POSTing stock movement to Warehouse API. Article with identification 2 not found", err.Error())
+
+	article, err := PostArticleMovement(model.ArticleMovementWarehouse{Identification: 1, Delta: -2, Reason: "damaged"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(10), article.AvailableStock)
+	assert.Equal(t, int32(10), warehouse.Article(1).AvailableStock)
+
+	// a movement that would take the stock below zero is refused
+	_, err = PostArticleMovement(model.ArticleMovementWarehouse{Identification: 1, Delta: -11, Reason: "lost"})
+	assert.Equal(t, "insufficient stock of Article 1 for a movement of -11", err.Error())
+	assert.Equal(t, int32(10), warehouse.Article(1).AvailableStock)
 }
@@ -1,6 +1,17 @@
 package helpers
 
-import "os"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
 
 func CopyFile(in, out string) (int64, error) {
 	i, e := os.Open(in)
@@ -15,3 +26,95 @@ func CopyFile(in, out string) (int64, error) {
 	defer o.Close()
 	return o.ReadFrom(i)
 }
+
+// UniqueName names a processed file after the time it was processed and the hash of its content, so
+// files received with the same name don't overwrite each other at the success and fail folders. E.g.:
+// inventory.json processed at 2021-10-01 12:00:00 UTC is named inventory.20211001T120000Z.3fa2b1c49d0e.json
+func UniqueName(filePath string, at time.Time) string {
+	name := filepath.Base(filePath)
+	ext := filepath.Ext(name)
+	parts := []string{strings.TrimSuffix(name, ext), at.UTC().Format("20060102T150405Z")}
+	// without the content (e.g.: the file can't be read) the time is enough
+	if hash, err := HashFile(filePath); err == nil {
+		parts = append(parts, hash[:12])
+	}
+	return strings.Join(parts, ".") + ext
+}
+
+// MoveFile moves the file to the folder under a unique name and returns the path it was moved to. The
+// move is verified and, when the folder is at another device, the file is copied, synced and then removed
+func MoveFile(filePath, folder string) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	name := UniqueName(filePath, time.Now())
+	ext := filepath.Ext(name)
+	destination := filepath.Join(folder, name)
+	for i := 2; fileExists(destination); i++ {
+		destination = filepath.Join(folder, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+
+	err = os.Rename(filePath, destination)
+	var linkErr *os.LinkError
+	if err != nil && errors.As(err, &linkErr) && linkErr.Err == syscall.EXDEV {
+		err = copyAcross(filePath, destination)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	moved, err := os.Stat(destination)
+	if err != nil {
+		return "", fmt.Errorf("the file is not at %s after being moved: %s", destination, err)
+	}
+	if moved.Size() != info.Size() {
+		return "", fmt.Errorf("the file at %s has %d bytes after being moved, instead of %d", destination, moved.Size(), info.Size())
+	}
+	return destination, nil
+}
+
+// copyAcross moves the file to another device: the copy is synced to disk before the original is removed
+func copyAcross(filePath, destination string) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destination)
+		return fmt.Errorf("error copying the file to %s: %s", destination, err)
+	}
+	return os.Remove(filePath)
+}
+
+// HashFile computes the SHA-256 hash of the content of the file, hex encoded
+func HashFile(filePath string) (string, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
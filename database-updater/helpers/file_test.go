@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueName(t *testing.T) {
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "inventory.json")
+	ioutil.WriteFile(filePath, []byte(`{"inventory": []}`), 0666)
+
+	at := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Regexp(t, regexp.MustCompile(`^inventory\.20211001T120000Z\.[0-9a-f]{12}\.json$`), UniqueName(filePath, at))
+
+	// the name of a file that can't be read has only the time
+	assert.Equal(t, "orders.20211001T120000Z.json", UniqueName(filepath.Join(folder, "orders.json"), at))
+}
+
+func TestMoveFile(t *testing.T) {
+	baseFolder := t.TempDir()
+	incomingFolder := filepath.Join(baseFolder, "incoming")
+	successFolder := filepath.Join(baseFolder, "success")
+	os.MkdirAll(incomingFolder, 0777)
+	os.MkdirAll(successFolder, 0777)
+
+	// the same file received twice is kept twice
+	filePath := filepath.Join(incomingFolder, "inventory.json")
+	moved := []string{}
+	for i := 0; i < 2; i++ {
+		ioutil.WriteFile(filePath, []byte(`{"inventory": []}`), 0666)
+		processedPath, err := MoveFile(filePath, successFolder)
+		assert.Nil(t, err)
+		assert.Equal(t, successFolder, filepath.Dir(processedPath))
+		moved = append(moved, processedPath)
+	}
+	assert.NotEqual(t, moved[0], moved[1])
+	for _, processedPath := range moved {
+		content, err := ioutil.ReadFile(processedPath)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"inventory": []}`, string(content))
+	}
+	_, err := os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// a missing file is an error, not an empty move
+	_, err = MoveFile(filePath, successFolder)
+	assert.NotNil(t, err)
+}
@@ -1,99 +1,565 @@
 package main
 
 import (
+	"database-autoupdater/admin"
+	"database-autoupdater/encryption"
 	"database-autoupdater/globals"
 	"database-autoupdater/handlers"
+	"database-autoupdater/mappings"
+	"database-autoupdater/model"
+	"database-autoupdater/money"
+	"database-autoupdater/replay"
+	"database-autoupdater/reports"
+	"database-autoupdater/retention"
+	"database-autoupdater/units"
 	"database-autoupdater/watchers"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+var logLevel string
 var incomingDataFolder string
 var successProcessedFolder string
 var failProcessedFolder string
 var warehouseArticleEndpoint string
 var warehouseProductEndpoint string
+var xlsxLayoutFile string
+var mappingConfigFile string
+var articleFullSync bool
+var productFullSync bool
+var fullSyncMaxRemovePercent float64
+var adminAddress string
+var watcherMode string
+var pollInterval time.Duration
+var pollFolders string
+var archiveFolder string
+var archiveAfter time.Duration
+var retentionMaxAge time.Duration
+var retentionMaxSizeMB int64
+var retentionInterval time.Duration
+var checksumWait time.Duration
+var ageIdentityFile string
+var gpgKeyringFile string
+var gpgPassphraseFile string
+var signersKeyringFile string
+var requireChecksum bool
+var currency string
+var priceRounding string
+var priceScale int
+var salesCurrencies string
+var exchangeRatesFile string
+var unitsFile string
+var locations string
 
-func init() {
+// exit status of the commands
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
 
-	logrus.Infof("Starting file watcher database auto-updater")
+// command is a subcommand of the CLI, like `watch` or `ingest`
+type command struct {
+	name        string
+	args        string
+	description string
+}
 
-	//flags parse
-	logLevel := "info"
-	flag.StringVar(&logLevel, "logLevel", "info", "Log level")
-	flag.StringVar(&incomingDataFolder, "incomingDataFolder", "", "Folder where the products.json and inventory.json will be placed to get the read the data from")
-	flag.StringVar(&successProcessedFolder, "successProcessedFolder", "", "Folder where the products.json and inventory.json that were successly processed will be moved to")
-	flag.StringVar(&failProcessedFolder, "failProcessedFolder", "", "Folder where the products.json and inventory.json that has fail in the processing will be moved to")
-	flag.StringVar(&warehouseArticleEndpoint, "warehouseArticleEndpoint", "", "Endpoint of the Article Warehouse API. E.g.: http://localhost:4000/article")
-	flag.StringVar(&warehouseProductEndpoint, "warehouseProductEndpoint", "", "Endpoint of the Product Warehouse API. E.g.: http://localhost:4000/product")
-	flag.Parse()
+var commands = []command{
+	{"watch", "", "Watches the incoming folders and ingests the files placed there. It's the default command"},
+	{"ingest", "<file>", "Ingests a single file and exits. The exit status is 0 if the whole file was ingested and 1 otherwise"},
+	{"validate", "<file>", "Checks a file (format, layout or field mapping and values) without the Warehouse API"},
+	{"plan", "<file>", "Tells what ingesting a file would change in the Warehouse, without changing it"},
+	{"replay", "", "Moves failed files back to the incoming folder, so they are ingested again"},
+	{"availability", "", "Prints the quantity available of every Product, at a location or at all of them"},
+}
 
-	flagMessge := ""
+// runners run the commands with their arguments, returning the exit status
+var runners = map[string]func(args []string) int{
+	"watch":        runWatch,
+	"ingest":       runIngest,
+	"validate":     runValidate,
+	"plan":         runPlan,
+	"replay":       runReplay,
+	"availability": runAvailability,
+}
+
+// domainHandlers are the handlers of the files of each domain
+var domainHandlers = map[string]func(string, string, string) error{
+	"article":  handlers.HandleArticleIncomingDataFile,
+	"product":  handlers.HandleProductIncomingDataFile,
+	"movement": handlers.HandleMovementIncomingDataFile,
+	"order":    handlers.HandleOrderIncomingDataFile,
+}
+
+func main() {
+	args := os.Args[1:]
 
-	if incomingDataFolder == "" {
-		flagMessge += "--incomingDataFolder flag must be provided\n"
+	// without command (only flags, like the older versions) the incoming folders are watched
+	name := "watch"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	if successProcessedFolder == "" {
-		flagMessge += "--successProcessedFolder flag must be provided\n"
+	if name == "help" {
+		usage()
+		os.Exit(exitOK)
 	}
-	if failProcessedFolder == "" {
-		flagMessge += "--failProcessedFolder flag must be provided\n"
+	if run, ok := runners[name]; ok {
+		os.Exit(run(args))
 	}
-	if warehouseArticleEndpoint == "" {
-		flagMessge += "--warehouseArticleEndpoint flag must be provided\n"
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: database-autoupdater <command> [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.description)
 	}
-	if warehouseProductEndpoint == "" {
-		flagMessge += "--warehouseProductEndpoint flag must be provided\n"
+	fmt.Fprintf(os.Stderr, "\nUse \"database-autoupdater <command> --help\" for the flags of a command\n")
+}
+
+// newFlagSet creates the flag set of the command, with the usage message shared by all commands
+func newFlagSet(c string) *flag.FlagSet {
+	flags := flag.NewFlagSet(c, flag.ContinueOnError)
+	flags.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == c {
+				fmt.Fprintf(os.Stderr, "Usage: database-autoupdater %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.description)
+			}
+		}
+		flags.PrintDefaults()
 	}
+	flags.StringVar(&logLevel, "logLevel", "info", "Log level")
+	return flags
+}
 
-	if flagMessge != "" {
-		fmt.Println(flagMessge)
-		logrus.Exit(1)
+func folderFlags(flags *flag.FlagSet) {
+	flags.StringVar(&incomingDataFolder, "incomingDataFolder", "", "Folder where the products.json and inventory.json will be placed to get the read the data from")
+	flags.StringVar(&successProcessedFolder, "successProcessedFolder", "", "Folder where the products.json and inventory.json that were successly processed will be moved to")
+	flags.StringVar(&failProcessedFolder, "failProcessedFolder", "", "Folder where the products.json and inventory.json that has fail in the processing will be moved to")
+}
+
+func apiFlags(flags *flag.FlagSet) {
+	flags.StringVar(&warehouseArticleEndpoint, "warehouseArticleEndpoint", "", "Endpoint of the Article Warehouse API. E.g.: http://localhost:4000/article")
+	flags.StringVar(&warehouseProductEndpoint, "warehouseProductEndpoint", "", "Endpoint of the Product Warehouse API. E.g.: http://localhost:4000/product")
+}
+
+func ingestionFlags(flags *flag.FlagSet) {
+	flags.StringVar(&xlsxLayoutFile, "xlsxLayoutFile", "", "JSON file describing the sheet and columns of incoming .xlsx files. If not provided, the first sheet is read with the columns titled as the JSON fields (art_id, name, stock, price, amount_of)")
+	flags.StringVar(&mappingConfigFile, "mappingConfigFile", "", "JSON file with the field mappings of supplier formats that don't follow the standard incoming JSON, by folder")
+	flags.BoolVar(&articleFullSync, "articleFullSync", false, "Full-sync (mirror) mode for Articles: the Articles absent from an inventory file placed at the article folder are removed after the file is applied")
+	flags.BoolVar(&productFullSync, "productFullSync", false, "Full-sync (mirror) mode for Products: the Products absent from a products file placed at the product folder are removed after the file is applied")
+	flags.Float64Var(&fullSyncMaxRemovePercent, "fullSyncMaxRemovePercent", 10, "Maximum percentage of the Articles or Products that a full-sync can remove. Above it, the file is not applied and is moved to the fail folder")
+	flags.StringVar(&ageIdentityFile, "ageIdentityFile", "", "File with the age identities (like the output of age-keygen) used to decrypt the incoming .age files")
+	flags.StringVar(&gpgKeyringFile, "gpgKeyringFile", "", "OpenPGP secret keyring, armored or binary, used to decrypt the incoming .gpg files")
+	flags.StringVar(&gpgPassphraseFile, "gpgPassphraseFile", "", "File with the passphrase of the protected keys of the --gpgKeyringFile")
+	flags.StringVar(&currency, "currency", money.DefaultCurrency.Code, "ISO 4217 code of the currency of the prices of the Warehouse. The incoming prices without currency code (like 43.51 instead of 43.51 EUR) are in it")
+	flags.StringVar(&priceRounding, "priceRounding", string(money.DefaultRounding.Mode), "How the incoming prices are rounded (`mode`): half-up, half-even (bankers' rounding), down (truncated) or up")
+	flags.IntVar(&priceScale, "priceScale", money.DefaultRounding.Scale, "Digits after the point the incoming prices are rounded to. If negative, the minor units of the --currency (2 for EUR)")
+	flags.StringVar(&salesCurrencies, "salesCurrencies", "", "Comma separated ISO 4217 codes of the currencies the Products are sold in, besides the --currency. The Warehouse keeps a price of each Product in all of them. E.g.: SEK,NOK")
+	flags.StringVar(&exchangeRatesFile, "exchangeRatesFile", "", "JSON file with the exchange rates the incoming prices are converted with, like {\"base\": \"EUR\", \"rates\": {\"SEK\": \"11.4520\"}}. It's read again when some price is converted, so it can be updated while running")
+	flags.StringVar(&unitsFile, "unitsFile", "", "JSON file with the units of measure and pack sizes of the Articles, like {\"articles\": {\"2\": {\"packs\": {\"box\": 100}}}}. The incoming stock in them is converted to the base unit")
+	flags.StringVar(&locations, "locations", "", "Comma separated locations (sites) the stock of the Articles is kept at. When provided, every inventory, movement and order record must have one of them. E.g.: stockholm,malmo,gothenburg")
+	flags.StringVar(&signersKeyringFile, "signersKeyringFile", "", "OpenPGP public keyring of the allow-listed suppliers. If provided, the encrypted files must have a detached signature (.sig) made by one of its keys")
+}
+
+func checksumFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&checksumWait, "checksumWait", 0, "How long an incoming file waits for its checksum (a .sha256 sidecar or manifest) to arrive and match before it's processed. E.g.: 1m")
+	flags.BoolVar(&requireChecksum, "requireChecksum", false, "Reject the incoming files without checksum once the --checksumWait is over")
+}
+
+func retentionFlags(flags *flag.FlagSet) {
+	flags.StringVar(&archiveFolder, "archiveFolder", "", "Folder where the processed files are compressed into dated archives (success and fail subfolders). If not provided, the files are not archived")
+	flags.DurationVar(&archiveAfter, "archiveAfter", 24*time.Hour, "How long after being processed a file is archived")
+	flags.DurationVar(&retentionMaxAge, "retentionMaxAge", 0, "Processed files and archives older than it are removed. E.g.: 720h. If not provided, they are kept forever")
+	flags.Int64Var(&retentionMaxSizeMB, "retentionMaxSizeMB", 0, "Maximum size, in megabytes, of the success and of the fail folder, with their archives. Above it, the oldest are removed. If not provided, there's no limit")
+	flags.DurationVar(&retentionInterval, "retentionInterval", time.Hour, "How often the retention is applied")
+}
+
+// retentionOptions prepares the retention of the success and fail folders. The files of the
+// fail folder are never removed while their failure is unresolved
+func retentionOptions() []retention.Options {
+	options := []retention.Options{
+		{Folder: successProcessedFolder},
+		{Folder: failProcessedFolder, SuccessFolder: successProcessedFolder},
+	}
+	for i, subfolder := range []string{"success", "fail"} {
+		if archiveFolder != "" {
+			options[i].ArchiveFolder = filepath.Join(archiveFolder, subfolder)
+		}
+		options[i].ArchiveAfter = archiveAfter
+		options[i].MaxAge = retentionMaxAge
+		options[i].MaxSize = retentionMaxSizeMB * 1024 * 1024
 	}
+	return options
+}
 
-	if incomingDataFolder == successProcessedFolder || incomingDataFolder == failProcessedFolder || successProcessedFolder == failProcessedFolder {
-		flagMessge = "The --incomingDataFolder, --successProcessedFolder and  --failProcessedFolder must have different values and point to differente folders"
+// parse parses the flags of the command and checks that the required ones were provided. It returns
+// false if the command must not go on, with the exit status to use
+func parse(flags *flag.FlagSet, args []string, required ...string) (bool, int) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return false, exitOK
+		}
+		return false, exitUsage
+	}
+
+	flagMessge := ""
+	for _, name := range required {
+		if flags.Lookup(name).Value.String() == "" {
+			flagMessge += fmt.Sprintf("--%s flag must be provided\n", name)
+		}
 	}
 	if flagMessge != "" {
-		logrus.Error(flagMessge)
-		logrus.Exit(1)
+		fmt.Fprintln(os.Stderr, flagMessge)
+		flags.Usage()
+		return false, exitUsage
 	}
 
 	l, err := logrus.ParseLevel(logLevel)
 	if err != nil {
-		panic("Invalid loglevel")
+		fmt.Fprintf(os.Stderr, "Invalid log level %q\n", logLevel)
+		return false, exitUsage
 	}
 	logrus.SetLevel(l)
 
 	globals.WarehouseArticleEndpoint = warehouseArticleEndpoint
 	globals.WarehouseProductEndpoint = warehouseProductEndpoint
+	globals.XLSXLayoutFile = xlsxLayoutFile
+	globals.IncomingDataFolder = incomingDataFolder
+	globals.ArticleFullSync = articleFullSync
+	globals.ProductFullSync = productFullSync
+	globals.FullSyncMaxRemovePercent = fullSyncMaxRemovePercent
+	globals.ChecksumWait = checksumWait
+	globals.RequireChecksum = requireChecksum
 
-	logrus.Infof("logLevel = %s", logLevel)
-	logrus.Infof("incomingDataFolder = %s", incomingDataFolder)
-	logrus.Infof("successProcessedFolder = %s", successProcessedFolder)
-	logrus.Infof("failProcessedFolder = %s", failProcessedFolder)
-	logrus.Infof("warehouseArticleEndpoint = %s", warehouseArticleEndpoint)
-	logrus.Infof("warehouseProductEndpoint = %s", warehouseProductEndpoint)
+	// check the price rules now, so a wrong currency or rounding doesn't make every file fail later
+	if globals.PriceCurrency, err = money.ParseCurrency(currency); err != nil {
+		logrus.Errorf("Invalid --currency. %s", err)
+		return false, exitUsage
+	}
+	mode, err := money.ParseRoundingMode(priceRounding)
+	if err != nil {
+		logrus.Errorf("Invalid --priceRounding. %s", err)
+		return false, exitUsage
+	}
+	if priceScale > model.PriceScale {
+		logrus.Errorf("Invalid --priceScale %d. The Warehouse keeps at most %d digits after the point", priceScale, model.PriceScale)
+		return false, exitUsage
+	}
+	globals.PriceRounding = money.Rounding{Mode: mode, Scale: priceScale}
+	globals.SalesCurrencies = []money.Currency{}
+	for _, code := range strings.Split(salesCurrencies, ",") {
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+		salesCurrency, err := money.ParseCurrency(code)
+		if err != nil {
+			logrus.Errorf("Invalid --salesCurrencies. %s", err)
+			return false, exitUsage
+		}
+		globals.SalesCurrencies = append(globals.SalesCurrencies, salesCurrency)
+	}
+	if _, err := money.LoadExchangeRates(exchangeRatesFile); err != nil {
+		logrus.Error(err)
+		return false, exitUsage
+	}
+	globals.ExchangeRatesFile = exchangeRatesFile
+	// and the units of the Articles
+	if globals.Units, err = units.Load(unitsFile); err != nil {
+		logrus.Error(err)
+		return false, exitUsage
+	}
+	globals.Locations = []string{}
+	for _, location := range strings.Split(locations, ",") {
+		if location = strings.ToLower(strings.TrimSpace(location)); location != "" {
+			globals.Locations = append(globals.Locations, location)
+		}
+	}
 
-	//setup gin routes
-	logrus.Infof("Initialization completed")
+	// check the mapping config now, so a broken config doesn't make every file fail later
+	if globals.Mappings, err = mappings.Load(mappingConfigFile); err != nil {
+		logrus.Error(err)
+		return false, exitUsage
+	}
+	// and load the keys of the encrypted files once, for the same reason
+	if globals.EncryptionKeys, err = encryption.Load(encryption.Config{AgeIdentityFile: ageIdentityFile, GPGKeyringFile: gpgKeyringFile, GPGPassphraseFile: gpgPassphraseFile, SignersKeyringFile: signersKeyringFile}); err != nil {
+		logrus.Error(err)
+		return false, exitUsage
+	}
 
+	flags.VisitAll(func(f *flag.Flag) {
+		logrus.Infof("%s = %s", f.Name, f.Value.String())
+	})
+	return true, exitOK
 }
 
-func main() {
+// runWatch watches the incoming folders of all domains forever
+func runWatch(args []string) int {
+	flags := newFlagSet("watch")
+	folderFlags(flags)
+	apiFlags(flags)
+	ingestionFlags(flags)
+	checksumFlags(flags)
+	flags.StringVar(&adminAddress, "adminAddress", "", "Address of the admin HTTP endpoints, like the replay of failed files. E.g.: :4001. If not provided, the admin endpoints are disabled")
+	flags.StringVar(&watcherMode, "watcher", watchers.ModeAuto, "How the folders are watched (`mode`): auto uses polling on NFS, SMB, overlay and FUSE filesystems, where file events are unreliable, and filesystem events elsewhere; notify always uses filesystem events and poll always polls")
+	flags.DurationVar(&pollInterval, "pollInterval", watchers.DefaultPollInterval, "How often the folders watched by polling are listed")
+	flags.StringVar(&pollFolders, "pollFolders", "", "Comma separated folders, relative to the incoming data folder, that are always watched by polling. E.g.: article/acme,order")
+	retentionFlags(flags)
+	if ok, status := parse(flags, args, "incomingDataFolder", "successProcessedFolder", "failProcessedFolder", "warehouseArticleEndpoint", "warehouseProductEndpoint"); !ok {
+		return status
+	}
+	if watcherMode != watchers.ModeAuto && watcherMode != watchers.ModeNotify && watcherMode != watchers.ModePoll {
+		logrus.Errorf("Invalid --watcher %q. Must be `auto`, `notify` or `poll`", watcherMode)
+		return exitUsage
+	}
+	globals.WatcherMode = watcherMode
+	globals.PollInterval = pollInterval
+	globals.PollFolders = []string{}
+	for _, folder := range strings.Split(pollFolders, ",") {
+		if strings.TrimSpace(folder) != "" {
+			globals.PollFolders = append(globals.PollFolders, strings.TrimSpace(folder))
+		}
+	}
+
+	if incomingDataFolder == successProcessedFolder || incomingDataFolder == failProcessedFolder || successProcessedFolder == failProcessedFolder {
+		logrus.Error("The --incomingDataFolder, --successProcessedFolder and  --failProcessedFolder must have different values and point to differente folders")
+		return exitUsage
+	}
+	logrus.Infof("Starting file watcher database auto-updater")
+
 	done := make(chan string)
 
+	if adminAddress != "" {
+		go admin.Start(adminAddress, incomingDataFolder, failProcessedFolder)
+	}
+
+	// Start the retention of the success and fail folders
+	if archiveFolder != "" && (insideFolder(archiveFolder, incomingDataFolder) || insideFolder(archiveFolder, successProcessedFolder) || insideFolder(archiveFolder, failProcessedFolder)) {
+		logrus.Error("The --archiveFolder must be out of the --incomingDataFolder, --successProcessedFolder and --failProcessedFolder")
+		return exitUsage
+	}
+	if archiveFolder != "" || retentionMaxAge > 0 || retentionMaxSizeMB > 0 {
+		for _, options := range retentionOptions() {
+			go retention.Start(options, retentionInterval)
+		}
+		logrus.Info("Started the retention of the success and fail folders")
+	}
+
 	// Start a pipeline for Articles (Inventory)
-	articleDomain := "article"
-	go watchers.StartPipeline(fmt.Sprintf("%s/%s", incomingDataFolder, articleDomain), fmt.Sprintf("%s/%s", successProcessedFolder, articleDomain), fmt.Sprintf("%s/%s", failProcessedFolder, articleDomain), handlers.HandleArticleIncomingDataFile)
+	startPipeline("article", handlers.HandleArticleIncomingDataFile)
 	logrus.Info("Started data ingestion watcher for Articles")
 
 	// Start a pipeline for Products
-	productDomain := "product"
-	go watchers.StartPipeline(fmt.Sprintf("%s/%s", incomingDataFolder, productDomain), fmt.Sprintf("%s/%s", successProcessedFolder, productDomain), fmt.Sprintf("%s/%s", failProcessedFolder, productDomain), handlers.HandleProductIncomingDataFile)
+	startPipeline("product", handlers.HandleProductIncomingDataFile)
 	logrus.Info("Started data ingestion watcher for Products")
 
+	// Start a pipeline for Article stock movements (relative stock changes)
+	startPipeline("movement", handlers.HandleMovementIncomingDataFile)
+	logrus.Info("Started data ingestion watcher for Article stock movements")
+
+	// Start a pipeline for sales Orders, that consume the stock by Product
+	startPipeline("order", handlers.HandleOrderIncomingDataFile)
+	logrus.Info("Started data ingestion watcher for sales Orders")
+
+	// Start a pipeline for each supplier folder with a field mapping. The folders inside the domain
+	// folders, or inside another mapping folder, are already watched by their (recursive) pipeline
+	for _, m := range globals.Mappings.Mappings {
+		folder := strings.Trim(filepath.ToSlash(filepath.Clean(m.Folder)), "/")
+		if insidePipeline(folder, globals.Mappings) {
+			continue
+		}
+		startPipeline(folder, domainHandlers[m.Domain])
+		logrus.Infof("Started data ingestion watcher for the %s mapping of folder %s", m.Domain, folder)
+	}
+
 	<-done
+	return exitOK
+}
+
+// insideFolder tells whether the path is the folder or is inside it
+func insideFolder(path, folder string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// insidePipeline tells whether the folder is a domain folder or is inside a folder that has its own pipeline
+func insidePipeline(folder string, config mappings.Config) bool {
+	if _, ok := domainHandlers[strings.SplitN(folder, "/", 2)[0]]; ok {
+		return true
+	}
+	for _, m := range config.Mappings {
+		if strings.HasPrefix(folder, strings.Trim(filepath.ToSlash(filepath.Clean(m.Folder)), "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// startPipeline starts the watcher of the given folder, relative to the incoming, success and fail folders
+func startPipeline(folder string, handleIncomingData func(string, string, string) error) {
+	go watchers.StartPipeline(fmt.Sprintf("%s/%s", incomingDataFolder, folder), fmt.Sprintf("%s/%s", successProcessedFolder, folder), fmt.Sprintf("%s/%s", failProcessedFolder, folder), handleIncomingData)
+}
+
+// runIngest processes a single file synchronously with the handler of its domain, like the watcher does
+func runIngest(args []string) int {
+	flags := newFlagSet("ingest")
+	folderFlags(flags)
+	apiFlags(flags)
+	ingestionFlags(flags)
+	checksumFlags(flags)
+	domain := flags.String("domain", "", "Domain of the file: article, product, movement or order. If not provided, it's inferred from the folder of the file")
+	if ok, status := parse(flags, args, "successProcessedFolder", "failProcessedFolder", "warehouseArticleEndpoint", "warehouseProductEndpoint"); !ok {
+		return status
+	}
+	filePath, resolved, ok := fileAndDomain(flags, *domain)
+	if !ok {
+		return exitUsage
+	}
+
+	// the file is moved to the same subfolder of the success or fail folder it had at the incoming folder
+	folder := resolved
+	if rel, err := filepath.Rel(incomingDataFolder, filepath.Dir(filePath)); incomingDataFolder != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		folder = rel
+	}
+	successFolder := filepath.Join(successProcessedFolder, folder)
+	failFolder := filepath.Join(failProcessedFolder, folder)
+	os.MkdirAll(successFolder, 0777)
+	os.MkdirAll(failFolder, 0777)
+
+	if err := domainHandlers[resolved](filePath, successFolder, failFolder); err != nil {
+		logrus.Errorf("Error ingesting %s. Details: %s", filePath, err)
+		return exitFail
+	}
+	logrus.Infof("File %s ingested", filePath)
+	return exitOK
+}
+
+// runValidate checks a single file without the Warehouse API and prints its report
+func runValidate(args []string) int {
+	flags := newFlagSet("validate")
+	flags.StringVar(&incomingDataFolder, "incomingDataFolder", "", "Folder where the incoming files are placed. Used to find the field mapping and the domain of the file")
+	ingestionFlags(flags)
+	domain := flags.String("domain", "", "Domain of the file: article, product, movement or order. If not provided, it's inferred from the folder of the file")
+	if ok, status := parse(flags, args); !ok {
+		return status
+	}
+	filePath, resolved, ok := fileAndDomain(flags, *domain)
+	if !ok {
+		return exitUsage
+	}
+	return printReport(handlers.Validate(filePath, resolved))
+}
+
+// runPlan checks a single file against the Warehouse API and prints what would change
+func runPlan(args []string) int {
+	flags := newFlagSet("plan")
+	flags.StringVar(&incomingDataFolder, "incomingDataFolder", "", "Folder where the incoming files are placed. Used to find the field mapping and the domain of the file and to tell whether the full-sync applies")
+	apiFlags(flags)
+	ingestionFlags(flags)
+	domain := flags.String("domain", "", "Domain of the file: article, product, movement or order. If not provided, it's inferred from the folder of the file")
+	if ok, status := parse(flags, args, "warehouseArticleEndpoint", "warehouseProductEndpoint"); !ok {
+		return status
+	}
+	filePath, resolved, ok := fileAndDomain(flags, *domain)
+	if !ok {
+		return exitUsage
+	}
+	return printReport(handlers.Plan(filePath, resolved))
+}
+
+// runReplay moves the failed files selected by the command flags back to the incoming folder
+func runReplay(args []string) int {
+	flags := newFlagSet("replay")
+	folderFlags(flags)
+	flags.StringVar(&mappingConfigFile, "mappingConfigFile", "", "JSON file with the field mappings of supplier formats, used to find the records of the failed files")
+	options := replay.Options{}
+	flags.StringVar(&options.Domain, "domain", "", "Replay only the files of this domain: article, product, movement or order")
+	flags.DurationVar(&options.OlderThan, "olderThan", 0, "Replay only the files that failed at least this long ago. E.g.: 30m")
+	flags.DurationVar(&options.NewerThan, "newerThan", 0, "Replay only the files that failed at most this long ago. E.g.: 24h")
+	flags.StringVar(&options.ErrorContains, "errorContains", "", "Replay only the files whose error (or the error of some record) has this text. E.g.: connection refused")
+	flags.BoolVar(&options.OnlyFailedRecords, "onlyFailedRecords", false, "Replay only the records that were rejected or skipped according to the report of the file")
+	flags.BoolVar(&options.DryRun, "dryRun", false, "List the files that would be replayed without moving them")
+	if ok, status := parse(flags, args, "incomingDataFolder", "failProcessedFolder"); !ok {
+		return status
+	}
+	options.IncomingFolder = incomingDataFolder
+	options.FailFolder = failProcessedFolder
+
+	entries, err := replay.Run(options)
+	if err != nil {
+		logrus.Error(err)
+		return exitFail
+	}
+	output, _ := json.MarshalIndent(entries, "", "  ")
+	fmt.Fprintln(os.Stdout, string(output))
+	return exitOK
+}
+
+// runAvailability prints the Products with the quantity that can be made with the stock at the location
+func runAvailability(args []string) int {
+	flags := newFlagSet("availability")
+	apiFlags(flags)
+	location := flags.String("location", "", "Location (site) whose stock is used. If not provided, the total stock of all the locations is used")
+	if ok, status := parse(flags, args, "warehouseArticleEndpoint", "warehouseProductEndpoint"); !ok {
+		return status
+	}
+
+	products, err := handlers.GetAvailability(strings.ToLower(strings.TrimSpace(*location)))
+	if err != nil {
+		logrus.Error(err)
+		return exitFail
+	}
+	output, _ := json.MarshalIndent(products, "", "  ")
+	fmt.Fprintln(os.Stdout, string(output))
+	return exitOK
+}
+
+// fileAndDomain reads the file argument of the command and resolves its domain: the --domain flag,
+// the domain of the field mapping of its folder or the name of the domain folder it's placed in
+func fileAndDomain(flags *flag.FlagSet, domain string) (string, string, bool) {
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "A single file must be provided\n\n")
+		flags.Usage()
+		return "", "", false
+	}
+	filePath := flags.Arg(0)
+
+	if domain == "" && incomingDataFolder != "" {
+		if mapping := globals.Mappings.ForFile(incomingDataFolder, filePath); mapping != nil {
+			domain = mapping.Domain
+		}
+	}
+	if domain == "" {
+		for dir := filepath.Dir(filePath); domain == "" && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if _, ok := domainHandlers[filepath.Base(dir)]; ok {
+				domain = filepath.Base(dir)
+			}
+		}
+	}
+	if _, ok := domainHandlers[domain]; !ok {
+		fmt.Fprintf(os.Stderr, "The domain of the file %s can't be inferred. Use --domain with one of: %s\n", filePath, strings.Join(handlers.Domains, ", "))
+		return "", "", false
+	}
+	return filePath, domain, true
+}
+
+// printReport writes the report of the checked file to the standard output
+func printReport(report *reports.Report, err error) int {
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Fprintln(os.Stdout, string(output))
+	if err != nil {
+		logrus.Error(err)
+		return exitFail
+	}
+	return exitOK
 }
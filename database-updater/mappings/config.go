@@ -0,0 +1,165 @@
+package mappings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Config holds the field mappings of the supplier formats that don't follow
+// the standard incoming JSON layout
+type Config struct {
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping describes how to convert the files placed at Folder (relative to the
+// incoming data folder) into the standard incoming format of the Domain
+type Mapping struct {
+	// Folder is the path, relative to the incoming data folder, where the files
+	// of the supplier are placed. E.g.: `article/acme`. Files of subfolders use
+	// the same mapping, unless there is a mapping for the subfolder
+	Folder string `json:"folder"`
+	// Domain is the kind of data of the files: `article`, `product`, `movement` or `order`
+	Domain string `json:"domain"`
+	// Root is the path of the list of records in the source file. E.g.: `data.items`.
+	// If empty, the file itself must be a list
+	Root string `json:"root"`
+	// Fields maps the standard field name (E.g.: `art_id`) to where the value is in the source record
+	Fields map[string]Field `json:"fields"`
+}
+
+// Field describes where the value of a target field is in the source record
+// and the transformations applied to it
+type Field struct {
+	// Source is the path of the value in the source record. E.g.: `sku` or `details.sku`
+	Source     string      `json:"source"`
+	Transforms []Transform `json:"transforms"`
+	// Fields maps the elements of a list, like the Articles a Product is made of.
+	// When set, the Source must point to a list
+	Fields map[string]Field `json:"fields"`
+}
+
+// Transform is a simple transformation applied to a value. The supported operations are:
+//   - trim: removes leading and trailing spaces
+//   - default: uses Value when the source value is missing or empty
+//   - multiply: multiplies the numeric source value by Value
+//   - lookup: replaces the source value by the one in Table. If it is not there, Value is
+//     used as fallback and if Value is empty too, the record is rejected
+type Transform struct {
+	Op    string            `json:"op"`
+	Value string            `json:"value"`
+	Table map[string]string `json:"table"`
+}
+
+// rootKeys are the names of the list of records of the standard incoming files of each domain
+var rootKeys = map[string]string{
+	"article":  "inventory",
+	"product":  "products",
+	"movement": "movements",
+	"order":    "orders",
+}
+
+// Load reads the mapping configuration file. If no file is provided,
+// an empty configuration (no mappings) is returned
+func Load(configFile string) (Config, error) {
+	config := Config{}
+	if configFile == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return config, fmt.Errorf("error reading mapping config file: %s", err)
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("error parsing mapping config file: %s", err)
+	}
+	for i, m := range config.Mappings {
+		if m.Folder == "" {
+			return config, fmt.Errorf("mapping #%d has no folder", i+1)
+		}
+		if _, ok := rootKeys[m.Domain]; !ok {
+			return config, fmt.Errorf("mapping of folder %q has an invalid domain %q. Must be `article`, `product`, `movement` or `order`", m.Folder, m.Domain)
+		}
+		if err := checkTransforms(m.Fields); err != nil {
+			return config, fmt.Errorf("mapping of folder %q is invalid: %s", m.Folder, err)
+		}
+	}
+	if err := checkNesting(config.Mappings); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// checkNesting validates that the mapping folders inside a domain folder or inside another mapping
+// folder have the same domain, because their files are watched (recursively) by that folder
+func checkNesting(mappings []Mapping) error {
+	for _, m := range mappings {
+		folder := strings.Trim(filepath.ToSlash(filepath.Clean(m.Folder)), "/")
+		top := strings.SplitN(folder, "/", 2)[0]
+		if _, isDomain := rootKeys[top]; isDomain && top != m.Domain {
+			return fmt.Errorf("mapping of folder %q is for the %s domain, but it's inside the %s folder", m.Folder, m.Domain, top)
+		}
+		for _, other := range mappings {
+			otherFolder := strings.Trim(filepath.ToSlash(filepath.Clean(other.Folder)), "/")
+			if strings.HasPrefix(folder, otherFolder+"/") && other.Domain != m.Domain {
+				return fmt.Errorf("mapping of folder %q is for the %s domain, but it's inside the folder %q of the %s domain", m.Folder, m.Domain, other.Folder, other.Domain)
+			}
+		}
+	}
+	return nil
+}
+
+// ForFile finds the mapping of the folder where the file was placed. The mapping with
+// the longest folder that contains the file wins. Returns nil if there's no mapping for it
+func (c Config) ForFile(incomingDataFolder, filePath string) *Mapping {
+	rel, err := filepath.Rel(incomingDataFolder, filepath.Dir(filePath))
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	var found *Mapping
+	for i, m := range c.Mappings {
+		folder := strings.Trim(filepath.ToSlash(filepath.Clean(m.Folder)), "/")
+		if rel != folder && !strings.HasPrefix(rel, folder+"/") {
+			continue
+		}
+		if found == nil || len(folder) > len(strings.Trim(filepath.ToSlash(filepath.Clean(found.Folder)), "/")) {
+			found = &c.Mappings[i]
+		}
+	}
+	return found
+}
+
+// RecordsRoot is the path of the list of records of a file placed at the incoming data
+// folder: the Root of the mapping of its folder or, if there's no mapping, the list of the
+// standard incoming file of the domain
+func (c Config) RecordsRoot(incomingDataFolder, filePath, domain string) string {
+	if mapping := c.ForFile(incomingDataFolder, filePath); mapping != nil {
+		return mapping.Root
+	}
+	return rootKeys[domain]
+}
+
+// checkTransforms validates the operations of the transforms of all fields
+func checkTransforms(fields map[string]Field) error {
+	for name, f := range fields {
+		for _, t := range f.Transforms {
+			switch t.Op {
+			case "trim", "default", "lookup":
+			case "multiply":
+				if _, ok := parseNumber(t.Value); !ok {
+					return fmt.Errorf("field %q: invalid multiply value %q", name, t.Value)
+				}
+			default:
+				return fmt.Errorf("field %q: unknown transform %q", name, t.Op)
+			}
+		}
+		if err := checkTransforms(f.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
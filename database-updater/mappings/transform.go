@@ -0,0 +1,198 @@
+package mappings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// RecordError tells which record of the source file couldn't be mapped and why
+type RecordError struct {
+	Record  int
+	Field   string
+	Message string
+}
+
+func (e RecordError) Error() string {
+	return fmt.Sprintf("record #%d: field %s: %s", e.Record, e.Field, e.Message)
+}
+
+// RecordErrors holds all the problems found when mapping a file, so
+// all of them can be reported at once instead of one at a time
+type RecordErrors []RecordError
+
+func (e RecordErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, re := range e {
+		msgs[i] = re.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Apply converts the content of a supplier file into the standard incoming JSON
+// of the mapping domain (E.g.: `{"inventory": [{"art_id": ...}]}`), so it can be
+// decoded into the incoming model like any other file
+func (m Mapping) Apply(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// keep the numbers as they are written, to not lose precision
+	decoder.UseNumber()
+	var source interface{}
+	if err := decoder.Decode(&source); err != nil {
+		return nil, fmt.Errorf("error unmarshalling the source file: %s", err)
+	}
+
+	root, found := lookupPath(source, m.Root)
+	records, ok := root.([]interface{})
+	if !found || !ok {
+		return nil, fmt.Errorf("the root %q of the source file is not a list", m.Root)
+	}
+
+	var recordErrors RecordErrors
+	mapped := make([]interface{}, 0, len(records))
+	for i, record := range records {
+		target, errs := mapRecord(record, m.Fields, i+1, "")
+		recordErrors = append(recordErrors, errs...)
+		mapped = append(mapped, target)
+	}
+	if len(recordErrors) > 0 {
+		return nil, recordErrors
+	}
+
+	return json.Marshal(map[string]interface{}{rootKeys[m.Domain]: mapped})
+}
+
+// mapRecord builds the target record with the mapped fields. The values are
+// strings, like in the standard incoming files
+func mapRecord(record interface{}, fields map[string]Field, recordNumber int, prefix string) (map[string]interface{}, RecordErrors) {
+	var recordErrors RecordErrors
+	target := map[string]interface{}{}
+
+	// walk the fields sorted so the errors are always reported in the same order
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := fields[name]
+		value, found := lookupPath(record, field.Source)
+
+		// a field with nested fields maps a list of elements
+		if len(field.Fields) > 0 {
+			if !found || value == nil {
+				target[name] = []interface{}{}
+				continue
+			}
+			elements, ok := value.([]interface{})
+			if !ok {
+				recordErrors = append(recordErrors, RecordError{recordNumber, prefix + name, fmt.Sprintf("source %q is not a list", field.Source)})
+				continue
+			}
+			items := make([]interface{}, 0, len(elements))
+			for i, element := range elements {
+				item, errs := mapRecord(element, field.Fields, recordNumber, fmt.Sprintf("%s%s[%d].", prefix, name, i))
+				recordErrors = append(recordErrors, errs...)
+				items = append(items, item)
+			}
+			target[name] = items
+			continue
+		}
+
+		text := ""
+		if found && value != nil {
+			switch v := value.(type) {
+			case string:
+				text = v
+			case json.Number:
+				text = v.String()
+			case bool:
+				text = fmt.Sprintf("%t", v)
+			default:
+				recordErrors = append(recordErrors, RecordError{recordNumber, prefix + name, fmt.Sprintf("source %q is not a single value", field.Source)})
+				continue
+			}
+		}
+
+		transformed, err := applyTransforms(text, field.Transforms)
+		if err != nil {
+			recordErrors = append(recordErrors, RecordError{recordNumber, prefix + name, err.Error()})
+			continue
+		}
+		if transformed == "" && !found {
+			recordErrors = append(recordErrors, RecordError{recordNumber, prefix + name, fmt.Sprintf("source %q not found", field.Source)})
+			continue
+		}
+		target[name] = transformed
+	}
+	return target, recordErrors
+}
+
+// applyTransforms runs the transforms over the value, in the configured order
+func applyTransforms(value string, transforms []Transform) (string, error) {
+	for _, t := range transforms {
+		switch t.Op {
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "default":
+			if value == "" {
+				value = t.Value
+			}
+		case "multiply":
+			if value == "" {
+				continue
+			}
+			n, ok := parseNumber(value)
+			if !ok {
+				return "", fmt.Errorf("value %q is not a number to multiply", value)
+			}
+			factor, _ := parseNumber(t.Value)
+			value = formatNumber(n.Mul(n, factor))
+		case "lookup":
+			if v, ok := t.Table[value]; ok {
+				value = v
+			} else if t.Value != "" {
+				value = t.Value
+			} else {
+				return "", fmt.Errorf("value %q not found in the lookup table", value)
+			}
+		}
+	}
+	return value, nil
+}
+
+// lookupPath walks the source document by a dot separated path. An empty path returns the document itself
+func lookupPath(source interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return source, true
+	}
+	current := source
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// parseNumber parses a decimal number without losing precision
+func parseNumber(value string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(strings.TrimSpace(value))
+}
+
+// formatNumber formats the number without trailing zeros (E.g.: 250 and not 250.000)
+func formatNumber(n *big.Rat) string {
+	if n.IsInt() {
+		return n.Num().String()
+	}
+	text := n.FloatString(10)
+	return strings.TrimRight(strings.TrimRight(text, "0"), ".")
+}
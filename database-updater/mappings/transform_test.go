@@ -0,0 +1,106 @@
+package mappings_test
+
+import (
+	"database-autoupdater/mappings"
+	"database-autoupdater/model"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyArticleMapping(t *testing.T) {
+	mapping := mappings.Mapping{
+		Folder: "article/acme",
+		Domain: "article",
+		Root:   "data.items",
+		Fields: map[string]mappings.Field{
+			"art_id": {Source: "sku", Transforms: []mappings.Transform{{Op: "trim"}, {Op: "lookup", Table: map[string]string{"LEG-01": "1", "SCR-02": "2"}}}},
+			"name":   {Source: "description", Transforms: []mappings.Transform{{Op: "trim"}}},
+			"stock":  {Source: "boxes_on_hand", Transforms: []mappings.Transform{{Op: "default", Value: "0"}, {Op: "multiply", Value: "100"}}},
+		},
+	}
+	content := []byte(`{"data": {"items": [
+		{"sku": " LEG-01 ", "description": "leg ", "boxes_on_hand": 0.12},
+		{"sku": "SCR-02", "description": "screw"}
+	]}}`)
+
+	mapped, err := mapping.Apply(content)
+	assert.Nil(t, err)
+
+	var inventory model.Inventory
+	err = json.Unmarshal(mapped, &inventory)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ArticleIncoming{
+		{ArtId: "1", Name: "leg", Stock: "12"},
+		{ArtId: "2", Name: "screw", Stock: "0"},
+	}, inventory.Inventory)
+}
+
+func TestApplyProductMapping(t *testing.T) {
+	mapping := mappings.Mapping{
+		Folder: "product/acme",
+		Domain: "product",
+		Fields: map[string]mappings.Field{
+			"name":  {Source: "title"},
+			"price": {Source: "pricing.amount"},
+			"contain_articles": {Source: "components", Fields: map[string]mappings.Field{
+				"art_id":    {Source: "article"},
+				"amount_of": {Source: "qty", Transforms: []mappings.Transform{{Op: "default", Value: "1"}}},
+			}},
+		},
+	}
+	content := []byte(`[{"title": "Dining Chair", "pricing": {"amount": 43.51}, "components": [{"article": 1, "qty": 4}, {"article": 3}]}]`)
+
+	mapped, err := mapping.Apply(content)
+	assert.Nil(t, err)
+
+	var products model.IncomingProducts
+	err = json.Unmarshal(mapped, &products)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(products.Products))
+	assert.Equal(t, "43.51", products.Products[0].Price)
+	assert.Equal(t, []model.ProductArticleIncoming{{ArtId: "1", AmountOf: "4"}, {ArtId: "3", AmountOf: "1"}}, products.Products[0].ContainArticles)
+}
+
+func TestApplyMappingErrors(t *testing.T) {
+	mapping := mappings.Mapping{
+		Folder: "article/acme",
+		Domain: "article",
+		Root:   "items",
+		Fields: map[string]mappings.Field{
+			"art_id": {Source: "sku", Transforms: []mappings.Transform{{Op: "lookup", Table: map[string]string{"LEG-01": "1"}}}},
+			"name":   {Source: "description"},
+			"stock":  {Source: "qty", Transforms: []mappings.Transform{{Op: "multiply", Value: "10"}}},
+		},
+	}
+
+	_, err := mapping.Apply([]byte(`{"items": {}}`))
+	assert.Equal(t, `the root "items" of the source file is not a list`, err.Error())
+
+	_, err = mapping.Apply([]byte(`{"items": [{"sku": "LEG-01", "qty": "many"}, {"sku": "XYZ", "description": "screw", "qty": 1}]}`))
+	assert.Equal(t, `record #1: field name: source "description" not found; record #1: field stock: value "many" is not a number to multiply; record #2: field art_id: value "XYZ" not found in the lookup table`, err.Error())
+}
+
+func TestLoadAndForFile(t *testing.T) {
+	configFile, err := ioutil.TempFile("", "mapping-*.json")
+	assert.Nil(t, err)
+	defer os.Remove(configFile.Name())
+	configFile.WriteString(`{"mappings": [
+		{"folder": "article", "domain": "article", "fields": {}},
+		{"folder": "article/acme", "domain": "article", "fields": {}}
+	]}`)
+	configFile.Close()
+
+	config, err := mappings.Load(configFile.Name())
+	assert.Nil(t, err)
+
+	assert.Equal(t, "article/acme", config.ForFile("data/incoming", "data/incoming/article/acme/2021-07-12/inventory.json").Folder)
+	assert.Equal(t, "article", config.ForFile("data/incoming", "data/incoming/article/inventory.json").Folder)
+	assert.Nil(t, config.ForFile("data/incoming", "data/incoming/product/products.json"))
+
+	_, err = mappings.Load("")
+	assert.Nil(t, err)
+}
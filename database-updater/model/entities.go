@@ -2,54 +2,76 @@ package model
 
 import (
 	"database-autoupdater/globals"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"strconv"
-	"time"
-
-	"github.com/sirupsen/logrus"
+	"database-autoupdater/warehouseclient"
+	"math"
+	"strings"
 )
 
 // ArticleWarehouse represents an Article in the Warehouse API
-type ArticleWarehouse struct {
-	ID             int32  `json:"id"`
-	Identification int32  `json:"identification"`
-	Name           string `json:"name"`
-	AvailableStock int32  `json:"availableStock"`
-}
+type ArticleWarehouse = warehouseclient.Article
 
 // ProductWarehouse represents a Product in the Warehouse API
-type ProductWarehouse struct {
-	ID       int32                      `json:"id"`
-	Name     string                     `json:"name"`
-	Price    float32                    `json:"price"`
-	Articles []ProductArticlesWarehouse `json:"articles"`
-}
+type ProductWarehouse = warehouseclient.Product
+
+// PriceWarehouse represents the price of a ProductWarehouse in a currency
+type PriceWarehouse = warehouseclient.Price
 
 // ProductArticlesWarehouse represents the list of ArticleWarehouse
 // a given ProductWarehouse is made of
-type ProductArticlesWarehouse struct {
-	ArticleID int32 `json:"articleId"`
-	Quantity  int32 `json:"quantity"`
-}
+type ProductArticlesWarehouse = warehouseclient.ArticleComposition
+
+// ArticleMovementWarehouse represents a relative change of the stock of
+// an Article in the Warehouse API
+type ArticleMovementWarehouse = warehouseclient.StockMovement
+
+// MovedStockWarehouse represents the result of a stock movement in the Warehouse API
+type MovedStockWarehouse = warehouseclient.MovedStock
+
+// ProductAvailabilityWarehouse represents a Product in the Warehouse API with the
+// quantity that can be made with the current stock of its Articles
+type ProductAvailabilityWarehouse = warehouseclient.ProductAvailability
+
+// StockUpdateWarehouse represents the result of the stock update by Product in the Warehouse API
+type StockUpdateWarehouse = warehouseclient.StockUpdate
 
 // JSON FROM INCOMING FILES
 
-// ArticleIncoming represents an Article in the incoming file
+// ArticleIncoming represents an Article in the incoming file. The Op tells whether
+// the Article is written (`upsert`, the default) or removed (`delete`). Force allows
+// removing an Article still used by some Product. The Unit is the one of the Stock,
+// like `box`. Without it, the Stock is in the base unit of the Article. The Location
+// is the site the Stock is at. Without it, the Stock is the total of the Article
 type ArticleIncoming struct {
-	ArtId string `json:"art_id"`
-	Name  string `json:"name"`
-	Stock string `json:"stock"`
+	Op       string `json:"op"`
+	Force    string `json:"force"`
+	ArtId    string `json:"art_id"`
+	Name     string `json:"name"`
+	Stock    string `json:"stock"`
+	Unit     string `json:"unit"`
+	Location string `json:"location"`
 }
 
-// ProductIncoming represents an Product in the incoming file
+// ProductIncoming represents an Product in the incoming file. The Sku is
+// the stable identifier of the Product. When missing, the Name is used instead.
+// The Op tells whether the Product is written (`upsert`, the default) or removed (`delete`).
+// The Currency is the one of the Price, when it has no code, and the Prices are the
+// price points of the Product in other currencies
 type ProductIncoming struct {
+	Op              string                   `json:"op"`
+	Sku             string                   `json:"sku"`
 	Name            string                   `json:"name"`
 	Price           string                   `json:"price"`
+	Currency        string                   `json:"currency"`
+	Prices          []PriceIncoming          `json:"prices"`
 	ContainArticles []ProductArticleIncoming `json:"contain_articles"`
 }
 
+// PriceIncoming represents the price of a ProductIncoming in a currency, like "499" "SEK"
+type PriceIncoming struct {
+	Currency string `json:"currency"`
+	Price    string `json:"price"`
+}
+
 // ProductArticleIncoming represents the list of ArticleIncoming
 // a given ProductIncoming is made of
 type ProductArticleIncoming struct {
@@ -57,6 +79,65 @@ type ProductArticleIncoming struct {
 	AmountOf string `json:"amount_of"`
 }
 
+// ArticleMovementIncoming represents a stock movement of an Article in the incoming
+// file. The Delta is relative to the current stock, like "+5" or "-2", in the Unit,
+// like the Stock of the ArticleIncoming, and at the Location, if any. The MovementId
+// identifies the movement at the source, so it's applied only once even if it's received again
+type ArticleMovementIncoming struct {
+	MovementId string `json:"movement_id"`
+	ArtId      string `json:"art_id"`
+	Delta      string `json:"delta"`
+	Unit       string `json:"unit"`
+	Reason     string `json:"reason"`
+	Location   string `json:"location"`
+}
+
+// Operations of the incoming Article and Product records
+const (
+	OperationUpsert = "upsert"
+	OperationDelete = "delete"
+)
+
+// Operation returns the normalized operation of the record. Records without it are upserts
+func (a ArticleIncoming) Operation() string {
+	return normalizeOperation(a.Op)
+}
+
+// Operation returns the normalized operation of the record. Records without it are upserts
+func (p ProductIncoming) Operation() string {
+	return normalizeOperation(p.Op)
+}
+
+// ConvertArticleDeletion converts the tombstone record of an Article: the identification of the Article
+// to remove and whether it's removed even if some Product is made of it. The error is an InvalidFieldError
+func ConvertArticleDeletion(articleIncoming ArticleIncoming) (int64, bool, error) {
+	id, err := ParseIdentification("art_id", strings.TrimSpace(articleIncoming.ArtId))
+	if err != nil {
+		return 0, false, err
+	}
+	force, err := ParseForce("force", articleIncoming.Force)
+	if err != nil {
+		return 0, false, err
+	}
+	return id, force, nil
+}
+
+// CheckProductDeletion checks the tombstone record of a Product, which is found by its SKU or name
+func CheckProductDeletion(productIncoming ProductIncoming) error {
+	if strings.TrimSpace(productIncoming.Sku) == "" && strings.TrimSpace(productIncoming.Name) == "" {
+		return InvalidFieldError{Field: "name", Value: productIncoming.Name, Message: "the name or the sku of the Product to delete must be provided"}
+	}
+	return nil
+}
+
+func normalizeOperation(op string) string {
+	op = strings.ToLower(strings.TrimSpace(op))
+	if op == "" {
+		return OperationUpsert
+	}
+	return op
+}
+
 // Inventory represents the root of the articles file
 type Inventory struct {
 	Inventory []ArticleIncoming `json:"inventory"`
@@ -67,39 +148,126 @@ type IncomingProducts struct {
 	Products []ProductIncoming `json:"products"`
 }
 
-func ConvertArticleIncomingToWarehouse(articleIncoming ArticleIncoming) *ArticleWarehouse {
+// Movements represents the root of the stock movements file
+type Movements struct {
+	Movements []ArticleMovementIncoming `json:"movements"`
+}
+
+// OrderLineIncoming represents a line of a sales order in the incoming file.
+// The Product can be referenced by its ID or by its name. The Location is the site
+// whose stock fulfills the line. Without it, the total stock of the Articles is used
+type OrderLineIncoming struct {
+	Product  string `json:"product"`
+	Quantity string `json:"quantity"`
+	Location string `json:"location"`
+}
+
+// Orders represents the root of the sales orders file
+type Orders struct {
+	Orders []OrderLineIncoming `json:"orders"`
+}
+
+// MovementReasons are the accepted reason codes of a stock movement
+var MovementReasons = []string{"received", "damaged", "returned", "lost", "correction"}
+
+// ConvertArticleIncomingToWarehouse converts the Article of an incoming file to the Warehouse model, with the
+// stock in the base unit of the Article. The error is an InvalidFieldError when some value can't be converted
+func ConvertArticleIncomingToWarehouse(articleIncoming ArticleIncoming) (*ArticleWarehouse, error) {
 	// convert the ID field to Int, which is the type used in the
 	// Warehouse API
-	id, err := strconv.Atoi(articleIncoming.ArtId)
+	id, err := ParseIdentification("art_id", articleIncoming.ArtId)
 	if err != nil {
-		logrus.Errorf("Error parsing ArticleIncoming ID. Details: %s", err)
-		return nil
+		return nil, err
 	}
 
 	// convert the Stock field to Int, which is the type used in the
 	// Warehouse API
-	stock, err := strconv.Atoi(articleIncoming.Stock)
+	stock, err := ParseStock("stock", articleIncoming.Stock)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stock in a pack or another unit is normalized to the base unit of the Article
+	stock, err = convertUnit(id, "stock", articleIncoming.Stock, stock, articleIncoming.Unit, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := ParseLocation("location", articleIncoming.Location)
 	if err != nil {
-		logrus.Errorf("Error parsing ArticleIncoming Stock. Details: %s", err)
-		return nil
+		return nil, err
 	}
 
 	// return the converted Article
 	return &ArticleWarehouse{
-		Identification: int32(id),
+		Identification: id,
 		Name:           articleIncoming.Name,
-		AvailableStock: int32(stock),
+		AvailableStock: stock,
+		Location:       location,
+	}, nil
+}
+
+// ConvertArticleMovementIncomingToWarehouse converts the stock movement of an incoming file to the
+// Warehouse model. The error is an InvalidFieldError when some value can't be converted
+func ConvertArticleMovementIncomingToWarehouse(movementIncoming ArticleMovementIncoming) (*ArticleMovementWarehouse, error) {
+	// convert the ID field to Int, which is the type used in the
+	// Warehouse API
+	id, err := ParseIdentification("art_id", movementIncoming.ArtId)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert the Delta field to Int. The sign tells if the stock
+	// will be increased or decreased
+	delta, err := ParseDelta("delta", movementIncoming.Delta)
+	if err != nil {
+		return nil, err
+	}
+	if delta == 0 {
+		return nil, InvalidFieldError{Field: "delta", Value: movementIncoming.Delta, Message: "a movement of zero items doesn't change the stock"}
+	}
+	delta, err = convertUnit(id, "delta", movementIncoming.Delta, delta, movementIncoming.Unit, math.MinInt32, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	// the reason must be one of the known codes
+	reason := strings.ToLower(strings.TrimSpace(movementIncoming.Reason))
+	validReason := false
+	for _, r := range MovementReasons {
+		if r == reason {
+			validReason = true
+		}
+	}
+	if !validReason {
+		return nil, InvalidFieldError{Field: "reason", Value: movementIncoming.Reason, Message: "must be one of: " + strings.Join(MovementReasons, ", ")}
+	}
+
+	location, err := ParseLocation("location", movementIncoming.Location)
+	if err != nil {
+		return nil, err
 	}
+
+	return &ArticleMovementWarehouse{
+		Identification: id,
+		Delta:          delta,
+		Reason:         reason,
+		Location:       location,
+		Key:            strings.TrimSpace(movementIncoming.MovementId),
+	}, nil
 }
 
-func ConvertProductIncomingToWarehouse(productIncoming ProductIncoming) *ProductWarehouse {
+// ConvertProductIncomingToWarehouse converts the Product of an incoming file to the Warehouse model,
+// with the IDs of the Articles it's made of by their identification, as resolved at the Warehouse API.
+// The error is an InvalidFieldError when some value can't be converted or an UnknownArticleError
+// when some Article has no ID
+func ConvertProductIncomingToWarehouse(productIncoming ProductIncoming, articleIDs map[int64]int32) (*ProductWarehouse, error) {
 
-	// convert the Price field to Float32, which is the type used in the
-	// Warehouse API
-	price, err := strconv.ParseFloat(productIncoming.Price, 32)
+	// convert the prices to exact decimals, in the currency of the Warehouse and in the
+	// currencies the Product is sold in, rounded with the configured rules
+	price, prices, err := ConvertPrices(productIncoming)
 	if err != nil {
-		logrus.Errorf("Error converting ProductIncoming Price. Details: %s", err)
-		return nil
+		return nil, err
 	}
 
 	// walk all the article composition itens of the incoming Product
@@ -109,74 +277,34 @@ func ConvertProductIncomingToWarehouse(productIncoming ProductIncoming) *Product
 
 		// convert the ArtID field to Int32, which is the type used in the
 		// Warehouse API to build the relationship between Product and Article
-		artId, err := strconv.Atoi(productIncoming.ContainArticles[i].ArtId)
+		artId, err := ParseIdentification("art_id", productIncoming.ContainArticles[i].ArtId)
 		if err != nil {
-			logrus.Errorf("Error converting ProductIncoming Contained Article Id. Details: %s", err)
-			return nil
+			return nil, err
 		}
 
 		// convert the Quantity field to Int32, which is the type used in the
 		// Warehouse API to define how much of the specified Article is used on the Product
-		quantity, err := strconv.Atoi(productIncoming.ContainArticles[i].AmountOf)
+		quantity, err := ParseQuantity("amount_of", productIncoming.ContainArticles[i].AmountOf)
 		if err != nil {
-			logrus.Errorf("Error converting ProductIncoming Contained Article AmoutOf. Details: %s", err)
-			return nil
+			return nil, err
 		}
-		articleResolved, err := GetArticleByIdentification(int32(artId))
-		if err != nil {
-			logrus.Errorf("Error resolving Article to get ID to build the relationship with Product. Details: %s", err)
-			return nil
-		}
-		if articleResolved == nil {
-			logrus.Errorf("Could not find an Article to get ID to build the relationship with Product. Details: %s", err)
-			return nil
+		articleID, ok := articleIDs[artId]
+		if !ok {
+			return nil, UnknownArticleError{ArtId: productIncoming.ContainArticles[i].ArtId}
 		}
 		articleComposition := ProductArticlesWarehouse{
-			ArticleID: articleResolved.ID,
-			Quantity:  int32(quantity),
+			ArticleID: articleID,
+			Quantity:  quantity,
 		}
 		articlesMadeOf = append(articlesMadeOf, articleComposition)
 	}
 
 	return &ProductWarehouse{
+		Sku:      strings.TrimSpace(productIncoming.Sku),
 		Name:     productIncoming.Name,
-		Price:    float32(price),
+		Price:    price,
+		Currency: globals.PriceCurrency.Code,
+		Prices:   prices,
 		Articles: articlesMadeOf,
-	}
-}
-
-// GetArticle fetches an Article from Warehouse
-func GetArticleByIdentification(id int32) (*ArticleWarehouse, error) {
-
-	url := globals.WarehouseArticleEndpoint
-	logrus.Debugf("Getting an Article from Warehouse API. URL: %s", url)
-
-	var httpClient = &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s?identification=%d", url, id), nil)
-	if err != nil {
-		logrus.Errorf("Error preparing the request to GET a new Article to Warehouse API. Details: %s", err)
-		return nil, err
-	}
-	req.Header.Add("Content-Type", "application/json")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		logrus.Errorf("Error doing the request to GET an Article to Warehouse API. Details: %s", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("error POSTing to Warehouse API. Status: %s", resp.Status)
-	}
-
-	var articleFetched []ArticleWarehouse
-	err = json.NewDecoder(resp.Body).Decode(&articleFetched)
-	if err != nil {
-		logrus.Errorf("Error decoding the response of the Post a new Article to Warehouse API. Details: %s", err)
-		return nil, err
-	}
-	if len(articleFetched) == 0 {
-		return nil, nil
-	}
-	return &articleFetched[0], nil
+	}, nil
 }
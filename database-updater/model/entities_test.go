@@ -1,7 +1,6 @@
 package model
 
 import (
-	"database-autoupdater/globals"
 	"fmt"
 	"testing"
 
@@ -9,21 +8,59 @@ import (
 )
 
 func TestConvertArticleIncomingToWarehouse(t *testing.T) {
-	globals.WarehouseArticleEndpoint = "http://localhost:4000/article"
 	articleIncoming := ArticleIncoming{
 		ArtId: "1",
 		Stock: "100",
 		Name:  "Foo",
 	}
-	converted := ConvertArticleIncomingToWarehouse(articleIncoming)
+	converted, err := ConvertArticleIncomingToWarehouse(articleIncoming)
 
+	assert.Nil(t, err)
 	assert.Equal(t, articleIncoming.ArtId, fmt.Sprintf("%d", converted.Identification))
 	assert.Equal(t, articleIncoming.Stock, fmt.Sprintf("%d", converted.AvailableStock))
 	assert.Equal(t, articleIncoming.Name, converted.Name)
+
+	// the error tells which field is invalid
+	articleIncoming.Stock = "lots"
+	_, err = ConvertArticleIncomingToWarehouse(articleIncoming)
+	assert.Equal(t, InvalidFieldError{Field: "stock", Value: "lots", Message: "must be an integer"}, err)
+	assert.Equal(t, `invalid stock "lots": must be an integer`, err.Error())
+}
+
+func TestConvertArticleMovementIncomingToWarehouse(t *testing.T) {
+	movementIncoming := ArticleMovementIncoming{
+		ArtId:  "2",
+		Delta:  "-2",
+		Reason: "Damaged",
+	}
+	converted, err := ConvertArticleMovementIncomingToWarehouse(movementIncoming)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), converted.Identification)
+	assert.Equal(t, int32(-2), converted.Delta)
+	assert.Equal(t, "damaged", converted.Reason)
+
+	movementIncoming.Delta = "+5"
+	converted, err = ConvertArticleMovementIncomingToWarehouse(movementIncoming)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(5), converted.Delta)
+
+	movementIncoming.Reason = "stolen"
+	converted, err = ConvertArticleMovementIncomingToWarehouse(movementIncoming)
+	assert.Nil(t, converted)
+	assert.Equal(t, "reason", err.(InvalidFieldError).Field)
+
+	movementIncoming.Reason = "received"
+	movementIncoming.Delta = "0"
+	converted, err = ConvertArticleMovementIncomingToWarehouse(movementIncoming)
+	assert.Nil(t, converted)
+	assert.Equal(t, "delta", err.(InvalidFieldError).Field)
 }
 
 func TestConvertProductIncomingToWarehouse(t *testing.T) {
-	globals.WarehouseArticleEndpoint = "http://localhost:4000/article"
+	// the Articles of the composition get their IDs at the Warehouse API, by identification
+	articleIDs := map[int64]int32{1: 10, 2: 20}
+
 	productIncoming := ProductIncoming{
 		Name:  "Bar",
 		Price: "99.99",
@@ -38,8 +75,20 @@ func TestConvertProductIncomingToWarehouse(t *testing.T) {
 			},
 		},
 	}
-	converted := ConvertProductIncomingToWarehouse(productIncoming)
+	converted, err := ConvertProductIncomingToWarehouse(productIncoming, articleIDs)
 
+	assert.Nil(t, err)
 	assert.Equal(t, productIncoming.Name, converted.Name)
-	assert.Equal(t, productIncoming.Price, fmt.Sprintf("%.2f", converted.Price))
+	assert.Equal(t, productIncoming.Price, converted.Price.String())
+	assert.Equal(t, []ProductArticlesWarehouse{{ArticleID: 10, Quantity: 2}, {ArticleID: 20, Quantity: 8}}, converted.Articles)
+
+	// a Product made of an Article that doesn't exist can't be converted
+	productIncoming.ContainArticles[1].ArtId = "3"
+	converted, err = ConvertProductIncomingToWarehouse(productIncoming, articleIDs)
+	assert.Nil(t, converted)
+	assert.Equal(t, UnknownArticleError{ArtId: "3"}, err)
+
+	productIncoming.Price = "cheap"
+	_, err = ConvertProductIncomingToWarehouse(productIncoming, articleIDs)
+	assert.Equal(t, InvalidFieldError{Field: "price", Value: "cheap", Message: "must be a number"}, err)
 }
@@ -0,0 +1,28 @@
+package model
+
+import "fmt"
+
+// InvalidFieldError tells which field of an incoming record has a value that can't be
+// converted to the Warehouse model and why
+type InvalidFieldError struct {
+	Field   string
+	Value   string
+	Message string
+}
+
+func (e InvalidFieldError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("invalid %s %q", e.Field, e.Value)
+	}
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Message)
+}
+
+// UnknownArticleError tells that a record references, by its art_id, an Article
+// that doesn't exist in the Warehouse
+type UnknownArticleError struct {
+	ArtId string
+}
+
+func (e UnknownArticleError) Error() string {
+	return fmt.Sprintf("Article with art_id %q not found", e.ArtId)
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/money"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Precision of the prices in the Warehouse database, where they are stored as
+// DECIMAL(65,30): 65 digits, of which 30 are after the point
+const (
+	PricePrecision = 65
+	PriceScale     = 30
+)
+
+// ParseIdentification parses the art_id of an Article, stored as BIGINT by the Warehouse
+func ParseIdentification(field, value string) (int64, error) {
+	return parseInteger(field, value, 0, math.MaxInt64)
+}
+
+// ParseStock parses the stock of an Article, which can't be negative
+func ParseStock(field, value string) (int32, error) {
+	stock, err := parseInteger(field, value, 0, math.MaxInt32)
+	return int32(stock), err
+}
+
+// ParseQuantity parses a quantity of items, like the amount_of an Article in a Product, which must be positive
+func ParseQuantity(field, value string) (int32, error) {
+	quantity, err := parseInteger(field, value, 1, math.MaxInt32)
+	return int32(quantity), err
+}
+
+// ParseDelta parses the relative change of a stock, which can be negative
+func ParseDelta(field, value string) (int32, error) {
+	delta, err := parseInteger(field, value, math.MinInt32, math.MaxInt32)
+	return int32(delta), err
+}
+
+// ParsePrice parses a price, with an optional currency code (like "43.51 EUR"), which must be a non-negative
+// decimal number that fits DECIMAL(65,30). The prices in other currencies are converted to the currency of the
+// Warehouse with the exchange rates. It's rounded with the configured rules
+func ParsePrice(field, value string) (money.Decimal, error) {
+	amount, currency, err := ParseAmount(field, value, "")
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	return (&exchange{}).convert(field, value, amount, currency, globals.PriceCurrency)
+}
+
+// ParseAmount parses a price with its currency: the code of the value (like "499 SEK"), or else the
+// currencyCode, or else the currency of the Warehouse. It's rounded with the configured rules in that currency
+func ParseAmount(field, value, currencyCode string) (money.Decimal, money.Currency, error) {
+	amount, code, err := money.ParseAmount(value)
+	if err != nil {
+		return money.Decimal{}, money.Currency{}, InvalidFieldError{Field: field, Value: value, Message: "must be a number"}
+	}
+	if amount.Sign() < 0 {
+		return money.Decimal{}, money.Currency{}, InvalidFieldError{Field: field, Value: value, Message: "can't be negative"}
+	}
+	if amount.IntegerDigits() > PricePrecision-PriceScale || amount.Scale() > PriceScale {
+		return money.Decimal{}, money.Currency{}, InvalidFieldError{Field: field, Value: value, Message: fmt.Sprintf("must have at most %d digits before the point and %d after it", PricePrecision-PriceScale, PriceScale)}
+	}
+	currencyCode = strings.ToUpper(strings.TrimSpace(currencyCode))
+	if code != "" && currencyCode != "" && code != currencyCode {
+		return money.Decimal{}, money.Currency{}, InvalidFieldError{Field: field, Value: value, Message: fmt.Sprintf("is in %s but the currency of the record is %s", code, currencyCode)}
+	}
+	if code == "" {
+		code = currencyCode
+	}
+	currency := globals.PriceCurrency
+	if code != "" {
+		if currency, err = money.ParseCurrency(code); err != nil {
+			return money.Decimal{}, money.Currency{}, InvalidFieldError{Field: field, Value: value, Message: err.Error()}
+		}
+	}
+	return globals.PriceRounding.Round(amount, currency), currency, nil
+}
+
+// ParseLocation parses the location (site) of a record, like "Stockholm", which is compared in lowercase.
+// When the Locations are configured, it must be one of them
+func ParseLocation(field, value string) (string, error) {
+	location := strings.ToLower(strings.TrimSpace(value))
+	if len(globals.Locations) == 0 {
+		return location, nil
+	}
+	for _, l := range globals.Locations {
+		if l == location {
+			return location, nil
+		}
+	}
+	return "", InvalidFieldError{Field: field, Value: value, Message: "must be one of: " + strings.Join(globals.Locations, ", ")}
+}
+
+// ParseOperation parses the operation of a record, which is `upsert` (the default) or `delete`
+func ParseOperation(field, value string) (string, error) {
+	op := normalizeOperation(value)
+	if op != OperationUpsert && op != OperationDelete {
+		return "", InvalidFieldError{Field: field, Value: value, Message: "must be `upsert` or `delete`"}
+	}
+	return op, nil
+}
+
+// ParseForce parses whether the removal of an Article is forced, which is `false` if it's empty
+func ParseForce(field, value string) (bool, error) {
+	if strings.TrimSpace(value) == "" {
+		return false, nil
+	}
+	force, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, InvalidFieldError{Field: field, Value: value, Message: "must be `true` or `false`"}
+	}
+	return force, nil
+}
+
+// parseInteger parses the value of an integer field of an incoming record, which must be between min and max
+func parseInteger(field, value string, min, max int64) (int64, error) {
+	integer, err := strconv.ParseInt(value, 10, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, InvalidFieldError{Field: field, Value: value, Message: "must be an integer"}
+	}
+	if err != nil || integer < min || integer > max {
+		return 0, InvalidFieldError{Field: field, Value: value, Message: fmt.Sprintf("must be an integer from %d to %d", min, max)}
+	}
+	return integer, nil
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/money"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFields(t *testing.T) {
+	// the identification is a BIGINT, so it isn't truncated to 32 bits
+	id, err := ParseIdentification("art_id", "3000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3000000000), id)
+	_, err = ParseIdentification("art_id", "9223372036854775808")
+	assert.Equal(t, `invalid art_id "9223372036854775808": must be an integer from 0 to 9223372036854775807`, err.Error())
+
+	// the values out of the range of the field are refused instead of wrapped
+	_, err = ParseStock("stock", "3000000000")
+	assert.Equal(t, `invalid stock "3000000000": must be an integer from 0 to 2147483647`, err.Error())
+	_, err = ParseStock("stock", "-1")
+	assert.NotNil(t, err)
+	_, err = ParseQuantity("amount_of", "0")
+	assert.Equal(t, `invalid amount_of "0": must be an integer from 1 to 2147483647`, err.Error())
+	_, err = ParseStock("stock", "12.5")
+	assert.Equal(t, `invalid stock "12.5": must be an integer`, err.Error())
+	delta, err := ParseDelta("delta", "-2147483648")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-2147483648), delta)
+
+	// the prices fit DECIMAL(65,30)
+	price, err := ParsePrice("price", "43.51")
+	assert.Nil(t, err)
+	assert.Equal(t, "43.51", price.String())
+	_, err = ParsePrice("price", strings.Repeat("9", 35)+"."+strings.Repeat("9", 30))
+	assert.Nil(t, err)
+	_, err = ParsePrice("price", strings.Repeat("9", 36))
+	assert.Equal(t, "must have at most 35 digits before the point and 30 after it", err.(InvalidFieldError).Message)
+	_, err = ParsePrice("price", "0."+strings.Repeat("1", 31))
+	assert.NotNil(t, err)
+	_, err = ParsePrice("price", "-1")
+	assert.Equal(t, `invalid price "-1": can't be negative`, err.Error())
+	for _, invalid := range []string{"NaN", "Inf", "1e3", "0x10", ""} {
+		_, err = ParsePrice("price", invalid)
+		assert.Equal(t, "must be a number", err.(InvalidFieldError).Message, invalid)
+	}
+
+	// the prices are in the currency of the Warehouse and rounded to its minor units
+	price, err = ParsePrice("price", "43.505 EUR")
+	assert.Nil(t, err)
+	assert.Equal(t, "43.51", price.String())
+	_, err = ParsePrice("price", "499 SEK")
+	assert.Equal(t, `invalid price "499 SEK": can't be converted to EUR: no exchange rate from SEK to EUR`, err.Error())
+	_, err = ParsePrice("price", "499 XYZ")
+	assert.Equal(t, `invalid price "499 XYZ": unknown currency code "XYZ"`, err.Error())
+
+	// with the configured rounding rules
+	globals.PriceRounding = money.Rounding{Mode: money.RoundHalfEven, Scale: -1}
+	defer func() { globals.PriceRounding = money.DefaultRounding }()
+	price, err = ParsePrice("price", "43.505")
+	assert.Nil(t, err)
+	assert.Equal(t, "43.50", price.String())
+
+	// the locations are compared in lowercase and, when configured, must be one of them
+	location, err := ParseLocation("location", " Stockholm ")
+	assert.Nil(t, err)
+	assert.Equal(t, "stockholm", location)
+	globals.Locations = []string{"stockholm", "malmo"}
+	defer func() { globals.Locations = nil }()
+	location, err = ParseLocation("location", "MALMO")
+	assert.Nil(t, err)
+	assert.Equal(t, "malmo", location)
+	_, err = ParseLocation("location", "oslo")
+	assert.Equal(t, `invalid location "oslo": must be one of: stockholm, malmo`, err.Error())
+	_, err = ParseLocation("location", "")
+	assert.NotNil(t, err)
+
+	// the records without operation are upserts
+	op, err := ParseOperation("op", " Delete ")
+	assert.Nil(t, err)
+	assert.Equal(t, OperationDelete, op)
+	op, err = ParseOperation("op", "")
+	assert.Nil(t, err)
+	assert.Equal(t, OperationUpsert, op)
+	_, err = ParseOperation("op", "remove")
+	assert.Equal(t, "invalid op \"remove\": must be `upsert` or `delete`", err.Error())
+	force, err := ParseForce("force", "")
+	assert.Nil(t, err)
+	assert.False(t, force)
+	_, err = ParseForce("force", "yes")
+	assert.Equal(t, "invalid force \"yes\": must be `true` or `false`", err.Error())
+}
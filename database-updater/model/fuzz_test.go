@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkInvalidField fails the fuzz target if the conversion error doesn't tell which field is invalid
+func checkInvalidField(t *testing.T, err error) {
+	if _, ok := err.(InvalidFieldError); !ok {
+		t.Fatalf("the conversion error is not an InvalidFieldError: %v", err)
+	}
+}
+
+// FuzzConvertArticleIncomingToWarehouse converts any values of an incoming Article: the invalid
+// ones must be InvalidFieldErrors, never crash or change the name
+func FuzzConvertArticleIncomingToWarehouse(f *testing.F) {
+	logrus.SetLevel(logrus.PanicLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+	f.Add("1", "leg", "12")
+	f.Add("one", "leg", "-3")
+	f.Add("2147483648", "screw", "+17")
+
+	f.Fuzz(func(t *testing.T, artId, name, stock string) {
+		converted, err := ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: artId, Name: name, Stock: stock})
+		if err != nil {
+			checkInvalidField(t, err)
+			return
+		}
+		if converted.Name != name {
+			t.Errorf("the name %q was converted to %q", name, converted.Name)
+		}
+	})
+}
+
+// FuzzConvertArticleMovementIncomingToWarehouse converts any values of an incoming stock movement
+func FuzzConvertArticleMovementIncomingToWarehouse(f *testing.F) {
+	logrus.SetLevel(logrus.PanicLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+	f.Add("2", "-2", "Damaged")
+	f.Add("2", "0", "received")
+	f.Add("x", "+5", "stolen")
+
+	f.Fuzz(func(t *testing.T, artId, delta, reason string) {
+		converted, err := ConvertArticleMovementIncomingToWarehouse(ArticleMovementIncoming{ArtId: artId, Delta: delta, Reason: reason})
+		if err != nil {
+			checkInvalidField(t, err)
+			return
+		}
+		if converted.Delta == 0 {
+			t.Errorf("the movement %q of zero items was converted", delta)
+		}
+	})
+}
+
+// FuzzConvertProductIncomingToWarehouse converts any values of an incoming Product made of an Article,
+// where only the Article 1 exists
+func FuzzConvertProductIncomingToWarehouse(f *testing.F) {
+	articleIDs := map[int64]int32{1: 10}
+	f.Add("Dining Chair", "43.51", "1", "4")
+	f.Add("Dining Chair", "NaN", "1", "4")
+	f.Add("Dining Table", "111.99", "99", "1")
+
+	f.Fuzz(func(t *testing.T, name, price, artId, amountOf string) {
+		converted, err := ConvertProductIncomingToWarehouse(ProductIncoming{Name: name, Price: price, ContainArticles: []ProductArticleIncoming{{ArtId: artId, AmountOf: amountOf}}}, articleIDs)
+		if _, unknown := err.(UnknownArticleError); unknown {
+			return
+		}
+		if err != nil {
+			checkInvalidField(t, err)
+			return
+		}
+		if converted.Name != name {
+			t.Errorf("the name %q was converted to %q", name, converted.Name)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/money"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ConvertPrices converts the prices of an incoming Product: its price in the currency of the Warehouse
+// and its prices in each currency it's sold in, which are the SalesCurrencies and the ones of the record.
+// The prices the record doesn't have are converted from its price with the exchange rates
+func ConvertPrices(productIncoming ProductIncoming) (money.Decimal, []PriceWarehouse, error) {
+	exchange := &exchange{}
+	price, currency, err := ParseAmount("price", productIncoming.Price, productIncoming.Currency)
+	if err != nil {
+		return money.Decimal{}, nil, err
+	}
+
+	// the price points of the record, by currency code
+	prices := map[string]money.Decimal{currency.Code: price}
+	for _, p := range productIncoming.Prices {
+		amount, amountCurrency, err := ParseAmount("prices", p.Price, p.Currency)
+		if err != nil {
+			return money.Decimal{}, nil, err
+		}
+		if existing, found := prices[amountCurrency.Code]; found && !existing.Equal(amount) {
+			return money.Decimal{}, nil, InvalidFieldError{Field: "prices", Value: p.Price, Message: fmt.Sprintf("is another price in %s", amountCurrency)}
+		}
+		prices[amountCurrency.Code] = amount
+	}
+
+	// the currencies the Product is sold in without price point are converted from its price
+	for _, sales := range append([]money.Currency{globals.PriceCurrency}, globals.SalesCurrencies...) {
+		if _, found := prices[sales.Code]; found {
+			continue
+		}
+		converted, err := exchange.convert("price", productIncoming.Price, price, currency, sales)
+		if err != nil {
+			return money.Decimal{}, nil, err
+		}
+		prices[sales.Code] = converted
+	}
+
+	codes := make([]string, 0, len(prices))
+	for code := range prices {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	pricesWarehouse := make([]PriceWarehouse, len(codes))
+	for i, code := range codes {
+		pricesWarehouse[i] = PriceWarehouse{Currency: code, Price: prices[code]}
+	}
+	return prices[globals.PriceCurrency.Code], pricesWarehouse, nil
+}
+
+// exchange converts the prices of a record to other currencies. The exchange-rate file
+// is read only when some price must be converted, and once per record
+type exchange struct {
+	rates  money.ExchangeRates
+	loaded bool
+}
+
+// convert converts the amount of the field to the currency. The error is an InvalidFieldError
+// when there's no exchange rate for it
+func (e *exchange) convert(field, value string, amount money.Decimal, from, to money.Currency) (money.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+	if !e.loaded {
+		rates, err := money.LoadExchangeRates(globals.ExchangeRatesFile)
+		if err != nil {
+			return money.Decimal{}, err
+		}
+		e.rates, e.loaded = rates, true
+	}
+	converted, err := e.rates.Convert(amount, from, to, globals.PriceRounding)
+	var noRate money.NoExchangeRateError
+	if errors.As(err, &noRate) {
+		return money.Decimal{}, InvalidFieldError{Field: field, Value: value, Message: fmt.Sprintf("can't be converted to %s: %s", to, err)}
+	}
+	return converted, err
+}
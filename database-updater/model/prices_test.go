@@ -0,0 +1,50 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/money"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertPrices(t *testing.T) {
+	ratesFile := filepath.Join(t.TempDir(), "rates.json")
+	ioutil.WriteFile(ratesFile, []byte(`{"base": "EUR", "rates": {"SEK": "11.4520", "NOK": 11.715}}`), 0666)
+	globals.ExchangeRatesFile = ratesFile
+	globals.SalesCurrencies = []money.Currency{{Code: "EUR", MinorUnits: 2}, {Code: "SEK", MinorUnits: 2}}
+	defer func() { globals.ExchangeRatesFile, globals.SalesCurrencies = "", nil }()
+
+	// the price in SEK is kept and the one in EUR is converted from it
+	price, prices, err := ConvertPrices(ProductIncoming{Price: "499", Currency: "SEK"})
+	assert.Nil(t, err)
+	assert.Equal(t, "43.57", price.String())
+	assert.Equal(t, []PriceWarehouse{{Currency: "EUR", Price: money.MustParseDecimal("43.57")}, {Currency: "SEK", Price: money.MustParseDecimal("499.00")}}, prices)
+
+	// the price points of the record aren't converted, and other currencies are kept too
+	price, prices, err = ConvertPrices(ProductIncoming{Price: "43.51", Prices: []PriceIncoming{{Currency: "SEK", Price: "499"}, {Price: "519 NOK"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "43.51", price.String())
+	assert.Equal(t, []PriceWarehouse{
+		{Currency: "EUR", Price: money.MustParseDecimal("43.51")},
+		{Currency: "NOK", Price: money.MustParseDecimal("519.00")},
+		{Currency: "SEK", Price: money.MustParseDecimal("499.00")},
+	}, prices)
+
+	// a currency with two prices is ambiguous
+	_, _, err = ConvertPrices(ProductIncoming{Price: "43.51", Prices: []PriceIncoming{{Currency: "EUR", Price: "45"}}})
+	assert.Equal(t, `invalid prices "45": is another price in EUR`, err.Error())
+	_, _, err = ConvertPrices(ProductIncoming{Price: "499 SEK", Currency: "EUR"})
+	assert.Equal(t, `invalid price "499 SEK": is in SEK but the currency of the record is EUR`, err.Error())
+
+	// a price without exchange rate can't be converted
+	_, _, err = ConvertPrices(ProductIncoming{Price: "5000", Currency: "ISK"})
+	assert.Equal(t, `invalid price "5000": can't be converted to EUR: no exchange rate from ISK to EUR`, err.Error())
+
+	// an invalid exchange-rate file fails all the conversions
+	ioutil.WriteFile(ratesFile, []byte(`{"base": "EUR", "rates": {"SEK": "-1"}}`), 0666)
+	_, _, err = ConvertPrices(ProductIncoming{Price: "43.51"})
+	assert.Equal(t, "exchange-rate file has an invalid rate of SEK: must be positive", err.Error())
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/units"
+	"fmt"
+	"strings"
+)
+
+// convertUnit converts the quantity of the field, in the unit, to the base unit of the Article, which must
+// be between min and max. The quantities without unit already are in the base unit
+func convertUnit(artId int64, field, value string, quantity int32, unit string, min, max int64) (int32, error) {
+	if units.Normalize(unit) == "" {
+		return quantity, nil
+	}
+	factor, found := globals.Units.Factor(artId, unit)
+	if !found {
+		return 0, InvalidFieldError{Field: "unit", Value: unit, Message: fmt.Sprintf("isn't a unit of the Article %d. Must be one of: %s", artId, strings.Join(globals.Units.UnitsOf(artId), ", "))}
+	}
+	// checked before multiplying, so a huge pack size can't overflow
+	limit, magnitude := max, int64(quantity)
+	if quantity < 0 {
+		limit, magnitude = -min, -magnitude
+	}
+	if magnitude != 0 && factor > limit/magnitude {
+		return 0, InvalidFieldError{Field: field, Value: value, Message: fmt.Sprintf("in %s is out of the range from %d to %d %s", units.Normalize(unit), min, max, globals.Units.BaseUnitOf(artId))}
+	}
+	return int32(int64(quantity) * factor), nil
+}
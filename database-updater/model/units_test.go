@@ -0,0 +1,65 @@
+package model
+
+import (
+	"database-autoupdater/globals"
+	"database-autoupdater/units"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertUnits(t *testing.T) {
+	unitsFile := filepath.Join(t.TempDir(), "units.json")
+	ioutil.WriteFile(unitsFile, []byte(`{
+		"units": {"Dozen": 12},
+		"articles": {
+			"2": {"packs": {"box": 100, "pallet": 4800}},
+			"5": {"baseUnit": "meter", "packs": {"roll": 50, "dozen": 10}}
+		}
+	}`), 0666)
+	var err error
+	globals.Units, err = units.Load(unitsFile)
+	assert.Nil(t, err)
+	defer func() { globals.Units, _ = units.Load("") }()
+
+	// the stock in packs is normalized to the base unit of the Article
+	converted, err := ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "3", Unit: "Box"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(300), converted.AvailableStock)
+	converted, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "7", Unit: "piece"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(7), converted.AvailableStock)
+
+	// the units of all the Articles, unless the Article has a pack with the same name
+	converted, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "1", Name: "leg", Stock: "2", Unit: "dozen"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(24), converted.AvailableStock)
+	converted, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "5", Name: "cable", Stock: "2", Unit: "dozen"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(20), converted.AvailableStock)
+
+	// the movements too, in both directions
+	movement, err := ConvertArticleMovementIncomingToWarehouse(ArticleMovementIncoming{ArtId: "2", Delta: "-2", Unit: "box", Reason: "damaged"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-200), movement.Delta)
+
+	// the unknown units are rejected
+	_, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "3", Unit: "crate"})
+	assert.Equal(t, `invalid unit "crate": isn't a unit of the Article 2. Must be one of: box, dozen, pallet, piece`, err.Error())
+	_, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "5", Name: "cable", Stock: "3", Unit: "piece"})
+	assert.Equal(t, `invalid unit "piece": isn't a unit of the Article 5. Must be one of: dozen, meter, roll`, err.Error())
+
+	// and the stock that doesn't fit once converted
+	_, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "1000000", Unit: "pallet"})
+	assert.Equal(t, `invalid stock "1000000": in pallet is out of the range from 0 to 2147483647 piece`, err.Error())
+
+	// without units file, the only unit is the default base unit
+	globals.Units, _ = units.Load("")
+	converted, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "3", Unit: "piece"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), converted.AvailableStock)
+	_, err = ConvertArticleIncomingToWarehouse(ArticleIncoming{ArtId: "2", Name: "screw", Stock: "3", Unit: "box"})
+	assert.NotNil(t, err)
+}
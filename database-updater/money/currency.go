@@ -0,0 +1,54 @@
+package money
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency, with the digits of its minor unit, like the 2 of the cents of EUR
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+func (c Currency) String() string {
+	return c.Code
+}
+
+// currencies are the ISO 4217 codes accepted, with their minor units
+var currencies = map[string]int{
+	"EUR": 2, "SEK": 2, "NOK": 2, "DKK": 2, "ISK": 0, "GBP": 2, "CHF": 2, "PLN": 2, "CZK": 2, "HUF": 2,
+	"USD": 2, "CAD": 2, "AUD": 2, "NZD": 2, "JPY": 0, "CNY": 2, "KRW": 0, "INR": 2, "BRL": 2, "MXN": 2,
+	"KWD": 3, "BHD": 3,
+}
+
+// DefaultCurrency is the currency of the prices without currency code, unless another one is configured
+var DefaultCurrency = Currency{Code: "EUR", MinorUnits: 2}
+
+// ParseCurrency returns the currency of the ISO 4217 code, like "EUR" or "sek"
+func ParseCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	minorUnits, ok := currencies[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("unknown currency code %q", code)
+	}
+	return Currency{Code: code, MinorUnits: minorUnits}, nil
+}
+
+// amountPattern matches an amount with an optional currency code before or after the number, like "43.51 EUR"
+var amountPattern = regexp.MustCompile(`^(?:([A-Za-z]{3})\s*)?([^\sA-Za-z]+)(?:\s*([A-Za-z]{3}))?$`)
+
+// ParseAmount parses an amount with an optional currency code, like "43.51", "43.51 EUR" or "SEK 499". The
+// code returned is empty when the amount has none. It's not checked against the known currencies
+func ParseAmount(value string) (Decimal, string, error) {
+	match := amountPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || (match[1] != "" && match[3] != "") {
+		return Decimal{}, "", fmt.Errorf("invalid amount %q", value)
+	}
+	amount, err := ParseDecimal(match[2])
+	if err != nil {
+		return Decimal{}, "", fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, strings.ToUpper(match[1] + match[3]), nil
+}
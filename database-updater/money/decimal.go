@@ -0,0 +1,168 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Decimal is an exact decimal number, like the prices the Warehouse database stores as DECIMAL(65,30).
+// Unlike a float32, "43.51" is kept as 43.51 and not as 43.50999832. The zero value is 0
+type Decimal struct {
+	// unscaled is the number without the point and scale the digits after it: 43.51 is 4351 with scale 2
+	unscaled *big.Int
+	scale    int
+}
+
+// decimalPattern matches the plain decimal numbers, with an optional sign and without exponent, like "-43.51"
+var decimalPattern = regexp.MustCompile(`^([+-]?)([0-9]+)(?:\.([0-9]+))?$`)
+
+// ParseDecimal parses a plain decimal number, like "43.51". The digits after the point are kept as
+// they are written, so "43.50" has scale 2
+func ParseDecimal(value string) (Decimal, error) {
+	match := decimalPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return Decimal{}, fmt.Errorf("invalid decimal number %q", value)
+	}
+	unscaled, _ := new(big.Int).SetString(match[1]+match[2]+match[3], 10)
+	return Decimal{unscaled: unscaled, scale: len(match[3])}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if the value is invalid. It's meant for constants and tests
+func MustParseDecimal(value string) Decimal {
+	d, err := ParseDecimal(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewDecimal creates the Decimal unscaled * 10^-scale. E.g.: NewDecimal(4351, 2) is 43.51
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// integer returns the unscaled number, which is nil for the zero value
+func (d Decimal) integer() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// Scale is the number of digits after the point
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// IntegerDigits is the number of digits before the point, without the leading zeros
+func (d Decimal) IntegerDigits() int {
+	integerPart := new(big.Int).Quo(new(big.Int).Abs(d.integer()), pow10(d.scale))
+	if integerPart.Sign() == 0 {
+		return 0
+	}
+	return len(integerPart.String())
+}
+
+// Sign returns -1, 0 or 1, like the sign of the number
+func (d Decimal) Sign() int {
+	return d.integer().Sign()
+}
+
+// Cmp compares the numbers, regardless of their scale: 43.5 and 43.50 are equal
+func (d Decimal) Cmp(other Decimal) int {
+	a, b := d.integer(), other.integer()
+	switch {
+	case d.scale < other.scale:
+		a = new(big.Int).Mul(a, pow10(other.scale-d.scale))
+	case d.scale > other.scale:
+		b = new(big.Int).Mul(b, pow10(d.scale-other.scale))
+	}
+	return a.Cmp(b)
+}
+
+// Equal tells whether the numbers are the same, regardless of their scale
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+// Round rounds the number to the digits after the point with the mode. Numbers with less
+// digits are padded with zeros, so 43.5 rounded to 2 digits is 43.50
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: new(big.Int).Mul(d.integer(), pow10(scale-d.scale)), scale: scale}
+	}
+	divisor := pow10(d.scale - scale)
+	quotient, remainder := new(big.Int).QuoRem(d.integer(), divisor, new(big.Int))
+	if remainder.Sign() != 0 && mode.roundsAway(quotient, remainder, divisor) {
+		quotient.Add(quotient, big.NewInt(int64(d.Sign())))
+	}
+	return Decimal{unscaled: quotient, scale: scale}
+}
+
+// Mul multiplies the numbers exactly: the scale of the product is the sum of their scales
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.integer(), other.integer()), scale: d.scale + other.scale}
+}
+
+// Quo divides the number by the divisor, which can't be zero, rounding the quotient to the
+// digits after the point with the mode
+func (d Decimal) Quo(divisor Decimal, scale int, mode RoundingMode) Decimal {
+	// d / divisor at the scale is (d.unscaled * 10^(scale - d.scale + divisor.scale)) / divisor.unscaled
+	dividend, by := new(big.Int).Set(d.integer()), new(big.Int).Abs(divisor.integer())
+	if shift := scale - d.scale + divisor.scale; shift >= 0 {
+		dividend.Mul(dividend, pow10(shift))
+	} else {
+		by.Mul(by, pow10(-shift))
+	}
+	quotient, remainder := new(big.Int).QuoRem(dividend, by, new(big.Int))
+	if remainder.Sign() != 0 && mode.roundsAway(quotient, remainder, by) {
+		quotient.Add(quotient, big.NewInt(int64(dividend.Sign())))
+	}
+	if divisor.Sign() < 0 {
+		quotient.Neg(quotient)
+	}
+	return Decimal{unscaled: quotient, scale: scale}
+}
+
+// String formats the number with all its digits after the point, like "43.50"
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.integer()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", -d.scale)
+	}
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+}
+
+// MarshalJSON encodes the number as a JSON string, like "43.51", so it isn't read back as a float
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON decodes the number from a JSON string, like the Decimal fields sent by the
+// Warehouse API, or from a JSON number
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" {
+		*d = Decimal{}
+		return nil
+	}
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
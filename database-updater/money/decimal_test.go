@@ -0,0 +1,95 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecimal(t *testing.T) {
+	// the number is kept exactly as written
+	price, err := ParseDecimal("43.51")
+	assert.Nil(t, err)
+	assert.Equal(t, "43.51", price.String())
+	assert.Equal(t, 2, price.Scale())
+	assert.Equal(t, 2, price.IntegerDigits())
+	assert.Equal(t, "-0.05", MustParseDecimal("-0.05").String())
+	assert.Equal(t, "0", Decimal{}.String())
+	assert.Equal(t, "0.001", NewDecimal(1, 3).String())
+	for _, invalid := range []string{"", "NaN", "1e3", "0x10", "4,5", "43.", ".5"} {
+		_, err := ParseDecimal(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+
+	// the comparison doesn't depend on the scale
+	assert.True(t, MustParseDecimal("43.5").Equal(MustParseDecimal("43.500")))
+	assert.Equal(t, -1, MustParseDecimal("43.509").Cmp(MustParseDecimal("43.51")))
+	assert.Equal(t, 1, MustParseDecimal("0").Cmp(MustParseDecimal("-0.0001")))
+
+	// encoded as a JSON string and decoded from a string or a number
+	encoded, err := json.Marshal(struct {
+		Price Decimal `json:"price"`
+	}{price})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"price":"43.51"}`, string(encoded))
+	var decoded struct {
+		Price Decimal `json:"price"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(`{"price": 99.99}`), &decoded))
+	assert.Equal(t, "99.99", decoded.Price.String())
+	assert.Nil(t, json.Unmarshal(encoded, &decoded))
+	assert.True(t, price.Equal(decoded.Price))
+}
+
+func TestRound(t *testing.T) {
+	cases := []struct {
+		value string
+		mode  RoundingMode
+		want  string
+	}{
+		{"0.125", RoundHalfUp, "0.13"},
+		{"0.125", RoundHalfEven, "0.12"},
+		{"0.135", RoundHalfEven, "0.14"},
+		{"0.1251", RoundHalfEven, "0.13"},
+		{"0.129", RoundDown, "0.12"},
+		{"0.121", RoundUp, "0.13"},
+		{"-0.125", RoundHalfUp, "-0.13"},
+		{"-0.121", RoundUp, "-0.13"},
+		{"-0.129", RoundDown, "-0.12"},
+		{"43.5", RoundHalfUp, "43.50"},
+		{"43.51", RoundDown, "43.51"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, MustParseDecimal(c.value).Round(2, c.mode).String(), "%s %s", c.value, c.mode)
+	}
+
+	// the rounding keeps the minor units of the currency unless the scale is set
+	sek, err := ParseCurrency("sek")
+	assert.Nil(t, err)
+	jpy, _ := ParseCurrency("JPY")
+	assert.Equal(t, "499.00", DefaultRounding.Round(MustParseDecimal("499"), sek).String())
+	assert.Equal(t, "500", DefaultRounding.Round(MustParseDecimal("499.5"), jpy).String())
+	assert.Equal(t, "499.4", Rounding{Mode: RoundHalfEven, Scale: 1}.Round(MustParseDecimal("499.45"), sek).String())
+
+	mode, err := ParseRoundingMode("Half-Even")
+	assert.Nil(t, err)
+	assert.Equal(t, RoundHalfEven, mode)
+	_, err = ParseRoundingMode("nearest")
+	assert.Equal(t, `invalid rounding mode "nearest". Must be one of: half-up, half-even, down, up`, err.Error())
+}
+
+func TestParseAmount(t *testing.T) {
+	for value, code := range map[string]string{"43.51": "", "43.51 EUR": "EUR", "sek 499": "SEK", "499SEK": "SEK"} {
+		amount, parsedCode, err := ParseAmount(value)
+		assert.Nil(t, err, value)
+		assert.Equal(t, code, parsedCode, value)
+		assert.Equal(t, 1, amount.Sign(), value)
+	}
+	for _, invalid := range []string{"EUR 43.51 SEK", "EUR", "43.51 EURO", "cheap"} {
+		_, _, err := ParseAmount(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+	_, err := ParseCurrency("XYZ")
+	assert.Equal(t, `unknown currency code "XYZ"`, err.Error())
+}
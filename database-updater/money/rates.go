@@ -0,0 +1,88 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ExchangeRates are the rates of the local exchange-rate file, like:
+//
+//	{"base": "EUR", "rates": {"SEK": "11.4520", "NOK": "11.7150"}}
+//
+// Each rate is how much of the currency is worth one unit of the base currency
+type ExchangeRates struct {
+	Base  string             `json:"base"`
+	Rates map[string]Decimal `json:"rates"`
+}
+
+// NoExchangeRateError is returned when an amount can't be converted for lack of a rate
+type NoExchangeRateError struct {
+	From Currency
+	To   Currency
+}
+
+func (e NoExchangeRateError) Error() string {
+	return fmt.Sprintf("no exchange rate from %s to %s", e.From, e.To)
+}
+
+// LoadExchangeRates reads the exchange-rate file. If no file is provided, there are
+// no rates and only the amounts already in the wanted currency are accepted
+func LoadExchangeRates(ratesFile string) (ExchangeRates, error) {
+	rates := ExchangeRates{}
+	if ratesFile == "" {
+		return rates, nil
+	}
+	content, err := ioutil.ReadFile(ratesFile)
+	if err != nil {
+		return rates, fmt.Errorf("error reading exchange-rate file: %s", err)
+	}
+	if err := json.Unmarshal(content, &rates); err != nil {
+		return rates, fmt.Errorf("error parsing exchange-rate file: %s", err)
+	}
+	base, err := ParseCurrency(rates.Base)
+	if err != nil {
+		return rates, fmt.Errorf("exchange-rate file has an invalid base: %s", err)
+	}
+	normalized := make(map[string]Decimal, len(rates.Rates))
+	for code, rate := range rates.Rates {
+		currency, err := ParseCurrency(code)
+		if err != nil {
+			return rates, fmt.Errorf("exchange-rate file has an invalid rate: %s", err)
+		}
+		if rate.Sign() <= 0 {
+			return rates, fmt.Errorf("exchange-rate file has an invalid rate of %s: must be positive", currency)
+		}
+		normalized[currency.Code] = rate
+	}
+	rates.Base, rates.Rates = base.Code, normalized
+	return rates, nil
+}
+
+// rate returns how much of the currency is worth one unit of the base currency
+func (r ExchangeRates) rate(currency Currency) (Decimal, bool) {
+	if r.Base != "" && currency.Code == r.Base {
+		return NewDecimal(1, 0), true
+	}
+	rate, ok := r.Rates[currency.Code]
+	return rate, ok
+}
+
+// Convert converts the amount from a currency to another, through the base currency when
+// neither is the base. The result is rounded with the rule, in the currency it's converted to
+func (r ExchangeRates) Convert(amount Decimal, from, to Currency, rounding Rounding) (Decimal, error) {
+	if from.Code == to.Code {
+		return rounding.Round(amount, to), nil
+	}
+	fromRate, fromOk := r.rate(from)
+	toRate, toOk := r.rate(to)
+	if !fromOk || !toOk {
+		return Decimal{}, NoExchangeRateError{From: from, To: to}
+	}
+	scale := rounding.Scale
+	if scale < 0 {
+		scale = to.MinorUnits
+	}
+	// rounded once, after the exact multiplication, so converting through the base doesn't round twice
+	return amount.Mul(toRate).Quo(fromRate, scale, rounding.Mode), nil
+}
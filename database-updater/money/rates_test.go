@@ -0,0 +1,50 @@
+package money
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuo(t *testing.T) {
+	assert.Equal(t, "0.33", MustParseDecimal("1").Quo(MustParseDecimal("3"), 2, RoundHalfUp).String())
+	assert.Equal(t, "0.67", MustParseDecimal("2").Quo(MustParseDecimal("3"), 2, RoundHalfUp).String())
+	assert.Equal(t, "-0.67", MustParseDecimal("2").Quo(MustParseDecimal("-3"), 2, RoundHalfUp).String())
+	assert.Equal(t, "0.12", MustParseDecimal("0.25").Quo(MustParseDecimal("2"), 2, RoundHalfEven).String())
+	assert.Equal(t, "500", MustParseDecimal("5000").Quo(MustParseDecimal("10"), 0, RoundDown).String())
+	assert.Equal(t, "43.5114", MustParseDecimal("43.51").Mul(MustParseDecimal("1.0000")).Quo(MustParseDecimal("0.99997"), 4, RoundUp).String())
+}
+
+func TestExchangeRates(t *testing.T) {
+	ratesFile := filepath.Join(t.TempDir(), "rates.json")
+	ioutil.WriteFile(ratesFile, []byte(`{"base": "eur", "rates": {"sek": "11.4520", "JPY": "162.5"}}`), 0666)
+	rates, err := LoadExchangeRates(ratesFile)
+	assert.Nil(t, err)
+	eur, sek, jpy, usd := Currency{"EUR", 2}, Currency{"SEK", 2}, Currency{"JPY", 0}, Currency{"USD", 2}
+
+	// from and to the base, and between two other currencies through it
+	converted, err := rates.Convert(MustParseDecimal("43.51"), eur, sek, DefaultRounding)
+	assert.Nil(t, err)
+	assert.Equal(t, "498.28", converted.String())
+	converted, err = rates.Convert(MustParseDecimal("499"), sek, eur, DefaultRounding)
+	assert.Nil(t, err)
+	assert.Equal(t, "43.57", converted.String())
+	converted, err = rates.Convert(MustParseDecimal("499"), sek, jpy, DefaultRounding)
+	assert.Nil(t, err)
+	assert.Equal(t, "7081", converted.String())
+
+	_, err = rates.Convert(MustParseDecimal("10"), usd, eur, DefaultRounding)
+	assert.Equal(t, NoExchangeRateError{From: usd, To: eur}, err)
+
+	// without file there are no rates
+	rates, err = LoadExchangeRates("")
+	assert.Nil(t, err)
+	_, err = rates.Convert(MustParseDecimal("10"), sek, eur, DefaultRounding)
+	assert.NotNil(t, err)
+
+	ioutil.WriteFile(ratesFile, []byte(`{"base": "EUR", "rates": {"XYZ": "2"}}`), 0666)
+	_, err = LoadExchangeRates(ratesFile)
+	assert.Equal(t, `exchange-rate file has an invalid rate: unknown currency code "XYZ"`, err.Error())
+}
@@ -0,0 +1,75 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// RoundingMode tells which way the numbers are rounded when digits after the point are dropped
+type RoundingMode string
+
+// Modes of rounding, selected by the --priceRounding flag
+const (
+	// RoundHalfUp rounds to the nearest, and the ties away from zero: 0.125 is 0.13
+	RoundHalfUp RoundingMode = "half-up"
+	// RoundHalfEven rounds to the nearest, and the ties to the even digit (the bankers' rounding): 0.125 is 0.12
+	RoundHalfEven RoundingMode = "half-even"
+	// RoundDown drops the digits (towards zero): 0.129 is 0.12
+	RoundDown RoundingMode = "down"
+	// RoundUp rounds away from zero when some digit is dropped: 0.121 is 0.13
+	RoundUp RoundingMode = "up"
+)
+
+// RoundingModes are the accepted modes
+var RoundingModes = []RoundingMode{RoundHalfUp, RoundHalfEven, RoundDown, RoundUp}
+
+// ParseRoundingMode parses the name of a RoundingMode, like "half-up"
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	for _, mode := range RoundingModes {
+		if strings.EqualFold(strings.TrimSpace(name), string(mode)) {
+			return mode, nil
+		}
+	}
+	names := make([]string, len(RoundingModes))
+	for i, mode := range RoundingModes {
+		names[i] = string(mode)
+	}
+	return "", fmt.Errorf("invalid rounding mode %q. Must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// roundsAway tells whether the truncated quotient must move one unit away from zero, given
+// the remainder (not zero) of the division by the divisor
+func (m RoundingMode) roundsAway(quotient, remainder, divisor *big.Int) bool {
+	switch m {
+	case RoundDown:
+		return false
+	case RoundUp:
+		return true
+	}
+	// compare the remainder with the half of the divisor
+	half := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(divisor)
+	if m == RoundHalfEven && half == 0 {
+		return quotient.Bit(0) == 1
+	}
+	return half >= 0
+}
+
+// Rounding is the rule the prices are rounded with before they're written to the Warehouse
+type Rounding struct {
+	Mode RoundingMode
+	// Scale is how many digits after the point are kept. If negative, the minor units of the currency are kept
+	Scale int
+}
+
+// DefaultRounding rounds half up to the minor units of the currency, like the cents of EUR
+var DefaultRounding = Rounding{Mode: RoundHalfUp, Scale: -1}
+
+// Round rounds the amount of the currency with the rule
+func (r Rounding) Round(amount Decimal, currency Currency) Decimal {
+	scale := r.Scale
+	if scale < 0 {
+		scale = currency.MinorUnits
+	}
+	return amount.Round(scale, r.Mode)
+}
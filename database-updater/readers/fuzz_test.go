@@ -0,0 +1,33 @@
+package readers
+
+import (
+	"testing"
+)
+
+// FuzzReadWorkbook reads any content as the .xlsx file of an inventory and of the products: invalid
+// workbooks and cells must be errors, never a crash
+func FuzzReadWorkbook(f *testing.F) {
+	f.Add(buildWorkbook(f, map[string][][]string{
+		"Inventory": {
+			{"art_id", "name", "stock"},
+			{"1", "leg", "12"},
+			{"2", "screw", "seventeen"},
+		},
+	}, "Inventory"))
+	f.Add(buildWorkbook(f, map[string][][]string{
+		"Products": {
+			{"name", "price", "sku", "art_id", "amount_of"},
+			{"Dining Chair", "43.51", "CHAIR-01", "1", "4"},
+			{"", "", "", "2", "8"},
+		},
+	}, "Products"))
+	layout, err := LoadLayout("")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		ReadInventory(content, layout.Article)
+		ReadProducts(content, layout.Product)
+	})
+}
@@ -0,0 +1,315 @@
+package readers
+
+import (
+	"database-autoupdater/model"
+	"database-autoupdater/money"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Layout describes where the data of each domain is placed in a spreadsheet
+type Layout struct {
+	Article SheetLayout `json:"article"`
+	Product SheetLayout `json:"product"`
+}
+
+// SheetLayout describes the sheet and the columns where the fields of the incoming
+// model are. The Columns map has the incoming field name (the same used in the JSON
+// files, like `art_id`) as key and the column letter (`B`) or the header title as value
+type SheetLayout struct {
+	// Sheet is the sheet name. If empty, the first sheet of the workbook is used
+	Sheet string `json:"sheet"`
+	// HeaderRow is the row number with the column titles. Data starts on the next row
+	HeaderRow int               `json:"headerRow"`
+	Columns   map[string]string `json:"columns"`
+}
+
+// fields of the incoming files that can be mapped from spreadsheet columns
+var articleFields = []string{"op", "force", "art_id", "name", "stock", "unit", "location"}
+var productFields = []string{"op", "sku", "name", "price", "art_id", "amount_of"}
+
+// optionalFields can be missing from the spreadsheet
+var optionalFields = map[string]bool{"op": true, "force": true, "sku": true, "unit": true, "location": true}
+
+// CellError points to a cell of the spreadsheet that couldn't be read
+type CellError struct {
+	Ref     string
+	Message string
+}
+
+func (e CellError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Ref, e.Message)
+}
+
+// CellErrors holds all the problems found when reading a spreadsheet, so
+// all of them can be reported at once instead of one at a time
+type CellErrors []CellError
+
+func (e CellErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ce := range e {
+		msgs[i] = ce.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LoadLayout reads the layout configuration file. If no file is
+// provided, the default layout is returned
+func LoadLayout(layoutFile string) (Layout, error) {
+	layout := Layout{}
+	if layoutFile != "" {
+		content, err := ioutil.ReadFile(layoutFile)
+		if err != nil {
+			return layout, fmt.Errorf("error reading xlsx layout file: %s", err)
+		}
+		if err := json.Unmarshal(content, &layout); err != nil {
+			return layout, fmt.Errorf("error parsing xlsx layout file: %s", err)
+		}
+	}
+	layout.Article = layout.Article.withDefaults(articleFields)
+	layout.Product = layout.Product.withDefaults(productFields)
+	return layout, nil
+}
+
+// withDefaults fills the not configured values: header at first row and
+// columns with titles equal to the field names
+func (l SheetLayout) withDefaults(fields []string) SheetLayout {
+	if l.HeaderRow == 0 {
+		l.HeaderRow = 1
+	}
+	columns := map[string]string{}
+	for _, f := range fields {
+		columns[f] = f
+	}
+	for f, c := range l.Columns {
+		columns[f] = c
+	}
+	l.Columns = columns
+	return l
+}
+
+// ReadInventory reads the Articles from an .xlsx file, one Article per row
+func ReadInventory(content []byte, layout SheetLayout) (model.Inventory, error) {
+	inventory := model.Inventory{Inventory: []model.ArticleIncoming{}}
+
+	sheet, columns, err := openSheet(content, layout, articleFields)
+	if err != nil {
+		return inventory, err
+	}
+
+	var cellErrors CellErrors
+	for row := layout.HeaderRow + 1; row <= sheet.MaxRow; row++ {
+		if isEmptyRow(sheet, columns, row) {
+			continue
+		}
+		article := model.ArticleIncoming{
+			Op:       sheet.Cell(columns["op"], row),
+			Force:    sheet.Cell(columns["force"], row),
+			ArtId:    sheet.Cell(columns["art_id"], row),
+			Name:     sheet.Cell(columns["name"], row),
+			Stock:    sheet.Cell(columns["stock"], row),
+			Unit:     sheet.Cell(columns["unit"], row),
+			Location: sheet.Cell(columns["location"], row),
+		}
+		// a tombstone record needs only the identification
+		if article.Operation() == model.OperationDelete {
+			cellErrors = append(cellErrors, checkRequired(sheet, columns, row, "art_id")...)
+			cellErrors = append(cellErrors, checkInteger(sheet, columns, row, "art_id")...)
+		} else {
+			cellErrors = append(cellErrors, checkRequired(sheet, columns, row, "art_id", "name", "stock")...)
+			cellErrors = append(cellErrors, checkInteger(sheet, columns, row, "art_id", "stock")...)
+		}
+		inventory.Inventory = append(inventory.Inventory, article)
+	}
+
+	if len(cellErrors) > 0 {
+		return inventory, cellErrors
+	}
+	return inventory, nil
+}
+
+// ReadProducts reads the Products from an .xlsx file. The composition of a Product
+// can span multiple rows: the first row has the Product name and price and the following
+// rows with the name empty (or repeated) add more Articles to the same Product
+func ReadProducts(content []byte, layout SheetLayout) (model.IncomingProducts, error) {
+	products := model.IncomingProducts{Products: []model.ProductIncoming{}}
+
+	sheet, columns, err := openSheet(content, layout, productFields)
+	if err != nil {
+		return products, err
+	}
+
+	var cellErrors CellErrors
+	var current *model.ProductIncoming
+	for row := layout.HeaderRow + 1; row <= sheet.MaxRow; row++ {
+		if isEmptyRow(sheet, columns, row) {
+			continue
+		}
+		name := sheet.Cell(columns["name"], row)
+		price := sheet.Cell(columns["price"], row)
+
+		// a row with a new name starts a new Product
+		if name != "" && (current == nil || current.Name != name) {
+			products.Products = append(products.Products, model.ProductIncoming{
+				Op:              sheet.Cell(columns["op"], row),
+				Sku:             sheet.Cell(columns["sku"], row),
+				Name:            name,
+				Price:           price,
+				ContainArticles: []model.ProductArticleIncoming{},
+			})
+			current = &products.Products[len(products.Products)-1]
+			// a tombstone record needs only the name (or SKU)
+			if current.Operation() != model.OperationDelete {
+				cellErrors = append(cellErrors, checkRequired(sheet, columns, row, "price")...)
+			}
+			cellErrors = append(cellErrors, checkAmount(sheet, columns, row, "price")...)
+		} else if current == nil {
+			cellErrors = append(cellErrors, CellError{sheet.Ref(columns["name"], row), "missing product name"})
+			continue
+		} else if price != "" && !samePrice(price, current.Price) {
+			cellErrors = append(cellErrors, CellError{sheet.Ref(columns["price"], row), fmt.Sprintf("price %q differs from the price %q of the product %q", price, current.Price, current.Name)})
+		}
+
+		// each row can have one Article of the Product composition
+		artID := sheet.Cell(columns["art_id"], row)
+		amountOf := sheet.Cell(columns["amount_of"], row)
+		if artID == "" && amountOf == "" {
+			continue
+		}
+		cellErrors = append(cellErrors, checkRequired(sheet, columns, row, "art_id", "amount_of")...)
+		cellErrors = append(cellErrors, checkInteger(sheet, columns, row, "art_id", "amount_of")...)
+		current.ContainArticles = append(current.ContainArticles, model.ProductArticleIncoming{
+			ArtId:    artID,
+			AmountOf: amountOf,
+		})
+	}
+
+	if len(cellErrors) > 0 {
+		return products, cellErrors
+	}
+	return products, nil
+}
+
+// openSheet parses the workbook, finds the sheet of the layout and resolves
+// the column letter of each field
+func openSheet(content []byte, layout SheetLayout, fields []string) (*Sheet, map[string]string, error) {
+	workbook, err := ParseWorkbook(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sheetName := layout.Sheet
+	if sheetName == "" {
+		if len(workbook.SheetNames) == 0 {
+			return nil, nil, fmt.Errorf("the xlsx file has no sheets")
+		}
+		sheetName = workbook.SheetNames[0]
+	}
+	sheet := workbook.Sheet(sheetName)
+	if sheet == nil {
+		return nil, nil, fmt.Errorf("sheet %q not found in the xlsx file", sheetName)
+	}
+
+	columns := map[string]string{}
+	var cellErrors CellErrors
+	for _, field := range fields {
+		column, ok := resolveColumn(sheet, layout.HeaderRow, layout.Columns[field])
+		if !ok && optionalFields[field] {
+			continue
+		}
+		if !ok {
+			cellErrors = append(cellErrors, CellError{fmt.Sprintf("%s!%d:%d", sheet.Name, layout.HeaderRow, layout.HeaderRow), fmt.Sprintf("no column with header %q for field %q", layout.Columns[field], field)})
+			continue
+		}
+		columns[field] = column
+	}
+	if len(cellErrors) > 0 {
+		return nil, nil, cellErrors
+	}
+	return sheet, columns, nil
+}
+
+// resolveColumn returns the column letter for the configured value: the column with the header
+// title equal to the value or, if no header has it, the value as a column letter. The titles are
+// matched first, so titles that look like letters (`ID`, `SKU`, `QTY`) are found by their header
+func resolveColumn(sheet *Sheet, headerRow int, value string) (string, bool) {
+	for _, column := range sheet.columnsOf(headerRow) {
+		if strings.EqualFold(sheet.Cell(column, headerRow), value) {
+			return column, true
+		}
+	}
+	if IsColumnLetter(value) {
+		return value, true
+	}
+	return "", false
+}
+
+// columnsOf lists the column letters that have values at the given row
+func (s *Sheet) columnsOf(row int) []string {
+	columns := []string{}
+	for column := range s.cells[row] {
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func isEmptyRow(sheet *Sheet, columns map[string]string, row int) bool {
+	for _, column := range columns {
+		if sheet.Cell(column, row) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func checkRequired(sheet *Sheet, columns map[string]string, row int, fields ...string) CellErrors {
+	var cellErrors CellErrors
+	for _, f := range fields {
+		if sheet.Cell(columns[f], row) == "" {
+			cellErrors = append(cellErrors, CellError{sheet.Ref(columns[f], row), fmt.Sprintf("missing %s", f)})
+		}
+	}
+	return cellErrors
+}
+
+func checkInteger(sheet *Sheet, columns map[string]string, row int, fields ...string) CellErrors {
+	var cellErrors CellErrors
+	for _, f := range fields {
+		value := sheet.Cell(columns[f], row)
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			cellErrors = append(cellErrors, CellError{sheet.Ref(columns[f], row), fmt.Sprintf("invalid %s %q: must be an integer", f, value)})
+		}
+	}
+	return cellErrors
+}
+
+// checkAmount checks the cells of amounts, like the prices, which are decimal numbers with an optional currency code (e.g.: 43.51 EUR)
+func checkAmount(sheet *Sheet, columns map[string]string, row int, fields ...string) CellErrors {
+	var cellErrors CellErrors
+	for _, f := range fields {
+		value := sheet.Cell(columns[f], row)
+		if value == "" {
+			continue
+		}
+		if _, _, err := money.ParseAmount(value); err != nil {
+			cellErrors = append(cellErrors, CellError{sheet.Ref(columns[f], row), fmt.Sprintf("invalid %s %q: must be a number", f, value)})
+		}
+	}
+	return cellErrors
+}
+
+// samePrice tells whether the prices of two rows are the same, comparing the amounts exactly: 43.5 and 43.50 are the same price
+func samePrice(a, b string) bool {
+	amountA, codeA, errA := money.ParseAmount(a)
+	amountB, codeB, errB := money.ParseAmount(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return amountA.Equal(amountB) && codeA == codeB
+}
@@ -0,0 +1,274 @@
+package readers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Workbook represents the sheets of an Excel (.xlsx) file with the
+// cell values already resolved to their text representation
+type Workbook struct {
+	SheetNames []string
+	sheets     map[string]*Sheet
+}
+
+// Sheet represents a single worksheet of a Workbook, indexed by row number
+// and column letter, like Excel does (e.g.: row 3, column "B" = cell B3)
+type Sheet struct {
+	Name  string
+	cells map[int]map[string]string
+	// MaxRow is the highest row number that has at least one value
+	MaxRow int
+}
+
+// Cell returns the text value of the cell at the given column and row.
+// Empty cells return an empty string
+func (s *Sheet) Cell(column string, row int) string {
+	if r, ok := s.cells[row]; ok {
+		return r[column]
+	}
+	return ""
+}
+
+// Ref returns the Excel reference of a cell in the format `Sheet!B3`, used to
+// point the user to the exact cell when reporting problems
+func (s *Sheet) Ref(column string, row int) string {
+	return fmt.Sprintf("%s!%s%d", s.Name, column, row)
+}
+
+// Sheet returns the sheet with the given name or nil if the workbook doesn't have it
+func (w *Workbook) Sheet(name string) *Sheet {
+	return w.sheets[name]
+}
+
+// XML structures of the parts of the .xlsx package we need to read
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xlsxRichText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.Text
+	}
+	var sb strings.Builder
+	for _, r := range rt.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref       string        `xml:"r,attr"`
+			Type      string        `xml:"t,attr"`
+			Value     string        `xml:"v"`
+			InlineStr *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ParseWorkbook reads the content of an .xlsx file and resolves all the cell
+// values of all sheets. Only the values are read: styles, formulas and
+// formatting are ignored
+func ParseWorkbook(content []byte) (*Workbook, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %s", err)
+	}
+
+	// index the files of the package by name
+	parts := map[string]*zip.File{}
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := decodePart(parts, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decodePart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	// shared strings are optional: a workbook with numbers only doesn't have it
+	var sst xlsxSharedStrings
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(parts, "xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+
+	targets := map[string]string{}
+	for _, r := range rels.Relationships {
+		// targets can be relative to the `xl` folder or absolute in the package
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.ID] = path.Join("xl", r.Target)
+		}
+	}
+
+	workbook := &Workbook{sheets: map[string]*Sheet{}}
+	for _, s := range wb.Sheets {
+		target, ok := targets[s.RID]
+		if !ok {
+			return nil, fmt.Errorf("invalid xlsx file: sheet %q has no relationship", s.Name)
+		}
+		var ws xlsxWorksheet
+		if err := decodePart(parts, target, &ws); err != nil {
+			return nil, err
+		}
+
+		sheet := &Sheet{Name: s.Name, cells: map[int]map[string]string{}}
+		for _, row := range ws.Rows {
+			for _, c := range row.Cells {
+				column, rowNumber, err := SplitCellRef(c.Ref)
+				if err != nil {
+					return nil, fmt.Errorf("invalid xlsx file: sheet %q: %s", s.Name, err)
+				}
+				value, err := cellValue(c.Type, c.Value, c.InlineStr, sst)
+				if err != nil {
+					return nil, fmt.Errorf("invalid xlsx file: %s: %s", sheet.Ref(column, rowNumber), err)
+				}
+				if value == "" {
+					continue
+				}
+				if sheet.cells[rowNumber] == nil {
+					sheet.cells[rowNumber] = map[string]string{}
+				}
+				sheet.cells[rowNumber][column] = value
+				if rowNumber > sheet.MaxRow {
+					sheet.MaxRow = rowNumber
+				}
+			}
+		}
+		workbook.SheetNames = append(workbook.SheetNames, s.Name)
+		workbook.sheets[s.Name] = sheet
+	}
+
+	return workbook, nil
+}
+
+// SplitCellRef splits a cell reference like `AB12` into its column (`AB`) and row (12)
+func SplitCellRef(ref string) (string, int, error) {
+	i := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		i++
+	}
+	if i == 0 || i == len(ref) {
+		return "", 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if err != nil || row < 1 {
+		return "", 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return ref[:i], row, nil
+}
+
+// IsColumnLetter checks whether the value is a column reference like `A` or `AB`
+func IsColumnLetter(value string) bool {
+	if value == "" || len(value) > 3 {
+		return false
+	}
+	for _, ch := range value {
+		if ch < 'A' || ch > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnLetter returns the letter of the column at the zero based index (0 = A, 26 = AA)
+func ColumnLetter(index int) string {
+	letter := ""
+	for index >= 0 {
+		letter = string(rune('A'+index%26)) + letter
+		index = index/26 - 1
+	}
+	return letter
+}
+
+// cellValue resolves the text of a cell based on its type
+func cellValue(cellType, value string, inline *xlsxRichText, sst xlsxSharedStrings) (string, error) {
+	switch cellType {
+	case "s":
+		// shared string: the value is the index at the shared strings table
+		idx, err := strconv.Atoi(value)
+		if err != nil || idx < 0 || idx >= len(sst.Items) {
+			return "", fmt.Errorf("invalid shared string index %q", value)
+		}
+		return strings.TrimSpace(sst.Items[idx].String()), nil
+	case "inlineStr":
+		if inline == nil {
+			return "", nil
+		}
+		return strings.TrimSpace(inline.String()), nil
+	case "e":
+		return "", fmt.Errorf("cell has an error value %s", value)
+	case "", "n":
+		// numbers are stored as doubles, so "43.51" can be written as
+		// "43.509999999999998". Format back to the shortest representation
+		if value == "" {
+			return "", nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	default:
+		// "str" (formula result) and "b" (boolean) are kept as they are
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// decodePart unmarshals the XML file of the package with the given name
+func decodePart(parts map[string]*zip.File, name string, v interface{}) error {
+	f, ok := parts[name]
+	if !ok {
+		return fmt.Errorf("invalid xlsx file: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("invalid xlsx file: error opening %s: %s", name, err)
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("invalid xlsx file: error reading %s: %s", name, err)
+	}
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("invalid xlsx file: error parsing %s: %s", name, err)
+	}
+	return nil
+}
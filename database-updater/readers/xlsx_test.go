@@ -0,0 +1,182 @@
+package readers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildWorkbook creates the content of a minimal .xlsx file with one sheet per
+// entry. Each row is a list of values starting at column A. Numeric values
+// are written as numbers and the others as shared strings
+func buildWorkbook(t testing.TB, sheets map[string][][]string, order ...string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	write := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+
+	sharedStrings := []string{}
+	workbookSheets := ""
+	rels := ""
+	for i, name := range order {
+		workbookSheets += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, i+1, i+1)
+		rels += fmt.Sprintf(`<Relationship Id="rId%d" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+
+		sheetData := ""
+		for r, row := range sheets[name] {
+			sheetData += fmt.Sprintf(`<row r="%d">`, r+1)
+			for c, value := range row {
+				ref := fmt.Sprintf("%s%d", ColumnLetter(c), r+1)
+				if value == "" {
+					continue
+				}
+				if _, err := strconv.ParseFloat(value, 64); err == nil {
+					sheetData += fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, value)
+				} else {
+					sheetData += fmt.Sprintf(`<c r="%s" t="s"><v>%d</v></c>`, ref, len(sharedStrings))
+					sharedStrings = append(sharedStrings, value)
+				}
+			}
+			sheetData += `</row>`
+		}
+		write(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), `<worksheet><sheetData>`+sheetData+`</sheetData></worksheet>`)
+	}
+
+	write("xl/workbook.xml", `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`+workbookSheets+`</sheets></workbook>`)
+	write("xl/_rels/workbook.xml.rels", `<Relationships>`+rels+`</Relationships>`)
+	sst := ""
+	for _, s := range sharedStrings {
+		sst += `<si><t>` + s + `</t></si>`
+	}
+	write("xl/sharedStrings.xml", `<sst>`+sst+`</sst>`)
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadInventory(t *testing.T) {
+	content := buildWorkbook(t, map[string][][]string{
+		"Inventory": {
+			{"art_id", "name", "stock"},
+			{"1", "leg", "12"},
+			{"2", "screw", "17"},
+			{},
+			{"3", "seat", "2"},
+		},
+	}, "Inventory")
+
+	layout, err := LoadLayout("")
+	assert.Nil(t, err)
+
+	inventory, err := ReadInventory(content, layout.Article)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(inventory.Inventory))
+	assert.Equal(t, "screw", inventory.Inventory[1].Name)
+	assert.Equal(t, "17", inventory.Inventory[1].Stock)
+	assert.Equal(t, "3", inventory.Inventory[2].ArtId)
+}
+
+func TestReadInventoryWithBadCells(t *testing.T) {
+	content := buildWorkbook(t, map[string][][]string{
+		"Stock": {
+			{"Name", "Code", "Quantity"},
+			{"leg", "1", "twelve"},
+			{"screw", "", "17"},
+		},
+	}, "Stock")
+
+	layout := SheetLayout{Sheet: "Stock", Columns: map[string]string{"art_id": "Code", "name": "A", "stock": "Quantity"}}.withDefaults(articleFields)
+	_, err := ReadInventory(content, layout)
+
+	cellErrors, ok := err.(CellErrors)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(cellErrors))
+	assert.Equal(t, "Stock!C2", cellErrors[0].Ref)
+	assert.Equal(t, "Stock!B3", cellErrors[1].Ref)
+}
+
+func TestReadInventoryWithLetterLikeHeaders(t *testing.T) {
+	content := buildWorkbook(t, map[string][][]string{
+		"Stock": {
+			{"QTY", "Name", "ID"},
+			{"12", "leg", "1"},
+		},
+	}, "Stock")
+
+	// the titles that look like column letters are found by their header, and the letters are still columns
+	layout := SheetLayout{Sheet: "Stock", Columns: map[string]string{"art_id": "ID", "name": "B", "stock": "QTY"}}.withDefaults(articleFields)
+	inventory, err := ReadInventory(content, layout)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", inventory.Inventory[0].ArtId)
+	assert.Equal(t, "leg", inventory.Inventory[0].Name)
+	assert.Equal(t, "12", inventory.Inventory[0].Stock)
+}
+
+func TestReadProducts(t *testing.T) {
+	content := buildWorkbook(t, map[string][][]string{
+		"Notes": {{"nothing here"}},
+		"BOM": {
+			{"name", "price", "art_id", "amount_of"},
+			{"Dining Chair", "43.51", "1", "4"},
+			{"", "", "2", "8"},
+			{"Dining Chair", "43.510", "3", "1"},
+			{"Dinning Table", "111.99 EUR", "1", "4"},
+			{"", "EUR 111.99", "4", "1"},
+		},
+	}, "Notes", "BOM")
+
+	layout, err := LoadLayout("")
+	assert.Nil(t, err)
+	layout.Product.Sheet = "BOM"
+
+	products, err := ReadProducts(content, layout.Product)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(products.Products))
+	assert.Equal(t, "43.51", products.Products[0].Price)
+	assert.Equal(t, 3, len(products.Products[0].ContainArticles))
+	assert.Equal(t, "8", products.Products[0].ContainArticles[1].AmountOf)
+	assert.Equal(t, 2, len(products.Products[1].ContainArticles))
+	assert.Equal(t, "4", products.Products[1].ContainArticles[1].ArtId)
+	// the prices of the rows of a Product are compared exactly, with their currency code
+	assert.Equal(t, "111.99 EUR", products.Products[1].Price)
+}
+
+func TestReadProductsWithBadCells(t *testing.T) {
+	content := buildWorkbook(t, map[string][][]string{
+		"BOM": {
+			{"name", "price", "art_id", "amount_of"},
+			{"", "", "1", "4"},
+			{"Dining Chair", "cheap", "1", "4"},
+			{"", "50", "2", ""},
+		},
+	}, "BOM")
+
+	layout, err := LoadLayout("")
+	assert.Nil(t, err)
+
+	_, err = ReadProducts(content, layout.Product)
+	assert.Equal(t, "BOM!A2: missing product name; BOM!B3: invalid price \"cheap\": must be a number; BOM!B4: price \"50\" differs from the price \"cheap\" of the product \"Dining Chair\"; BOM!D4: missing amount_of", err.Error())
+}
+
+func TestColumnLetter(t *testing.T) {
+	assert.Equal(t, "A", ColumnLetter(0))
+	assert.Equal(t, "Z", ColumnLetter(25))
+	assert.Equal(t, "AA", ColumnLetter(26))
+	assert.Equal(t, "AB", ColumnLetter(27))
+
+	column, row, err := SplitCellRef("AB12")
+	assert.Nil(t, err)
+	assert.Equal(t, "AB", column)
+	assert.Equal(t, 12, row)
+}
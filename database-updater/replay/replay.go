@@ -0,0 +1,344 @@
+package replay
+
+import (
+	"bytes"
+	"database-autoupdater/checksums"
+	"database-autoupdater/encryption"
+	"database-autoupdater/globals"
+	"database-autoupdater/reports"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Action taken for a file of the fail folder selected by the filters
+const (
+	ActionReplayed = "replayed"
+	ActionPlanned  = "planned"
+	ActionSkipped  = "skipped"
+)
+
+// tempPrefix names the partial files while they are written, so they are not taken as failed files
+const tempPrefix = ".replay-"
+
+// Options selects the failed files to replay. The zero value of each filter disables it
+type Options struct {
+	IncomingFolder string
+	FailFolder     string
+	// Domain is the first folder of the file (`article`, `product`, ...) or the domain of its report
+	Domain string
+	// OlderThan selects the files that failed at least this long ago
+	OlderThan time.Duration
+	// NewerThan selects the files that failed at most this long ago
+	NewerThan time.Duration
+	// ErrorContains selects the files whose error (or the error of some record) has this text, ignoring case
+	ErrorContains string
+	// OnlyFailedRecords replays only the records that were rejected or skipped according to the report
+	// of the file, so the records already applied are not applied twice. Without it, the order and stock movement
+	// files with records already applied are skipped
+	OnlyFailedRecords bool
+	// DryRun lists the files that would be replayed without moving them
+	DryRun bool
+}
+
+// repeatable are the domains whose records can be applied twice without changing the outcome: the
+// Articles and Products are written with absolute values. The stock movements (without `movement_id`)
+// and the sales orders change the stock each time, so their files with applied records are only
+// replayed with OnlyFailedRecords
+var repeatable = map[string]bool{"article": true, "product": true}
+
+// Entry is the outcome of the replay of a single failed file
+type Entry struct {
+	// File is the path of the file relative to the fail folder
+	File   string `json:"file"`
+	Domain string `json:"domain"`
+	Action string `json:"action"`
+	// Records is how many records were replayed, when only the failed records are
+	Records int    `json:"records,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Run moves the failed files selected by the options back to the incoming folder, at the same
+// relative path and with the name they had, so the watchers process them again. The report of each replayed file is removed
+func Run(options Options) ([]Entry, error) {
+	entries := []Entry{}
+	now := time.Now()
+
+	// the files are listed first, because replaying them changes the fail folder
+	paths := []string{}
+	err := filepath.Walk(options.FailFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !reports.IsReport(path) && !checksums.IsChecksumFile(path) && !encryption.IsSignature(path) && !strings.HasPrefix(info.Name(), tempPrefix) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return entries, fmt.Errorf("error listing the failed files at %s: %s", options.FailFolder, err)
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(options.FailFolder, path)
+		if err != nil {
+			return entries, err
+		}
+
+		report, err := reports.Read(path + reports.Suffix)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Ignoring the report of the failed file %s. Details: %s", path, err)
+		}
+		if err != nil {
+			report = nil
+		}
+
+		domain := domainOf(options.IncomingFolder, rel, report)
+		failedAt := info.ModTime()
+		if report != nil {
+			failedAt = report.ProcessedAt
+		}
+		if !selected(options, domain, now.Sub(failedAt), report) {
+			continue
+		}
+
+		entry := replayFile(options, path, rel, domain, report)
+		logrus.Infof("Replay of the failed file %s: %s %s", rel, entry.Action, entry.Reason)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// domainOf resolves the domain of a failed file by its report, the mapping of its folder
+// or, at last, the first folder of its path
+func domainOf(incomingFolder, rel string, report *reports.Report) string {
+	if report != nil && report.Domain != "" {
+		return report.Domain
+	}
+	if mapping := globals.Mappings.ForFile(incomingFolder, filepath.Join(incomingFolder, rel)); mapping != nil {
+		return mapping.Domain
+	}
+	return strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+}
+
+// selected tells whether the failed file matches all the filters
+func selected(options Options, domain string, age time.Duration, report *reports.Report) bool {
+	if options.Domain != "" && options.Domain != domain {
+		return false
+	}
+	if options.OlderThan > 0 && age < options.OlderThan {
+		return false
+	}
+	if options.NewerThan > 0 && age > options.NewerThan {
+		return false
+	}
+	if options.ErrorContains == "" {
+		return true
+	}
+	// without report, the error of the file is unknown
+	if report == nil {
+		return false
+	}
+	text := strings.ToLower(options.ErrorContains)
+	if strings.Contains(strings.ToLower(report.Error), text) {
+		return true
+	}
+	for _, r := range report.Rejected() {
+		if strings.Contains(strings.ToLower(r.Message), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayFile moves the failed file (or only its failed records) to the incoming folder. The file
+// gets back the name it was received with, told by its report, instead of its unique processed name
+func replayFile(options Options, path, rel, domain string, report *reports.Report) Entry {
+	entry := Entry{File: filepath.ToSlash(rel), Domain: domain}
+	destination := filepath.Join(options.IncomingFolder, rel)
+	if report != nil && report.File != "" {
+		destination = filepath.Join(options.IncomingFolder, filepath.Dir(rel), report.File)
+	}
+
+	if _, err := os.Stat(destination); err == nil {
+		entry.Action = ActionSkipped
+		entry.Reason = "a file with the same name is waiting at the incoming folder"
+		return entry
+	}
+
+	// the whole file is replayed if no record of it reached the Warehouse or they can be applied again
+	if !options.OnlyFailedRecords && report != nil && hasApplied(report) && !repeatable[domain] {
+		entry.Action = ActionSkipped
+		entry.Reason = "some records were already applied and would be applied twice. Replay only the failed records instead"
+		return entry
+	}
+	var content []byte
+	if options.OnlyFailedRecords && report != nil && hasApplied(report) {
+		if !strings.EqualFold(filepath.Ext(path), ".json") {
+			entry.Action = ActionSkipped
+			entry.Reason = "only the failed records of JSON files can be replayed"
+			return entry
+		}
+		var err error
+		content, entry.Records, err = failedRecords(options.IncomingFolder, destination, domain, path, report)
+		if err != nil {
+			entry.Action = ActionSkipped
+			entry.Reason = err.Error()
+			return entry
+		}
+	}
+
+	if options.DryRun {
+		entry.Action = ActionPlanned
+		return entry
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0777); err != nil {
+		entry.Action = ActionSkipped
+		entry.Reason = fmt.Sprintf("error creating the incoming folder: %s", err)
+		return entry
+	}
+
+	source := path
+	if content != nil {
+		// written aside first, so the watcher never sees a half written file
+		source = filepath.Join(filepath.Dir(path), tempPrefix+filepath.Base(path))
+		if err := ioutil.WriteFile(source, content, 0666); err != nil {
+			entry.Action = ActionSkipped
+			entry.Reason = fmt.Sprintf("error writing the failed records: %s", err)
+			return entry
+		}
+	}
+	// a file that passed the checksum verification gets a sidecar, so it's verified again (and not
+	// rejected if the checksum is required) at the incoming folder
+	if report != nil && report.Checksum != nil && report.Checksum.Actual == report.Checksum.Expected {
+		replayed, err := ioutil.ReadFile(source)
+		if err == nil {
+			err = checksums.WriteSidecar(destination, replayed)
+		}
+		if err != nil {
+			logrus.Warnf("Error writing the checksum of the replayed file %s. Details: %s", destination, err)
+		}
+	}
+	// the signature of an encrypted file goes back before it, so it's found when the file arrives
+	signed := false
+	if _, err := os.Stat(path + encryption.SignatureSuffix); err == nil {
+		signed = os.Rename(path+encryption.SignatureSuffix, destination+encryption.SignatureSuffix) == nil
+	}
+	if err := os.Rename(source, destination); err != nil {
+		if signed {
+			os.Rename(destination+encryption.SignatureSuffix, path+encryption.SignatureSuffix)
+		}
+		os.Remove(destination + checksums.Suffix)
+		os.Remove(filepath.Join(filepath.Dir(path), tempPrefix+filepath.Base(path)))
+		entry.Action = ActionSkipped
+		entry.Reason = fmt.Sprintf("error moving the file to the incoming folder: %s", err)
+		return entry
+	}
+	if content != nil {
+		os.Remove(path)
+	}
+	os.Remove(path + reports.Suffix)
+	entry.Action = ActionReplayed
+	return entry
+}
+
+// hasApplied tells whether some record of the file reached the Warehouse
+func hasApplied(report *reports.Report) bool {
+	for _, r := range report.Records {
+		if r.Status == reports.RecordApplied || r.Status == reports.RecordFulfilled || r.Status == reports.RecordAlreadyApplied {
+			return true
+		}
+	}
+	return false
+}
+
+// failedRecords rewrites the content of the file keeping only the records that were
+// rejected or skipped. The list of records is found like the handlers do: at the root
+// of the mapping of the folder or at the list of the standard incoming file
+func failedRecords(incomingFolder, destination, domain, path string, report *reports.Report) ([]byte, int, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading the failed file: %s", err)
+	}
+	root := globals.Mappings.RecordsRoot(incomingFolder, destination, domain)
+
+	failed := map[int]bool{}
+	for _, r := range report.Records {
+		if r.Status == reports.RecordRejected || r.Status == reports.RecordSkipped {
+			failed[r.Index] = true
+		}
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, 0, fmt.Errorf("error decoding the failed file: %s", err)
+	}
+	records, set, err := recordsAt(document, root)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(records) != len(report.Records) {
+		return nil, 0, fmt.Errorf("the file has %d records and its report has %d", len(records), len(report.Records))
+	}
+
+	kept := []interface{}{}
+	for i, record := range records {
+		if failed[i+1] {
+			kept = append(kept, record)
+		}
+	}
+	document = set(kept)
+
+	content, err = json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, 0, fmt.Errorf("error encoding the failed records: %s", err)
+	}
+	return content, len(kept), nil
+}
+
+// recordsAt finds the list of records at the dot separated path of the document. It returns
+// a function that replaces the list, giving back the changed document
+func recordsAt(document interface{}, path string) ([]interface{}, func([]interface{}) interface{}, error) {
+	if path == "" {
+		records, ok := document.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("the failed file is not a list of records")
+		}
+		return records, func(kept []interface{}) interface{} { return kept }, nil
+	}
+
+	keys := strings.Split(path, ".")
+	parent := document
+	for _, key := range keys[:len(keys)-1] {
+		obj, ok := parent.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("no list of records at %q of the failed file", path)
+		}
+		parent = obj[key]
+	}
+	obj, ok := parent.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("no list of records at %q of the failed file", path)
+	}
+	last := keys[len(keys)-1]
+	records, ok := obj[last].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("no list of records at %q of the failed file", path)
+	}
+	return records, func(kept []interface{}) interface{} {
+		obj[last] = kept
+		return document
+	}, nil
+}
@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"database-autoupdater/reports"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFailed places a failed file with its report at the fail folder
+func writeFailed(t *testing.T, failFolder, rel, content string, report *reports.Report) {
+	path := filepath.Join(failFolder, rel)
+	os.MkdirAll(filepath.Dir(path), 0777)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	if report != nil {
+		_, err := reports.Write(path, report)
+		assert.Nil(t, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	baseFolder := t.TempDir()
+	incomingFolder := filepath.Join(baseFolder, "incoming")
+	failFolder := filepath.Join(baseFolder, "fail")
+
+	// an order file with the second line rejected, after the first was fulfilled
+	orders := reports.New("orders.json", "order")
+	orders.Add(1, reports.RecordFulfilled, "")
+	orders.Add(2, reports.RecordRejected, "error updating the stock: connection refused")
+	orders.Finish(nil)
+	writeFailed(t, failFolder, "order/orders.20211001T120000Z.3fa2b1c49d0e.json", `{"orders": [{"product": "1", "quantity": "1"}, {"product": "2", "quantity": "3"}]}`, orders)
+
+	// an inventory file that failed a day ago and a products file without report
+	inventory := reports.New("inventory.json", "article")
+	inventory.Finish(os.ErrNotExist)
+	inventory.ProcessedAt = time.Now().Add(-24 * time.Hour)
+	writeFailed(t, failFolder, "article/inventory.json", `{"inventory": []}`, inventory)
+	writeFailed(t, failFolder, "product/products.json", `{"products": []}`, nil)
+
+	// the filters select the files, without moving them in dry run
+	entries, err := Run(Options{IncomingFolder: incomingFolder, FailFolder: failFolder, OlderThan: time.Hour, DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []Entry{{File: "article/inventory.json", Domain: "article", Action: ActionPlanned}}, entries)
+
+	entries, err = Run(Options{IncomingFolder: incomingFolder, FailFolder: failFolder, ErrorContains: "Connection Refused", DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "order/orders.20211001T120000Z.3fa2b1c49d0e.json", entries[0].File)
+
+	// the whole order file would consume the stock of the fulfilled line twice
+	entries, err = Run(Options{IncomingFolder: incomingFolder, FailFolder: failFolder, Domain: "order"})
+	assert.Nil(t, err)
+	assert.Equal(t, ActionSkipped, entries[0].Action)
+	_, err = os.Stat(filepath.Join(incomingFolder, "order/orders.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// only the rejected order line goes back to the incoming folder, with the name it was received with
+	entries, err = Run(Options{IncomingFolder: incomingFolder, FailFolder: failFolder, Domain: "order", OnlyFailedRecords: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []Entry{{File: "order/orders.20211001T120000Z.3fa2b1c49d0e.json", Domain: "order", Action: ActionReplayed, Records: 1}}, entries)
+
+	content, err := ioutil.ReadFile(filepath.Join(incomingFolder, "order/orders.json"))
+	assert.Nil(t, err)
+	var replayed map[string][]map[string]string
+	assert.Nil(t, json.Unmarshal(content, &replayed))
+	assert.Equal(t, []map[string]string{{"product": "2", "quantity": "3"}}, replayed["orders"])
+
+	_, err = os.Stat(filepath.Join(failFolder, "order/orders.20211001T120000Z.3fa2b1c49d0e.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(failFolder, "order/orders.20211001T120000Z.3fa2b1c49d0e.json"+reports.Suffix))
+	assert.True(t, os.IsNotExist(err))
+
+	// the other files are replayed as they are
+	entries, err = Run(Options{IncomingFolder: incomingFolder, FailFolder: failFolder})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	_, err = os.Stat(filepath.Join(incomingFolder, "product/products.json"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,167 @@
+package reports
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Suffix is appended to the name of the processed file to name its report
+const Suffix = ".report.json"
+
+// Status of the processing of a whole file
+const (
+	StatusSuccess = "success"
+	StatusPartial = "partial"
+	StatusFail    = "fail"
+)
+
+// Status of the processing of a single record of the file
+const (
+	RecordApplied   = "applied"
+	RecordFulfilled = "fulfilled"
+	RecordRejected  = "rejected"
+	RecordSkipped   = "skipped"
+	// RecordAlreadyApplied is a record that was applied before, by another file or another receipt of the file
+	RecordAlreadyApplied = "already_applied"
+	// RecordValid and RecordPlanned are the outcome of the checks that don't change the Warehouse
+	RecordValid   = "valid"
+	RecordPlanned = "planned"
+)
+
+// Report summarizes the outcome of the processing of an incoming file, record by
+// record. It's written next to the file in the success or fail folder
+type Report struct {
+	// File is the name the file was received with
+	File string `json:"file"`
+	// Path is where the file was moved to once processed, under a unique name
+	Path   string `json:"path,omitempty"`
+	Domain string `json:"domain"`
+	// Folder and Supplier tell where the file was placed, relative to the incoming data folder
+	Folder      string    `json:"folder,omitempty"`
+	Supplier    string    `json:"supplier,omitempty"`
+	ProcessedAt time.Time `json:"processedAt"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Records     []Record  `json:"records"`
+	Sync        *Sync     `json:"sync,omitempty"`
+	Checksum    *Checksum `json:"checksum,omitempty"`
+	// Encryption is how the file was encrypted (`age` or `gpg`) and Signer the allow-listed key that signed it
+	Encryption string `json:"encryption,omitempty"`
+	Signer     string `json:"signer,omitempty"`
+	// ResolvedAt is set on a failed file once the same file is processed successfully after it, and
+	// ResolvedBy is that file, relative to the success folder. The retention keeps the unresolved ones
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+}
+
+// Record is the outcome of a single record of the file
+type Record struct {
+	// Index is the position of the record in the file, starting at 1
+	Index   int    `json:"index"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Sync is the outcome of the full-sync (mirror) mode, where the items of
+// the Warehouse that are absent from the file are removed
+type Sync struct {
+	// Existing is how many items the Warehouse had before the file was applied
+	Existing         int     `json:"existing"`
+	MaxRemovePercent float64 `json:"maxRemovePercent"`
+	// ToRemove is the preview of the items absent from the file
+	ToRemove []string `json:"toRemove"`
+	Removed  []string `json:"removed"`
+	// NotRemoved lists the items that couldn't be removed, with the reason
+	NotRemoved []string `json:"notRemoved"`
+	// Aborted tells that nothing was applied because too many items would be removed
+	Aborted bool `json:"aborted"`
+}
+
+// Checksum is the outcome of the verification of the file against its checksum file
+type Checksum struct {
+	Algorithm string `json:"algorithm"`
+	// Source is the name of the sidecar or manifest the expected checksum was read from
+	Source   string `json:"source"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	// Size is the size of the file, in bytes, when it was verified
+	Size int64 `json:"size"`
+}
+
+// New creates an empty report for the file
+func New(filePath, domain string) *Report {
+	return &Report{
+		File:    filepath.Base(filePath),
+		Domain:  domain,
+		Records: []Record{},
+	}
+}
+
+// Add registers the outcome of a record
+func (r *Report) Add(index int, status, message string) {
+	r.Records = append(r.Records, Record{Index: index, Status: status, Message: message})
+}
+
+// Rejected returns the records that couldn't be processed
+func (r *Report) Rejected() []Record {
+	rejected := []Record{}
+	for _, rec := range r.Records {
+		if rec.Status == RecordRejected {
+			rejected = append(rejected, rec)
+		}
+	}
+	return rejected
+}
+
+// Finish sets the status of the report based on the records outcome, or as
+// failed if an error stopped the processing of the file
+func (r *Report) Finish(err error) {
+	r.ProcessedAt = time.Now()
+	rejected := len(r.Rejected())
+	switch {
+	case err != nil:
+		r.Status = StatusFail
+		r.Error = err.Error()
+	case rejected == 0:
+		r.Status = StatusSuccess
+	case rejected == len(r.Records):
+		r.Status = StatusFail
+	default:
+		r.Status = StatusPartial
+	}
+}
+
+// Write saves the report as JSON next to the processed file, named after it
+func Write(filePath string, r *Report) (string, error) {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding the report of %s: %s", r.File, err)
+	}
+	reportPath := filePath + Suffix
+	if err := ioutil.WriteFile(reportPath, content, 0666); err != nil {
+		return "", fmt.Errorf("error writing the report of %s: %s", r.File, err)
+	}
+	return reportPath, nil
+}
+
+// Read loads a report previously written
+func Read(reportPath string) (*Report, error) {
+	content, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(content, &r); err != nil {
+		return nil, fmt.Errorf("error decoding the report %s: %s", reportPath, err)
+	}
+	return &r, nil
+}
+
+// IsReport tells whether the file is a report, so it's not taken as data
+func IsReport(filePath string) bool {
+	return strings.HasSuffix(filePath, Suffix)
+}
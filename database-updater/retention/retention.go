@@ -0,0 +1,374 @@
+package retention
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database-autoupdater/encryption"
+	"database-autoupdater/reports"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// archiveSuffix is the extension of the archives of processed files
+const archiveSuffix = ".tar.gz"
+
+// Options of the retention of a processed (success or fail) folder. The zero value of each limit disables it
+type Options struct {
+	// Folder is the success or fail folder
+	Folder string
+	// ArchiveFolder is where the dated archives of the Folder are written. It must be out of the Folder
+	ArchiveFolder string
+	// ArchiveAfter is how long after being processed a file is compressed into the archive of its date
+	ArchiveAfter time.Duration
+	// MaxAge removes the archives (and the files not archived) processed longer ago than it
+	MaxAge time.Duration
+	// MaxSize, in bytes, removes the oldest archives and files until the Folder and its archives fit in it
+	MaxSize int64
+	// SuccessFolder is set for the retention of the fail folder. The failed files are kept in place while
+	// their failure is unresolved: until the same file (same name, subfolder and content) is processed
+	// successfully after it. The resolution is kept in the report of the failed file
+	SuccessFolder string
+}
+
+// processedFile is a file of the folder with its report and signature, handled together
+type processedFile struct {
+	path        string
+	report      *reports.Report
+	processedAt time.Time
+	size        int64
+	// companions are the report and the signature of the file, if any
+	companions []string
+}
+
+// Start applies the retention to the folder at start and then at each interval. It blocks,
+// so it's meant to run in a go routine
+func Start(options Options, interval time.Duration) {
+	for {
+		if err := Run(options); err != nil {
+			logrus.Errorf("Error applying the retention of %s. Details: %s", options.Folder, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Run applies the retention once: the old files are compressed into dated archives and the old archives
+// (or files) are removed until the age and size limits are met. The files of unresolved failures are never touched
+func Run(options Options) error {
+	files, err := listProcessed(options.Folder)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if options.SuccessFolder != "" {
+		if err := resolve(options, files); err != nil {
+			return err
+		}
+	}
+
+	if options.ArchiveFolder != "" && options.ArchiveAfter > 0 {
+		byDate := map[string][]processedFile{}
+		for _, f := range notKept(options, files) {
+			if now.Sub(f.processedAt) >= options.ArchiveAfter {
+				date := f.processedAt.Format("2006-01-02")
+				byDate[date] = append(byDate[date], f)
+			}
+		}
+		for date, dateFiles := range byDate {
+			if err := archive(options, date, dateFiles); err != nil {
+				return err
+			}
+		}
+		if files, err = listProcessed(options.Folder); err != nil {
+			return err
+		}
+	}
+
+	archives, err := listArchives(options.ArchiveFolder)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range append(files, archives...) {
+		total += f.size
+	}
+
+	// the oldest are removed first, archives and files together. The files to keep still count in the size
+	items := append(archives, notKept(options, files)...)
+	sort.Slice(items, func(i, j int) bool { return items[i].processedAt.Before(items[j].processedAt) })
+	for _, item := range items {
+		expired := options.MaxAge > 0 && now.Sub(item.processedAt) > options.MaxAge
+		oversized := options.MaxSize > 0 && total > options.MaxSize
+		if !expired && !oversized {
+			continue
+		}
+		if err := remove(item); err != nil {
+			return err
+		}
+		total -= item.size
+		logrus.Infof("Retention removed %s", item.path)
+	}
+	return nil
+}
+
+// notKept leaves out the failed files whose failure is unresolved
+func notKept(options Options, files []processedFile) []processedFile {
+	if options.SuccessFolder == "" {
+		return files
+	}
+	candidates := []processedFile{}
+	for _, f := range files {
+		if f.report != nil && f.report.ResolvedAt != nil {
+			candidates = append(candidates, f)
+		}
+	}
+	return candidates
+}
+
+// resolve registers, in the report of each failed file, that its failure was resolved by a later success of
+// the same file. It's registered once, so the failure stays resolved after the success is archived or removed
+func resolve(options Options, files []processedFile) error {
+	succeeded, err := successes(options.SuccessFolder)
+	if err != nil {
+		return err
+	}
+	digests := map[string]string{}
+	for _, f := range files {
+		if f.report == nil || f.report.ResolvedAt != nil {
+			continue
+		}
+		for _, s := range succeeded[originalPath(options.Folder, f)] {
+			if !s.processedAt.After(f.processedAt) {
+				continue
+			}
+			same, err := sameContent(f.path, s.path, digests)
+			if err != nil {
+				return err
+			}
+			if !same {
+				continue
+			}
+			resolvedAt := s.processedAt
+			f.report.ResolvedAt = &resolvedAt
+			f.report.ResolvedBy, _ = filepath.Rel(options.SuccessFolder, s.path)
+			if _, err := reports.Write(f.path, f.report); err != nil {
+				return fmt.Errorf("error registering the resolution of %s: %s", f.path, err)
+			}
+			logrus.Infof("Retention registered the failure of %s as resolved by %s", f.path, s.path)
+			break
+		}
+	}
+	return nil
+}
+
+// successes lists the files processed successfully by their original path
+func successes(successFolder string) (map[string][]processedFile, error) {
+	files, err := listProcessed(successFolder)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := map[string][]processedFile{}
+	for _, f := range files {
+		rel := originalPath(successFolder, f)
+		succeeded[rel] = append(succeeded[rel], f)
+	}
+	return succeeded, nil
+}
+
+// sameContent tells whether both files have the same content, keeping the digests already computed
+func sameContent(path, otherPath string, digests map[string]string) (bool, error) {
+	for _, p := range []string{path, otherPath} {
+		if _, ok := digests[p]; ok {
+			continue
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return false, fmt.Errorf("error reading %s: %s", p, err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, in)
+		in.Close()
+		if err != nil {
+			return false, fmt.Errorf("error reading %s: %s", p, err)
+		}
+		digests[p] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return digests[path] == digests[otherPath], nil
+}
+
+// originalPath is the path the processed file had relative to the incoming folder: its subfolder
+// and the name it was received with, told by its report
+func originalPath(folder string, f processedFile) string {
+	rel, err := filepath.Rel(folder, filepath.Dir(f.path))
+	if err != nil {
+		rel = "."
+	}
+	name := filepath.Base(f.path)
+	if f.report != nil && f.report.File != "" {
+		name = f.report.File
+	}
+	return filepath.ToSlash(filepath.Join(rel, name))
+}
+
+// listProcessed lists the processed files of the folder, and its subfolders, with their reports and signatures.
+// The time a file was processed is the one of its report or, without report, its modification time
+func listProcessed(folder string) ([]processedFile, error) {
+	files := []processedFile{}
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || reports.IsReport(path) || encryption.IsSignature(path) {
+			return nil
+		}
+		f := processedFile{path: path, processedAt: info.ModTime(), size: info.Size()}
+		if report, err := reports.Read(path + reports.Suffix); err == nil {
+			f.report = report
+			f.processedAt = report.ProcessedAt
+		}
+		for _, companion := range []string{path + reports.Suffix, path + encryption.SignatureSuffix} {
+			if companionInfo, err := os.Stat(companion); err == nil {
+				f.companions = append(f.companions, companion)
+				f.size += companionInfo.Size()
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the processed files at %s: %s", folder, err)
+	}
+	return files, nil
+}
+
+// listArchives lists the dated archives, taking the date of the name as the time they were processed
+func listArchives(archiveFolder string) ([]processedFile, error) {
+	archives := []processedFile{}
+	if archiveFolder == "" {
+		return archives, nil
+	}
+	infos, err := ioutil.ReadDir(archiveFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return archives, nil
+		}
+		return nil, fmt.Errorf("error listing the archives at %s: %s", archiveFolder, err)
+	}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), archiveSuffix) {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", info.Name()[:len("2006-01-02")], time.Local)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, processedFile{path: filepath.Join(archiveFolder, info.Name()), processedAt: date, size: info.Size()})
+	}
+	return archives, nil
+}
+
+// archive compresses the files (and their reports and signatures) processed at the date into a new archive of that date, keeping
+// their path relative to the folder, and removes them once the archive is written
+func archive(options Options, date string, files []processedFile) error {
+	if err := os.MkdirAll(options.ArchiveFolder, 0777); err != nil {
+		return fmt.Errorf("error creating the archive folder: %s", err)
+	}
+
+	// an archive is never changed: a new one is written for the files of the same date archived later
+	archivePath := filepath.Join(options.ArchiveFolder, date+archiveSuffix)
+	for i := 2; fileExists(archivePath); i++ {
+		archivePath = filepath.Join(options.ArchiveFolder, fmt.Sprintf("%s-%d%s", date, i, archiveSuffix))
+	}
+
+	if err := writeArchive(archivePath, options.Folder, files); err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+	for _, f := range files {
+		if err := remove(f); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("Retention archived %d files of %s into %s", len(files), date, archivePath)
+	return nil
+}
+
+func writeArchive(archivePath, folder string, files []processedFile) error {
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("error creating the archive %s: %s", archivePath, err)
+	}
+	defer out.Close()
+	compressed := gzip.NewWriter(out)
+	tarball := tar.NewWriter(compressed)
+
+	for _, f := range files {
+		for _, path := range append([]string{f.path}, f.companions...) {
+			if err := addToArchive(tarball, folder, path); err != nil {
+				return fmt.Errorf("error archiving %s: %s", path, err)
+			}
+		}
+	}
+
+	if err := tarball.Close(); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+func addToArchive(tarball *tar.Writer, folder, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(folder, path)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tarball.WriteHeader(header); err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(tarball, in)
+	return err
+}
+
+// remove deletes the file, its report and its signature
+func remove(f processedFile) error {
+	for _, path := range append([]string{f.path}, f.companions...) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
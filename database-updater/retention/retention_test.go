@@ -0,0 +1,108 @@
+package retention
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database-autoupdater/reports"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeProcessed places a processed file with its report, processed at the given time
+func writeProcessed(t *testing.T, folder, rel string, processedAt time.Time) {
+	writeProcessedContent(t, folder, rel, `{"inventory": []}`, processedAt)
+}
+
+func writeProcessedContent(t *testing.T, folder, rel, content string, processedAt time.Time) {
+	path := filepath.Join(folder, rel)
+	os.MkdirAll(filepath.Dir(path), 0777)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	report := reports.New(path, "article")
+	report.Finish(nil)
+	report.ProcessedAt = processedAt
+	_, err := reports.Write(path, report)
+	assert.Nil(t, err)
+}
+
+// archived lists the names of the files of an archive
+func archived(t *testing.T, archivePath string) []string {
+	in, err := os.Open(archivePath)
+	assert.Nil(t, err)
+	defer in.Close()
+	compressed, err := gzip.NewReader(in)
+	assert.Nil(t, err)
+	tarball := tar.NewReader(compressed)
+	names := []string{}
+	for {
+		header, err := tarball.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRun(t *testing.T) {
+	baseFolder := t.TempDir()
+	successFolder := filepath.Join(baseFolder, "success")
+	failFolder := filepath.Join(baseFolder, "fail")
+	archiveFolder := filepath.Join(baseFolder, "archive")
+
+	twoDaysAgo := time.Now().Add(-48 * time.Hour)
+	writeProcessed(t, successFolder, "article/acme/inventory.json", twoDaysAgo)
+	writeProcessed(t, successFolder, "article/inventory.json", time.Now())
+
+	// the failure of products.json was resolved by a later success of the same file. The one of
+	// orders.json was not: the later orders.json processed successfully has other orders
+	writeProcessed(t, failFolder, "product/products.json", twoDaysAgo.Add(-time.Hour))
+	writeProcessed(t, successFolder, "product/products.json", twoDaysAgo)
+	writeProcessedContent(t, failFolder, "order/orders.json", `{"orders": [1]}`, twoDaysAgo.Add(-time.Hour))
+	writeProcessedContent(t, successFolder, "order/orders.json", `{"orders": [2]}`, twoDaysAgo)
+
+	// the resolution is registered in the report of the failed file
+	options := Options{Folder: failFolder, SuccessFolder: successFolder}
+	assert.Nil(t, Run(options))
+	report, err := reports.Read(filepath.Join(failFolder, "product/products.json"+reports.Suffix))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("product", "products.json"), report.ResolvedBy)
+
+	options = Options{Folder: successFolder, ArchiveFolder: filepath.Join(archiveFolder, "success"), ArchiveAfter: 24 * time.Hour}
+	assert.Nil(t, Run(options))
+
+	archivePath := filepath.Join(archiveFolder, "success", twoDaysAgo.Format("2006-01-02")+archiveSuffix)
+	assert.Equal(t, []string{
+		"article/acme/inventory.json",
+		"article/acme/inventory.json" + reports.Suffix,
+		"order/orders.json",
+		"order/orders.json" + reports.Suffix,
+		"product/products.json",
+		"product/products.json" + reports.Suffix,
+	}, archived(t, archivePath))
+	assert.False(t, exists(filepath.Join(successFolder, "article/acme/inventory.json")))
+	assert.True(t, exists(filepath.Join(successFolder, "article/inventory.json")))
+
+	// the resolution registered before is kept once the success is archived
+	options = Options{Folder: failFolder, SuccessFolder: successFolder, MaxAge: 24 * time.Hour}
+	assert.Nil(t, Run(options))
+	assert.False(t, exists(filepath.Join(failFolder, "product/products.json")))
+	assert.False(t, exists(filepath.Join(failFolder, "product/products.json"+reports.Suffix)))
+	assert.True(t, exists(filepath.Join(failFolder, "order/orders.json")))
+
+	// the oldest archives are removed first to fit the size
+	options = Options{Folder: successFolder, ArchiveFolder: filepath.Join(archiveFolder, "success"), MaxSize: 1}
+	assert.Nil(t, Run(options))
+	assert.False(t, exists(archivePath))
+}
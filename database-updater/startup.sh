@@ -1,6 +1,6 @@
 #!/bin/sh
 
-/bin/database-autoupdater --logLevel=$LOG_LEVEL \
+/bin/database-autoupdater watch --logLevel=$LOG_LEVEL \
 --incomingDataFolder=/app/data/incoming \
 --successProcessedFolder=/app/data/success \
 --failProcessedFolder=/app/data/fail \
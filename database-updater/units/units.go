@@ -0,0 +1,134 @@
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultBaseUnit is the unit the stock of the Articles is kept in, unless the units file sets another one
+const DefaultBaseUnit = "piece"
+
+// UnitsOfMeasure are the units the incoming stock of the Articles can be in, from the units file:
+//
+//	{
+//	  "baseUnit": "piece",
+//	  "units": { "dozen": 12 },
+//	  "articles": { "2": { "packs": { "box": 100, "pallet": 4800 } } }
+//	}
+//
+// The Units are the conversion factors to the base unit valid for all the Articles and the
+// Articles have the pack sizes of each Article, by art_id
+type UnitsOfMeasure struct {
+	BaseUnit string                  `json:"baseUnit"`
+	Units    map[string]int64        `json:"units"`
+	Articles map[string]ArticleUnits `json:"articles"`
+}
+
+// ArticleUnits are the units of an Article: its base unit, if not the default one, and its pack
+// sizes, which are how many of the base unit a pack has
+type ArticleUnits struct {
+	BaseUnit string           `json:"baseUnit"`
+	Packs    map[string]int64 `json:"packs"`
+}
+
+// Load reads the units file. If no file is provided, the stock
+// of all the Articles is in the DefaultBaseUnit and there are no packs
+func Load(unitsFile string) (UnitsOfMeasure, error) {
+	units := UnitsOfMeasure{}
+	if unitsFile != "" {
+		content, err := ioutil.ReadFile(unitsFile)
+		if err != nil {
+			return units, fmt.Errorf("error reading units file: %s", err)
+		}
+		if err := json.Unmarshal(content, &units); err != nil {
+			return units, fmt.Errorf("error parsing units file: %s", err)
+		}
+	}
+	units.BaseUnit = Normalize(units.BaseUnit)
+	if units.BaseUnit == "" {
+		units.BaseUnit = DefaultBaseUnit
+	}
+	var err error
+	if units.Units, err = normalizeFactors(units.Units); err != nil {
+		return units, fmt.Errorf("units file has an invalid unit: %s", err)
+	}
+	articles := make(map[string]ArticleUnits, len(units.Articles))
+	for artId, article := range units.Articles {
+		if id, err := strconv.ParseInt(strings.TrimSpace(artId), 10, 64); err != nil || id < 0 {
+			return units, fmt.Errorf("units file has an invalid Article: invalid art_id %q: must be an integer from 0 to %d", artId, int64(math.MaxInt64))
+		}
+		if article.Packs, err = normalizeFactors(article.Packs); err != nil {
+			return units, fmt.Errorf("units file has an invalid pack of the Article %s: %s", artId, err)
+		}
+		article.BaseUnit = Normalize(article.BaseUnit)
+		articles[strings.TrimSpace(artId)] = article
+	}
+	units.Articles = articles
+	return units, nil
+}
+
+// normalizeFactors checks the conversion factors and returns them by the normalized unit name
+func normalizeFactors(factors map[string]int64) (map[string]int64, error) {
+	normalized := make(map[string]int64, len(factors))
+	for unit, factor := range factors {
+		if Normalize(unit) == "" {
+			return nil, fmt.Errorf("a unit has no name")
+		}
+		if factor <= 0 {
+			return nil, fmt.Errorf("%s must be a positive number of the base unit", unit)
+		}
+		normalized[Normalize(unit)] = factor
+	}
+	return normalized, nil
+}
+
+// Normalize returns the unit as it's compared: in lowercase, without surrounding spaces
+func Normalize(unit string) string {
+	return strings.ToLower(strings.TrimSpace(unit))
+}
+
+// BaseUnitOf returns the unit the stock of the Article is kept in
+func (u UnitsOfMeasure) BaseUnitOf(artId int64) string {
+	if article := u.Articles[strconv.FormatInt(artId, 10)]; article.BaseUnit != "" {
+		return article.BaseUnit
+	}
+	return u.BaseUnit
+}
+
+// Factor returns how many of the base unit of the Article are one of the unit. The
+// packs of the Article take precedence over the units of all the Articles
+func (u UnitsOfMeasure) Factor(artId int64, unit string) (int64, bool) {
+	unit = Normalize(unit)
+	if unit == u.BaseUnitOf(artId) {
+		return 1, true
+	}
+	if factor, found := u.Articles[strconv.FormatInt(artId, 10)].Packs[unit]; found {
+		return factor, true
+	}
+	factor, found := u.Units[unit]
+	return factor, found
+}
+
+// UnitsOf returns the names of the units the stock of the Article can be in, sorted
+func (u UnitsOfMeasure) UnitsOf(artId int64) []string {
+	names := []string{u.BaseUnitOf(artId)}
+	for unit := range u.Articles[strconv.FormatInt(artId, 10)].Packs {
+		names = append(names, unit)
+	}
+	for unit := range u.Units {
+		names = append(names, unit)
+	}
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,23 @@
+package units
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	unitsFile := filepath.Join(t.TempDir(), "units.json")
+	for content, message := range map[string]string{
+		`{"units": {"box": 0}}`:                        "units file has an invalid unit: box must be a positive number of the base unit",
+		`{"articles": {"screw": {}}}`:                  `units file has an invalid Article: invalid art_id "screw": must be an integer from 0 to 9223372036854775807`,
+		`{"articles": {"2": {"packs": {" ": 100}}}}`:   "units file has an invalid pack of the Article 2: a unit has no name",
+		`{"articles": {"2": {"packs": {"box": -10}}}}`: "units file has an invalid pack of the Article 2: box must be a positive number of the base unit",
+	} {
+		ioutil.WriteFile(unitsFile, []byte(content), 0666)
+		_, err := Load(unitsFile)
+		assert.Equal(t, message, err.Error(), content)
+	}
+}
@@ -0,0 +1,306 @@
+// Package warehouseclient is a typed client of the Warehouse API (api-backend): the Articles, the
+// Products with their availability, the stock changes and the health checks
+package warehouseclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of the http.Client used when none is provided
+const DefaultTimeout = 30 * time.Second
+
+// Errors matched, with errors.Is, by the APIError of the responses with these statuses
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// APIError is a response of the Warehouse API with an error status
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	// Message is the body of the response, usually telling the reason
+	Message string
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("error on %s %s to Warehouse API. Status: %s", e.Method, e.URL, e.Status)
+	if e.Message != "" {
+		message += ". Details: " + e.Message
+	}
+	return message
+}
+
+// Is makes the APIError match ErrNotFound and ErrConflict by its status
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// StockUpdateError tells that the Warehouse API couldn't update the stock by Product, like when
+// there's not enough stock of some Article. The API reports it in the body of a successful response
+type StockUpdateError struct {
+	ProductID int32
+	Message   string
+}
+
+func (e *StockUpdateError) Error() string {
+	return fmt.Sprintf("error updating the stock by Product %d at Warehouse API. Details: %s", e.ProductID, e.Message)
+}
+
+// Client calls the Warehouse API. It's safe for concurrent use
+type Client struct {
+	// ArticleEndpoint is the URL of the Article routes. E.g.: http://localhost:4000/article
+	ArticleEndpoint string
+	// ProductEndpoint is the URL of the Product routes. E.g.: http://localhost:4000/product
+	ProductEndpoint string
+	// HTTPClient does the requests, so timeouts, transports and test servers can be injected
+	HTTPClient *http.Client
+}
+
+// New creates a client of the Warehouse API. Without httpClient, one with the DefaultTimeout is used
+func New(articleEndpoint, productEndpoint string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{
+		ArticleEndpoint: strings.TrimSuffix(articleEndpoint, "/"),
+		ProductEndpoint: strings.TrimSuffix(productEndpoint, "/"),
+		HTTPClient:      httpClient,
+	}
+}
+
+// ArticleHealth checks whether the Article service has all the resources it needs
+func (c *Client) ArticleHealth(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.ArticleEndpoint+"/health", nil, nil)
+}
+
+// ProductHealth checks whether the Product service has all the resources it needs
+func (c *Client) ProductHealth(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.ProductEndpoint+"/health", nil, nil)
+}
+
+// Health checks both the Article and the Product services
+func (c *Client) Health(ctx context.Context) error {
+	if err := c.ArticleHealth(ctx); err != nil {
+		return err
+	}
+	return c.ProductHealth(ctx)
+}
+
+// ListArticles lists the Articles matching the filter
+func (c *Client) ListArticles(ctx context.Context, filter ArticleFilter) ([]Article, error) {
+	query := url.Values{}
+	if filter.Identification != nil {
+		query.Set("identification", fmt.Sprint(*filter.Identification))
+	}
+	var articles []Article
+	err := c.do(ctx, http.MethodGet, withQuery(c.ArticleEndpoint, query), nil, &articles)
+	return articles, err
+}
+
+// GetArticle fetches an Article by its ID. An Article that doesn't exist is an ErrNotFound
+func (c *Client) GetArticle(ctx context.Context, id int32) (*Article, error) {
+	var article *Article
+	endpoint := fmt.Sprintf("%s/%d", c.ArticleEndpoint, id)
+	if err := c.do(ctx, http.MethodGet, endpoint, nil, &article); err != nil {
+		return nil, err
+	}
+	// the API answers null for an Article that doesn't exist
+	if article == nil {
+		return nil, &APIError{Method: http.MethodGet, URL: endpoint, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return article, nil
+}
+
+// GetArticleByIdentification fetches the Article with the identification of the incoming files.
+// It returns nil, without error, if there's none
+func (c *Client) GetArticleByIdentification(ctx context.Context, identification int64) (*Article, error) {
+	articles, err := c.ListArticles(ctx, ArticleFilter{Identification: &identification})
+	if err != nil || len(articles) == 0 {
+		return nil, err
+	}
+	return &articles[0], nil
+}
+
+// CreateArticle creates the Article or, if there's one with the same identification, updates its name and stock.
+// With a Location, the stock is the one of the location. An Article with stock by location can't be written
+// without one
+func (c *Client) CreateArticle(ctx context.Context, article Article) (*Article, error) {
+	var created Article
+	if err := c.do(ctx, http.MethodPost, c.ArticleEndpoint, article, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// MoveArticleStock changes the stock of the Article by the delta of the movement, unless a movement with
+// the same Key was applied before. An Article that doesn't exist is an ErrNotFound and a movement that
+// would take its stock below zero is an ErrConflict
+func (c *Client) MoveArticleStock(ctx context.Context, movement StockMovement) (*MovedStock, error) {
+	var moved MovedStock
+	if err := c.do(ctx, http.MethodPost, c.ArticleEndpoint+"/stock-movement", movement, &moved); err != nil {
+		return nil, err
+	}
+	return &moved, nil
+}
+
+// UpdateStockByProduct reduces the stock of the Articles used to make the quantity of the Product, at
+// the location too if it's not empty. When the API can't update it, the error is a StockUpdateError
+func (c *Client) UpdateStockByProduct(ctx context.Context, productID int32, quantity int32, location string) (*StockUpdate, error) {
+	var update StockUpdate
+	endpoint := fmt.Sprintf("%s/stock-update/by/product/%d", c.ArticleEndpoint, productID)
+	body := map[string]interface{}{"quantity": quantity}
+	if location != "" {
+		body["location"] = location
+	}
+	if err := c.do(ctx, http.MethodPost, endpoint, body, &update); err != nil {
+		return nil, err
+	}
+	if update.Error != nil {
+		return &update, &StockUpdateError{ProductID: productID, Message: *update.Error}
+	}
+	return &update, nil
+}
+
+// DeleteArticle removes the Article. An Article used by some Product is an ErrConflict, unless
+// forced: then it's removed from the composition of these Products too
+func (c *Client) DeleteArticle(ctx context.Context, id int32, force bool) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d?force=%t", c.ArticleEndpoint, id, force), nil, nil)
+}
+
+// ListProducts lists the Products matching the filter, without their availability: see ListAvailability
+func (c *Client) ListProducts(ctx context.Context, filter ProductFilter) ([]Product, error) {
+	query := url.Values{}
+	if filter.Sku != "" {
+		query.Set("sku", filter.Sku)
+	}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+	var products []Product
+	err := c.do(ctx, http.MethodGet, withQuery(c.ProductEndpoint, query), nil, &products)
+	return products, err
+}
+
+// ListAvailability lists all the Products with the quantity available at the location, or at all
+// the locations if it's empty
+func (c *Client) ListAvailability(ctx context.Context, location string) ([]ProductAvailability, error) {
+	query := url.Values{}
+	if location != "" {
+		query.Set("location", location)
+	}
+	var products []ProductAvailability
+	err := c.do(ctx, http.MethodGet, withQuery(c.ProductEndpoint+"/availability", query), nil, &products)
+	return products, err
+}
+
+// GetProduct fetches a Product by its ID, with its availability at the location, or at all the locations
+// if it's empty. A Product that doesn't exist is an ErrNotFound
+func (c *Client) GetProduct(ctx context.Context, id int32, location string) (*ProductAvailability, error) {
+	// the API answers a list with the single Product
+	var products []ProductAvailability
+	query := url.Values{}
+	if location != "" {
+		query.Set("location", location)
+	}
+	endpoint := withQuery(fmt.Sprintf("%s/%d", c.ProductEndpoint, id), query)
+	if err := c.do(ctx, http.MethodGet, endpoint, nil, &products); err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, &APIError{Method: http.MethodGet, URL: endpoint, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return &products[0], nil
+}
+
+// CreateProduct creates the Product with its Article composition
+func (c *Client) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	var created Product
+	if err := c.do(ctx, http.MethodPost, c.ProductEndpoint, product, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateProduct replaces the price and Article composition of the Product. A Product that doesn't
+// exist is an ErrNotFound
+func (c *Client) UpdateProduct(ctx context.Context, id int32, product Product) (*Product, error) {
+	var updated Product
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/%d", c.ProductEndpoint, id), product, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteProduct removes the Product and its Article composition. A Product that doesn't exist is an ErrNotFound
+func (c *Client) DeleteProduct(ctx context.Context, id int32) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d", c.ProductEndpoint, id), nil, nil)
+}
+
+// do sends the request, with the body encoded as JSON, and decodes the response into the result, if any
+func (c *Client) do(ctx context.Context, method, endpoint string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding the request body of %s %s: %s", method, endpoint, err)
+		}
+		payload = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, payload)
+	if err != nil {
+		return fmt.Errorf("error preparing the request %s %s: %s", method, endpoint, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &APIError{Method: method, URL: endpoint, StatusCode: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(message))}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding the response of %s %s: %s", method, endpoint, err)
+	}
+	return nil
+}
+
+// withQuery adds the query params to the endpoint
+func withQuery(endpoint string, query url.Values) string {
+	if len(query) == 0 {
+		return endpoint
+	}
+	return endpoint + "?" + query.Encode()
+}
@@ -0,0 +1,114 @@
+package warehouseclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var moved StockMovement
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /article/health", "GET /product/health":
+			w.Write([]byte("ok"))
+		case "GET /article":
+			if r.URL.Query().Get("identification") == "2" {
+				w.Write([]byte("[]"))
+				return
+			}
+			json.NewEncoder(w).Encode([]Article{{ID: 10, Identification: 1, Name: "leg", AvailableStock: 12}})
+		case "POST /article/stock-movement":
+			json.NewDecoder(r.Body).Decode(&moved)
+			if moved.Identification != 1 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if moved.Key != "" {
+				w.Write([]byte(`{"id": 10, "identification": 1, "name": "leg", "availableStock": 12, "alreadyApplied": true}`))
+				return
+			}
+			json.NewEncoder(w).Encode(Article{ID: 10, Identification: 1, Name: "leg", AvailableStock: 12 + moved.Delta})
+		case "POST /article/stock-update/by/product/1":
+			w.Write([]byte(`{"articles":[],"error":"insufficient stock of leg"}`))
+		case "DELETE /article/10":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"the article is used by some product"}`))
+		case "GET /product":
+			assert.Equal(t, "CHAIR-01", r.URL.Query().Get("sku"))
+			json.NewEncoder(w).Encode([]ProductAvailability{{ID: 1, Sku: "CHAIR-01", Name: "Dining Chair", QuantityAvailable: 3}})
+		case "GET /product/1":
+			json.NewEncoder(w).Encode([]ProductAvailability{{ID: 1, Sku: "CHAIR-01", Name: "Dining Chair", QuantityAvailable: 3}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL+"/article/", server.URL+"/product", server.Client())
+	ctx := context.Background()
+
+	assert.Nil(t, client.Health(ctx))
+
+	article, err := client.GetArticleByIdentification(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(10), article.ID)
+	article, err = client.GetArticleByIdentification(ctx, 2)
+	assert.Nil(t, err)
+	assert.Nil(t, article)
+
+	result, err := client.MoveArticleStock(ctx, StockMovement{Identification: 1, Delta: -2, Reason: "damaged"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(10), result.AvailableStock)
+	assert.False(t, result.AlreadyApplied)
+	result, err = client.MoveArticleStock(ctx, StockMovement{Identification: 1, Delta: -2, Reason: "damaged", Key: "GRN-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(12), result.AvailableStock)
+	assert.True(t, result.AlreadyApplied)
+	_, err = client.MoveArticleStock(ctx, StockMovement{Identification: 2, Delta: 1, Reason: "received"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// the errors of the stock update come in the body of a successful response
+	_, err = client.UpdateStockByProduct(ctx, 1, 5, "")
+	var stockUpdateErr *StockUpdateError
+	assert.True(t, errors.As(err, &stockUpdateErr))
+	assert.Equal(t, "insufficient stock of leg", stockUpdateErr.Message)
+
+	err = client.DeleteArticle(ctx, 10, false)
+	assert.True(t, errors.Is(err, ErrConflict))
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Contains(t, apiErr.Message, "used by some product")
+
+	products, err := client.ListProducts(ctx, ProductFilter{Sku: "CHAIR-01"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(products))
+	product, err := client.GetProduct(ctx, 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), product.QuantityAvailable)
+	_, err = client.GetProduct(ctx, 2, "")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrConflict))
+}
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL+"/article", server.URL+"/product", nil)
+
+	// the request is given up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.ListArticles(ctx, ArticleFilter{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
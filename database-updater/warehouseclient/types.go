@@ -0,0 +1,95 @@
+package warehouseclient
+
+import "database-autoupdater/money"
+
+// Article is an Article of the Warehouse API. When it's written with a Location, the AvailableStock
+// is the stock at that location. Otherwise, and when it's read, it's the total of all the locations,
+// which are listed at the Stocks
+type Article struct {
+	ID             int32           `json:"id"`
+	Identification int64           `json:"identification"`
+	Name           string          `json:"name"`
+	AvailableStock int32           `json:"availableStock"`
+	Location       string          `json:"location,omitempty"`
+	Stocks         []LocationStock `json:"stocks,omitempty"`
+}
+
+// LocationStock is the stock of an Article at a location (warehouse), like `stockholm`
+type LocationStock struct {
+	Location       string `json:"location"`
+	AvailableStock int32  `json:"availableStock"`
+}
+
+// Product is a Product of the Warehouse API, as it's created or updated. The Price is
+// in the Currency of the Warehouse, and the Prices are the ones of each currency it's sold in
+type Product struct {
+	ID       int32                `json:"id"`
+	Sku      string               `json:"sku,omitempty"`
+	Name     string               `json:"name"`
+	Price    money.Decimal        `json:"price"`
+	Currency string               `json:"currency,omitempty"`
+	Prices   []Price              `json:"prices,omitempty"`
+	Articles []ArticleComposition `json:"articles"`
+}
+
+// Price is the price of a Product in a currency, by its ISO 4217 code
+type Price struct {
+	Currency string        `json:"currency"`
+	Price    money.Decimal `json:"price"`
+}
+
+// ArticleComposition is the quantity of an Article (by its ID, not its identification)
+// a Product is made of
+type ArticleComposition struct {
+	ArticleID int32 `json:"articleId"`
+	Quantity  int32 `json:"quantity"`
+}
+
+// ProductAvailability is a Product of the Warehouse API with the quantity that can be
+// made with the current stock of its Articles at the Location, or at all of them when it's empty
+type ProductAvailability struct {
+	ID                int32         `json:"id"`
+	Sku               string        `json:"sku"`
+	Name              string        `json:"name"`
+	Price             money.Decimal `json:"price"`
+	Currency          string        `json:"currency"`
+	Prices            []Price       `json:"prices"`
+	Location          string        `json:"location"`
+	QuantityAvailable int32         `json:"quantityAvailable"`
+}
+
+// StockMovement is a relative change of the stock of an Article, like "+5 received", at the
+// Location. Without it, only the total stock of the Article is changed
+type StockMovement struct {
+	Identification int64  `json:"identification"`
+	Delta          int32  `json:"delta"`
+	Reason         string `json:"reason"`
+	Location       string `json:"location,omitempty"`
+	// Key identifies the movement, so the Warehouse API applies it only once when it's sent again
+	Key string `json:"key,omitempty"`
+}
+
+// MovedStock is the result of a StockMovement: the Article with its new stock. AlreadyApplied tells that a
+// movement with the same Key was applied before, so the stock wasn't changed again
+type MovedStock struct {
+	Article
+	AlreadyApplied bool `json:"alreadyApplied,omitempty"`
+}
+
+// StockUpdate is the result of the stock update by Product: the Articles with their new stock
+type StockUpdate struct {
+	Articles []Article `json:"articles"`
+	Error    *string   `json:"error"`
+}
+
+// ArticleFilter filters the Articles listed. The zero value lists all of them
+type ArticleFilter struct {
+	// Identification is the identification of the Article, as in the incoming files
+	Identification *int64
+}
+
+// ProductFilter filters the Products listed. The zero value lists all of them
+type ProductFilter struct {
+	Sku  string
+	Name string
+}
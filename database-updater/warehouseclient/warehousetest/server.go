@@ -0,0 +1,636 @@
+// Package warehousetest provides a fake Warehouse API for hermetic tests: the routes of api-backend served
+// in-process with httptest from an in-memory state, with faults (latency, error statuses, timeouts) that can
+// be injected to test how the callers deal with them
+package warehousetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"database-autoupdater/warehouseclient"
+)
+
+// MovementReasons are the reasons of the stock movements accepted, like api-backend does
+var MovementReasons = []string{"received", "damaged", "returned", "lost", "correction"}
+
+// Fault changes how the requests it matches are answered
+type Fault struct {
+	// Method of the requests affected. Empty matches any method
+	Method string
+	// Path is the prefix of the path of the requests affected, like /article or /product/1. Empty matches any path
+	Path string
+	// Latency delays the answer. A latency longer than the timeout of the client makes the request time out
+	Latency time.Duration
+	// Status answers the request with this status, without serving it. Zero serves the request
+	Status int
+	// Times is how many requests are affected. Zero affects all of them
+	Times int
+}
+
+// Server is a fake Warehouse API. It's safe for concurrent use
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	nextID    int32
+	articles  map[int32]warehouseclient.Article
+	products  map[int32]warehouseclient.Product
+	movements []warehouseclient.StockMovement
+	faults    []*Fault
+	requests  []string
+}
+
+// NewServer starts a fake Warehouse API without Articles and Products. It must be closed after use
+func NewServer() *Server {
+	s := &Server{
+		articles: map[int32]warehouseclient.Article{},
+		products: map[int32]warehouseclient.Product{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// ArticleEndpoint is the URL of the Article routes
+func (s *Server) ArticleEndpoint() string {
+	return s.URL + "/article"
+}
+
+// ProductEndpoint is the URL of the Product routes
+func (s *Server) ProductEndpoint() string {
+	return s.URL + "/product"
+}
+
+// WarehouseClient returns a client of the fake Warehouse API
+func (s *Server) WarehouseClient() *warehouseclient.Client {
+	return warehouseclient.New(s.ArticleEndpoint(), s.ProductEndpoint(), s.Client())
+}
+
+// AddArticle adds an Article to the Warehouse, returning it with its ID
+func (s *Server) AddArticle(identification int64, name string, stock int32) warehouseclient.Article {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	article := warehouseclient.Article{ID: s.nextID, Identification: identification, Name: name, AvailableStock: stock}
+	s.articles[article.ID] = article
+	return article
+}
+
+// AddProduct adds a Product, made of Articles already added, to the Warehouse, returning it with its ID
+func (s *Server) AddProduct(product warehouseclient.Product) warehouseclient.Product {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	product.ID = s.nextID
+	s.products[product.ID] = product
+	return product
+}
+
+// Article returns the Article with the identification, or nil if the Warehouse doesn't have it
+func (s *Server) Article(identification int64) *warehouseclient.Article {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.articles {
+		if a.Identification == identification {
+			return &a
+		}
+	}
+	return nil
+}
+
+// Articles returns the Articles of the Warehouse, sorted by ID
+func (s *Server) Articles() []warehouseclient.Article {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedArticles()
+}
+
+// Product returns the Product with the name, or nil if the Warehouse doesn't have it
+func (s *Server) Product(name string) *warehouseclient.Product {
+	for _, p := range s.Products() {
+		if p.Name == name {
+			return &p
+		}
+	}
+	return nil
+}
+
+// Products returns the Products of the Warehouse, sorted by ID
+func (s *Server) Products() []warehouseclient.Product {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedProducts()
+}
+
+// Movements returns the stock movements applied, in order
+func (s *Server) Movements() []warehouseclient.StockMovement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]warehouseclient.StockMovement{}, s.movements...)
+}
+
+// Requests counts the requests received (faulty or not) with the method and the path prefix. Empty matches any
+func (s *Server) Requests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, r := range s.requests {
+		fields := strings.SplitN(r, " ", 2)
+		if (method == "" || fields[0] == method) && strings.HasPrefix(fields[1], path) {
+			count++
+		}
+	}
+	return count
+}
+
+// Inject adds a fault to the requests it matches, on top of the faults already injected
+func (s *Server) Inject(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all the faults injected
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault registers the request and returns the delay and the status it must be answered with
+func (s *Server) fault(r *http.Request) (time.Duration, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	var latency time.Duration
+	status := 0
+	remaining := []*Fault{}
+	for _, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasPrefix(r.URL.Path, f.Path) {
+			remaining = append(remaining, f)
+			continue
+		}
+		latency += f.Latency
+		if status == 0 {
+			status = f.Status
+		}
+		// a fault limited to some requests is removed once they're done
+		if f.Times == 1 {
+			continue
+		}
+		if f.Times > 1 {
+			f.Times--
+		}
+		remaining = append(remaining, f)
+	}
+	s.faults = remaining
+	return latency, status
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	latency, status := s.fault(r)
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(path) == 2 && path[1] == "health" && r.Method == http.MethodGet:
+		w.Write([]byte("ok"))
+	case path[0] == "article":
+		s.serveArticle(w, r, path[1:])
+	case path[0] == "product":
+		s.serveProduct(w, r, path[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveArticle serves the routes of /article, with the rest of the path
+func (s *Server) serveArticle(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		articles := []warehouseclient.Article{}
+		for _, a := range s.sortedArticles() {
+			if query := r.URL.Query().Get("identification"); query == "" || query == fmt.Sprint(a.Identification) {
+				articles = append(articles, a)
+			}
+		}
+		writeJSON(w, http.StatusOK, articles)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var article warehouseclient.Article
+		if !readJSON(w, r, &article) {
+			return
+		}
+		if article.ID != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Not allowed to specify Article ID when creating a new one"})
+			return
+		}
+		// like api-backend, the Article with the same identification is updated, as the incoming files are
+		// re-ingested. Once it has stock by location, its stock can only be written at a location
+		var existing *warehouseclient.Article
+		for _, a := range s.articles {
+			if a.Identification == article.Identification {
+				a := a
+				existing = &a
+			}
+		}
+		if existing != nil && article.Location == "" && len(existing.Stocks) > 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "The Article has stock by location: a `location` must be provided"})
+			return
+		}
+		if existing == nil {
+			article.ID = s.newID()
+		} else {
+			article.ID = existing.ID
+			article.Stocks = existing.Stocks
+		}
+		// with a location, the stock is the one of the location and the total is the sum of all of them
+		if article.Location != "" {
+			article = changeStockAt(article, article.Location, article.AvailableStock, true)
+			article.Location = ""
+		}
+		s.articles[article.ID] = article
+		writeJSON(w, http.StatusOK, article)
+	case len(path) == 1 && path[0] == "stock-movement" && r.Method == http.MethodPost:
+		s.moveStock(w, r)
+	case len(path) == 4 && path[0] == "stock-update" && r.Method == http.MethodPost:
+		s.updateStockByProduct(w, r, path[3])
+	case len(path) == 1 && r.Method == http.MethodGet:
+		id, ok := parseID(w, path[0])
+		if !ok {
+			return
+		}
+		if article, found := s.articles[id]; found {
+			writeJSON(w, http.StatusOK, article)
+			return
+		}
+		// api-backend answers null for an Article that doesn't exist
+		writeJSON(w, http.StatusOK, nil)
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		id, ok := parseID(w, path[0])
+		if !ok {
+			return
+		}
+		s.deleteArticle(w, id, r.URL.Query().Get("force") == "true")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) moveStock(w http.ResponseWriter, r *http.Request) {
+	var movement warehouseclient.StockMovement
+	if !readJSON(w, r, &movement) {
+		return
+	}
+	if movement.Delta == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "`identification` and a non zero `delta` must be provided"})
+		return
+	}
+	valid := false
+	for _, reason := range MovementReasons {
+		valid = valid || reason == movement.Reason
+	}
+	if !valid {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "`reason` must be one of: " + strings.Join(MovementReasons, ", ")})
+		return
+	}
+	for id, a := range s.articles {
+		if a.Identification == movement.Identification {
+			// a movement sent again with the same key is applied only once, like api-backend does
+			if movement.Key != "" && s.hasMovement(movement.Key) {
+				writeJSON(w, http.StatusOK, warehouseclient.MovedStock{Article: a, AlreadyApplied: true})
+				return
+			}
+			if movement.Location == "" && len(a.Stocks) > 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"message": "The Article has stock by location: a `location` must be provided"})
+				return
+			}
+			// like api-backend, the stock doesn't go below zero
+			if a.AvailableStock+movement.Delta < 0 || (movement.Location != "" && stockAt(a, movement.Location)+movement.Delta < 0) {
+				writeJSON(w, http.StatusConflict, map[string]string{"message": "The stock of the Article can't go below zero"})
+				return
+			}
+			a.AvailableStock += movement.Delta
+			if movement.Location != "" {
+				a = changeStockAt(a, movement.Location, movement.Delta, false)
+			}
+			s.articles[id] = a
+			s.movements = append(s.movements, movement)
+			writeJSON(w, http.StatusOK, a)
+			return
+		}
+	}
+	http.Error(w, "Not found", http.StatusNotFound)
+}
+
+// hasMovement tells whether a movement with the key was already applied
+func (s *Server) hasMovement(key string) bool {
+	for _, m := range s.movements {
+		if m.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// updateStockByProduct reduces the stock of the Articles of the Product. Like api-backend, the stock may
+// become negative and the errors are answered in the body
+func (s *Server) updateStockByProduct(w http.ResponseWriter, r *http.Request, productID string) {
+	var body struct {
+		Quantity int32  `json:"quantity"`
+		Location string `json:"location"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Quantity == 0 {
+		body.Quantity = 1
+	}
+	id, ok := parseID(w, productID)
+	if !ok {
+		return
+	}
+	product, found := s.products[id]
+	if !found {
+		message := fmt.Sprintf("Could not find a Product with id=%d", id)
+		writeJSON(w, http.StatusOK, warehouseclient.StockUpdate{Articles: []warehouseclient.Article{}, Error: &message})
+		return
+	}
+	// like api-backend, the Articles with stock by location are only changed at a location
+	for _, composition := range product.Articles {
+		if body.Location == "" && len(s.articles[composition.ArticleID].Stocks) > 0 {
+			message := fmt.Sprintf("The Articles of the Product with id=%d have stock by location: a `location` must be provided", id)
+			writeJSON(w, http.StatusOK, warehouseclient.StockUpdate{Articles: []warehouseclient.Article{}, Error: &message})
+			return
+		}
+	}
+	update := warehouseclient.StockUpdate{Articles: []warehouseclient.Article{}}
+	for _, composition := range product.Articles {
+		article := s.articles[composition.ArticleID]
+		article.AvailableStock -= body.Quantity * composition.Quantity
+		if body.Location != "" {
+			article = changeStockAt(article, body.Location, -body.Quantity*composition.Quantity, false)
+		}
+		s.articles[article.ID] = article
+		update.Articles = append(update.Articles, article)
+	}
+	writeJSON(w, http.StatusOK, update)
+}
+
+func (s *Server) deleteArticle(w http.ResponseWriter, id int32, force bool) {
+	article, found := s.articles[id]
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	usedByProducts := []int32{}
+	for _, p := range s.sortedProducts() {
+		for _, composition := range p.Articles {
+			if composition.ArticleID == id {
+				usedByProducts = append(usedByProducts, p.ID)
+			}
+		}
+	}
+	if len(usedByProducts) > 0 && !force {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"message": "The Article is used by some Products", "usedByProducts": usedByProducts})
+		return
+	}
+	// when forced, the Article is taken out of the Products composition first
+	for _, productID := range usedByProducts {
+		product := s.products[productID]
+		composition := []warehouseclient.ArticleComposition{}
+		for _, c := range product.Articles {
+			if c.ArticleID != id {
+				composition = append(composition, c)
+			}
+		}
+		product.Articles = composition
+		s.products[productID] = product
+	}
+	delete(s.articles, id)
+	writeJSON(w, http.StatusOK, article)
+}
+
+// serveProduct serves the routes of /product, with the rest of the path
+func (s *Server) serveProduct(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		sku, name := r.URL.Query().Get("sku"), r.URL.Query().Get("name")
+		products := []warehouseclient.Product{}
+		for _, p := range s.sortedProducts() {
+			if (sku == "" || p.Sku == sku) && (name == "" || p.Name == name) {
+				products = append(products, p)
+			}
+		}
+		writeJSON(w, http.StatusOK, products)
+	case len(path) == 1 && path[0] == "availability" && r.Method == http.MethodGet:
+		products := []warehouseclient.ProductAvailability{}
+		for _, p := range s.sortedProducts() {
+			products = append(products, s.availability(p, r.URL.Query().Get("location")))
+		}
+		writeJSON(w, http.StatusOK, products)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var product warehouseclient.Product
+		if !readJSON(w, r, &product) {
+			return
+		}
+		if product.ID != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Not allowed to specify Product ID when creating a new one"})
+			return
+		}
+		if !s.checkProduct(w, product) {
+			return
+		}
+		product.ID = s.newID()
+		s.products[product.ID] = product
+		writeJSON(w, http.StatusOK, product)
+	case len(path) == 1 && r.Method == http.MethodGet:
+		id, ok := parseID(w, path[0])
+		if !ok {
+			return
+		}
+		product, found := s.products[id]
+		if !found {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, []warehouseclient.ProductAvailability{s.availability(product, r.URL.Query().Get("location"))})
+	case len(path) == 1 && r.Method == http.MethodPut:
+		id, ok := parseID(w, path[0])
+		if !ok {
+			return
+		}
+		var product warehouseclient.Product
+		if !readJSON(w, r, &product) {
+			return
+		}
+		if _, found := s.products[id]; !found {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		product.ID = id
+		if !s.checkProduct(w, product) {
+			return
+		}
+		s.products[id] = product
+		writeJSON(w, http.StatusOK, product)
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		id, ok := parseID(w, path[0])
+		if !ok {
+			return
+		}
+		product, found := s.products[id]
+		if !found {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		delete(s.products, id)
+		writeJSON(w, http.StatusOK, product)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// checkProduct fails the request, like the constraints of the database do, if the SKU of the
+// Product is already used by another one or some Article of its composition doesn't exist
+func (s *Server) checkProduct(w http.ResponseWriter, product warehouseclient.Product) bool {
+	for _, p := range s.products {
+		if product.Sku != "" && p.Sku == product.Sku && p.ID != product.ID {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"msg": "There was an error processing your request"})
+			return false
+		}
+	}
+	for _, composition := range product.Articles {
+		if _, found := s.articles[composition.ArticleID]; !found {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"msg": "There was an error processing your request"})
+			return false
+		}
+	}
+	return true
+}
+
+// availability is the quantity of the Product that can be made with the stock of its Articles at the
+// location, or at all the locations if it's empty
+func (s *Server) availability(product warehouseclient.Product, location string) warehouseclient.ProductAvailability {
+	available := warehouseclient.ProductAvailability{ID: product.ID, Sku: product.Sku, Name: product.Name, Price: product.Price, Currency: product.Currency, Prices: product.Prices, Location: location}
+	if available.Currency == "" {
+		// like the Warehouse database, where the prices without currency are in EUR
+		available.Currency = "EUR"
+	}
+	for i, composition := range product.Articles {
+		if composition.Quantity <= 0 {
+			continue
+		}
+		quantity := stockAt(s.articles[composition.ArticleID], location) / composition.Quantity
+		if i == 0 || quantity < available.QuantityAvailable {
+			available.QuantityAvailable = quantity
+		}
+	}
+	return available
+}
+
+// stockAt is the stock of the Article at the location, or its total stock if the location is empty
+func stockAt(article warehouseclient.Article, location string) int32 {
+	if location == "" {
+		return article.AvailableStock
+	}
+	for _, stock := range article.Stocks {
+		if stock.Location == location {
+			return stock.AvailableStock
+		}
+	}
+	return 0
+}
+
+// changeStockAt changes the stock of the Article at the location by the delta or, if replace, sets it
+// to the value. Like api-backend, a replaced stock makes the total the sum of all the locations
+func changeStockAt(article warehouseclient.Article, location string, value int32, replace bool) warehouseclient.Article {
+	stocks := []warehouseclient.LocationStock{}
+	found := false
+	for _, stock := range article.Stocks {
+		if stock.Location == location {
+			found = true
+			if replace {
+				stock.AvailableStock = value
+			} else {
+				stock.AvailableStock += value
+			}
+		}
+		stocks = append(stocks, stock)
+	}
+	if !found {
+		stocks = append(stocks, warehouseclient.LocationStock{Location: location, AvailableStock: value})
+	}
+	article.Stocks = stocks
+	if replace {
+		article.AvailableStock = 0
+		for _, stock := range stocks {
+			article.AvailableStock += stock.AvailableStock
+		}
+	}
+	return article
+}
+
+func (s *Server) newID() int32 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) sortedArticles() []warehouseclient.Article {
+	articles := []warehouseclient.Article{}
+	for _, a := range s.articles {
+		articles = append(articles, a)
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	return articles
+}
+
+func (s *Server) sortedProducts() []warehouseclient.Product {
+	products := []warehouseclient.Product{}
+	for _, p := range s.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products
+}
+
+func parseID(w http.ResponseWriter, value string) (int32, bool) {
+	id, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		http.Error(w, "There was an error processing your request", http.StatusInternalServerError)
+		return 0, false
+	}
+	return int32(id), true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(value); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
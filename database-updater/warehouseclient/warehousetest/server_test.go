@@ -0,0 +1,120 @@
+package warehousetest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"database-autoupdater/warehouseclient"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	warehouse := NewServer()
+	defer warehouse.Close()
+	client := warehouse.WarehouseClient()
+	ctx := context.Background()
+
+	leg := warehouse.AddArticle(1, "leg", 12)
+	screw := warehouse.AddArticle(2, "screw", 17)
+	chair, err := client.CreateProduct(ctx, warehouseclient.Product{Name: "Dining Chair", Articles: []warehouseclient.ArticleComposition{
+		{ArticleID: leg.ID, Quantity: 4},
+		{ArticleID: screw.ID, Quantity: 8},
+	}})
+	assert.Nil(t, err)
+
+	// the availability follows the stock of the Articles
+	product, err := client.GetProduct(ctx, chair.ID, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), product.QuantityAvailable)
+	_, err = client.UpdateStockByProduct(ctx, chair.ID, 2, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), warehouse.Article(1).AvailableStock)
+	assert.Equal(t, int32(1), warehouse.Article(2).AvailableStock)
+
+	// the Article is updated when posted again, instead of duplicated
+	_, err = client.CreateArticle(ctx, warehouseclient.Article{Identification: 1, Name: "leg", AvailableStock: 20})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(warehouse.Articles()))
+	assert.Equal(t, int32(20), warehouse.Article(1).AvailableStock)
+}
+
+func TestServerLocations(t *testing.T) {
+	warehouse := NewServer()
+	defer warehouse.Close()
+	client := warehouse.WarehouseClient()
+	ctx := context.Background()
+
+	// the stock of each location is kept and the total is the sum of all of them
+	for location, stock := range map[string]int32{"stockholm": 12, "malmo": 4} {
+		_, err := client.CreateArticle(ctx, warehouseclient.Article{Identification: 1, Name: "leg", AvailableStock: stock, Location: location})
+		assert.Nil(t, err)
+	}
+	leg := warehouse.Article(1)
+	assert.Equal(t, int32(16), leg.AvailableStock)
+	chair, err := client.CreateProduct(ctx, warehouseclient.Product{Name: "Dining Chair", Articles: []warehouseclient.ArticleComposition{{ArticleID: leg.ID, Quantity: 4}}})
+	assert.Nil(t, err)
+
+	// the availability can be asked for a single location or for all of them
+	product, err := client.GetProduct(ctx, chair.ID, "malmo")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), product.QuantityAvailable)
+	product, err = client.GetProduct(ctx, chair.ID, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), product.QuantityAvailable)
+	products, err := client.ListAvailability(ctx, "gothenburg")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), products[0].QuantityAvailable)
+
+	// the movements and the sales at a location change it and the total
+	_, err = client.MoveArticleStock(ctx, warehouseclient.StockMovement{Identification: 1, Delta: 8, Reason: "received", Location: "gothenburg"})
+	assert.Nil(t, err)
+	_, err = client.UpdateStockByProduct(ctx, chair.ID, 1, "stockholm")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(20), warehouse.Article(1).AvailableStock)
+	assert.Equal(t, []warehouseclient.LocationStock{{Location: "stockholm", AvailableStock: 8}, {Location: "malmo", AvailableStock: 4}, {Location: "gothenburg", AvailableStock: 8}}, sortedStocks(warehouse.Article(1).Stocks, "stockholm", "malmo", "gothenburg"))
+
+	// without location they are refused, so the total stays the sum of the locations
+	_, err = client.MoveArticleStock(ctx, warehouseclient.StockMovement{Identification: 1, Delta: -2, Reason: "damaged"})
+	assert.NotNil(t, err)
+	_, err = client.UpdateStockByProduct(ctx, chair.ID, 1, "")
+	var stockUpdateErr *warehouseclient.StockUpdateError
+	assert.True(t, errors.As(err, &stockUpdateErr))
+	_, err = client.CreateArticle(ctx, warehouseclient.Article{Identification: 1, Name: "leg", AvailableStock: 10})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(20), warehouse.Article(1).AvailableStock)
+}
+
+// sortedStocks returns the stocks in the order of the locations
+func sortedStocks(stocks []warehouseclient.LocationStock, locations ...string) []warehouseclient.LocationStock {
+	sorted := []warehouseclient.LocationStock{}
+	for _, location := range locations {
+		for _, stock := range stocks {
+			if stock.Location == location {
+				sorted = append(sorted, stock)
+			}
+		}
+	}
+	return sorted
+}
+
+func TestServerFaults(t *testing.T) {
+	warehouse := NewServer()
+	defer warehouse.Close()
+	client := warehouse.WarehouseClient()
+	ctx := context.Background()
+
+	// the fault affects only the requests it matches, as many times as set
+	warehouse.Inject(Fault{Method: http.MethodGet, Path: "/product", Status: http.StatusServiceUnavailable, Times: 2})
+	assert.Nil(t, client.ArticleHealth(ctx))
+	for i := 0; i < 2; i++ {
+		err := client.ProductHealth(ctx)
+		var apiErr *warehouseclient.APIError
+		assert.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+	assert.Nil(t, client.ProductHealth(ctx))
+	assert.Equal(t, 3, warehouse.Requests(http.MethodGet, "/product"))
+}
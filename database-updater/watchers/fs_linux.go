@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package watchers
+
+import (
+	"os"
+	"syscall"
+)
+
+// filesystems where inotify doesn't receive the events of changes made by other hosts or by
+// the host of a container, by their statfs magic number
+var unreliableFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517B:     "smb",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x794C7630: "overlay",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+}
+
+// unreliableFilesystem tells whether the folder is on a filesystem where inotify is unreliable, and which one
+func unreliableFilesystem(path string) (string, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+	fsType, ok := unreliableFilesystems[uint32(stat.Type)]
+	return fsType, ok
+}
+
+// inodeOf returns the inode of the file, so a file replaced by another with the same size and time is noticed
+func inodeOf(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
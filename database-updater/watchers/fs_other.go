@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package watchers
+
+import "os"
+
+// unreliableFilesystem is only detected on Linux. Elsewhere, use the --watcher or --pollFolders flags
+func unreliableFilesystem(path string) (string, bool) {
+	return "", false
+}
+
+// inodeOf is only available on Linux. Elsewhere, the files are compared by size and time
+func inodeOf(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,251 @@
+package watchers
+
+import (
+	"context"
+	"database-autoupdater/checksums"
+	"database-autoupdater/globals"
+	"database-autoupdater/handlers"
+	"database-autoupdater/reports"
+	"database-autoupdater/warehouseclient/warehousetest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// harnessTimeout is how long the harness waits for the files to be handled
+const harnessTimeout = 5 * time.Second
+
+const inventory = `{"inventory": [{"art_id": "1", "name": "leg", "stock": "12"}, {"art_id": "2", "name": "screw", "stock": "17"}]}`
+
+// handled is the outcome of a file handled by the pipeline
+type handled struct {
+	file string
+	err  error
+}
+
+// pipelineHarness runs the pipeline of a domain on temporary folders, with the watcher of the mode,
+// against a fake Warehouse API. It tells when each file was handled, so the tests wait for the
+// outcome of the files they drop instead of sleeping
+type pipelineHarness struct {
+	t         *testing.T
+	warehouse *warehousetest.Server
+	root      string
+	incoming  string
+	success   string
+	fail      string
+	results   chan handled
+}
+
+func newPipelineHarness(t *testing.T, mode string, handle func(string, string, string) error) *pipelineHarness {
+	root, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &pipelineHarness{
+		t:         t,
+		warehouse: warehousetest.NewServer(),
+		root:      root,
+		incoming:  filepath.Join(root, "incoming", "article"),
+		success:   filepath.Join(root, "success", "article"),
+		fail:      filepath.Join(root, "fail", "article"),
+		results:   make(chan handled, 100),
+	}
+	for _, folder := range []string{h.incoming, h.success, h.fail} {
+		os.MkdirAll(folder, 0777)
+	}
+
+	globals.IncomingDataFolder = filepath.Join(root, "incoming")
+	globals.WatcherMode = mode
+	globals.PollInterval = 50 * time.Millisecond
+	globals.WarehouseArticleEndpoint = h.warehouse.ArticleEndpoint()
+	globals.WarehouseProductEndpoint = h.warehouse.ProductEndpoint()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		RunPipeline(ctx, h.incoming, h.success, h.fail, func(filePath, successFolder, failFolder string) error {
+			err := handle(filePath, successFolder, failFolder)
+			h.results <- handled{file: filePath, err: err}
+			return err
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		h.warehouse.Close()
+		os.RemoveAll(root)
+		globals.WatcherMode = ""
+		globals.ChecksumWait = 0
+	})
+
+	// give the watchers the time to start, since the files placed before aren't taken
+	time.Sleep(100 * time.Millisecond)
+	return h
+}
+
+// drop places the file at the incoming folder at once, by renaming it from outside, like the transfers should do
+func (h *pipelineHarness) drop(name, content string) {
+	temporary := filepath.Join(h.root, filepath.Base(name)+".part")
+	if err := ioutil.WriteFile(temporary, []byte(content), 0666); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.Rename(temporary, filepath.Join(h.incoming, name)); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// dropPartially writes the file at the incoming folder in parts, with a pause between them, like a slow transfer
+func (h *pipelineHarness) dropPartially(name string, pause time.Duration, parts ...string) {
+	file, err := os.Create(filepath.Join(h.incoming, name))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer file.Close()
+	for i, part := range parts {
+		if i > 0 {
+			time.Sleep(pause)
+		}
+		file.WriteString(part)
+		file.Sync()
+	}
+}
+
+// wait returns the outcome of the next n files handled, failing the test if they're not handled in time
+func (h *pipelineHarness) wait(n int) []handled {
+	outcomes := []handled{}
+	timeout := time.After(harnessTimeout)
+	for len(outcomes) < n {
+		select {
+		case outcome := <-h.results:
+			outcomes = append(outcomes, outcome)
+		case <-timeout:
+			h.t.Fatalf("%d of %d files were handled in %s: %v", len(outcomes), n, harnessTimeout, outcomes)
+		}
+	}
+	return outcomes
+}
+
+// settle fails the test if some file is handled within the period, like the same file handled twice
+func (h *pipelineHarness) settle(period time.Duration) {
+	select {
+	case outcome := <-h.results:
+		h.t.Errorf("unexpected file handled: %s (error: %v)", outcome.file, outcome.err)
+	case <-time.After(period):
+	}
+}
+
+// files lists the data files at the folder, without the reports, by their path relative to it
+func (h *pipelineHarness) files(folder string) []string {
+	files := []string{}
+	filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() && !reports.IsReport(path) {
+			rel, _ := filepath.Rel(folder, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestStartPipeline(t *testing.T) {
+	h := newPipelineHarness(t, ModeNotify, handlers.HandleArticleIncomingDataFile)
+
+	// a valid file is ingested and moved to the success folder, an invalid one to the fail folder
+	h.drop("inventory.json", inventory)
+	outcome := h.wait(1)[0]
+	assert.Nil(t, outcome.err)
+	h.drop("broken.json", `{"inventory": [`)
+	outcome = h.wait(1)[0]
+	assert.NotNil(t, outcome.err)
+	h.settle(200 * time.Millisecond)
+
+	assert.Equal(t, 2, len(h.warehouse.Articles()))
+	assert.Equal(t, 1, len(h.files(h.success)))
+	assert.Equal(t, 1, len(h.files(h.fail)))
+	assert.Empty(t, h.files(h.incoming))
+}
+
+func TestPipelineSubfolders(t *testing.T) {
+	h := newPipelineHarness(t, ModeNotify, handlers.HandleArticleIncomingDataFile)
+
+	// the file of a supplier folder created after the pipeline started keeps its folder
+	os.MkdirAll(filepath.Join(h.incoming, "acme"), 0777)
+	time.Sleep(50 * time.Millisecond)
+	h.drop("acme/inventory.json", inventory)
+	assert.Nil(t, h.wait(1)[0].err)
+
+	files := h.files(h.success)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "acme", filepath.Dir(files[0]))
+}
+
+func TestPipelineDuplicates(t *testing.T) {
+	h := newPipelineHarness(t, ModeNotify, handlers.HandleArticleIncomingDataFile)
+
+	// the same file placed twice is ingested twice, without overwriting the first one processed
+	h.drop("inventory.json", inventory)
+	assert.Nil(t, h.wait(1)[0].err)
+	h.drop("inventory.json", inventory)
+	assert.Nil(t, h.wait(1)[0].err)
+	h.settle(200 * time.Millisecond)
+
+	assert.Equal(t, 2, len(h.files(h.success)))
+	assert.Equal(t, 2, len(h.warehouse.Articles()))
+}
+
+func TestPipelinePartialWritesWithChecksum(t *testing.T) {
+	globals.ChecksumWait = 3 * time.Second
+	h := newPipelineHarness(t, ModeNotify, handlers.HandleArticleIncomingDataFile)
+
+	// the file is taken as soon as it's created, but it waits for the rest of its content to match the
+	// checksum. The events of the writes don't handle it again while it's being handled
+	checksums.WriteSidecar(filepath.Join(h.root, "inventory.json"), []byte(inventory))
+	os.Rename(filepath.Join(h.root, "inventory.json"+checksums.Suffix), filepath.Join(h.incoming, "inventory.json"+checksums.Suffix))
+	h.dropPartially("inventory.json", 100*time.Millisecond, inventory[:20], inventory[20:60], inventory[60:])
+
+	outcome := h.wait(1)[0]
+	assert.Nil(t, outcome.err)
+	h.settle(500 * time.Millisecond)
+
+	assert.Equal(t, 1, len(h.files(h.success)))
+	assert.Empty(t, h.files(h.fail))
+	assert.Equal(t, 2, len(h.warehouse.Articles()))
+}
+
+func TestPipelinePartialWritesPolling(t *testing.T) {
+	h := newPipelineHarness(t, ModePoll, handlers.HandleArticleIncomingDataFile)
+
+	// the polling watcher takes the file only once it stays the same for an interval
+	h.dropPartially("inventory.json", 20*time.Millisecond, inventory[:20], inventory[20:40], inventory[40:60], inventory[60:])
+
+	outcome := h.wait(1)[0]
+	assert.Nil(t, outcome.err)
+	h.settle(200 * time.Millisecond)
+
+	assert.Equal(t, 1, len(h.files(h.success)))
+	assert.Equal(t, 2, len(h.warehouse.Articles()))
+}
+
+func TestPipelineWarehouseDown(t *testing.T) {
+	h := newPipelineHarness(t, ModeNotify, handlers.HandleArticleIncomingDataFile)
+
+	// a file that can't be applied because the Warehouse API fails goes to the fail folder, with its report
+	h.warehouse.Inject(warehousetest.Fault{Path: "/article", Status: 500})
+	h.drop("inventory.json", inventory)
+	outcome := h.wait(1)[0]
+	assert.NotNil(t, outcome.err)
+
+	files := h.files(h.fail)
+	assert.Equal(t, 1, len(files))
+	report, err := reports.Read(filepath.Join(h.fail, files[0]) + reports.Suffix)
+	assert.Nil(t, err)
+	assert.Equal(t, reports.StatusFail, report.Status)
+	assert.Equal(t, "inventory.json", report.File)
+}
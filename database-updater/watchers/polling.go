@@ -0,0 +1,112 @@
+package watchers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPollInterval is used when the PollingWatcher has no interval
+const DefaultPollInterval = 2 * time.Second
+
+// PollingWatcher watches the folder by listing it periodically. It's meant for the filesystems
+// where no events are received, like NFS and SMB shares and some Docker bind mounts
+type PollingWatcher struct {
+	Interval time.Duration
+}
+
+// fileState is what tells that a file changed between two polls
+type fileState struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+}
+
+// Watch lists the folder (and its subfolders) at each interval and sends the name of the files that are new or changed.
+// A file is sent only when it stays the same for a whole interval, so files still being written are
+// not taken. The files already at the folder when it starts being watched are not sent, like with fsnotify
+func (w PollingWatcher) Watch(ctx context.Context, watchPath string, fileName chan string) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	logrus.Debugf("Watching for changes at %s by polling every %s", watchPath, interval)
+
+	// if the folder doesnt exist, create it
+	if _, err := os.Stat(watchPath); os.IsNotExist(err) {
+		os.MkdirAll(watchPath, 0777)
+	}
+
+	seen := listFiles(watchPath)
+	pending := map[string]fileState{}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		current := listFiles(watchPath)
+		for name, state := range current {
+			if last, ok := seen[name]; ok && last == state {
+				continue
+			}
+			// wait for the file to stay the same for an interval before taking it
+			if last, ok := pending[name]; !ok || last != state {
+				pending[name] = state
+				continue
+			}
+			delete(pending, name)
+			seen[name] = state
+			select {
+			case fileName <- filepath.Join(watchPath, name):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// forget the files that are gone, like the ones moved to the success or fail folder
+		for name := range seen {
+			if _, ok := current[name]; !ok {
+				delete(seen, name)
+			}
+		}
+		for name := range pending {
+			if _, ok := current[name]; !ok {
+				delete(pending, name)
+			}
+		}
+	}
+}
+
+// listFiles returns the state of the regular files of the folder and its subfolders by their relative path
+func listFiles(watchPath string) map[string]fileState {
+	files := map[string]fileState{}
+	err := filepath.Walk(watchPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// a file moved away while listing is not an error
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(watchPath, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = fileState{size: info.Size(), modTime: info.ModTime(), inode: inodeOf(info)}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Error on polling folder/path. Path: %s. Error: %s", watchPath, err)
+	}
+	return files
+}
@@ -1,25 +1,93 @@
 package watchers
 
 import (
+	"context"
+	"database-autoupdater/checksums"
+	"database-autoupdater/encryption"
+	"database-autoupdater/globals"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 )
 
+// Modes of the watchers, selected by the --watcher flag
+const (
+	// ModeAuto uses polling on the filesystems where inotify events are unreliable and fsnotify elsewhere
+	ModeAuto   = "auto"
+	ModeNotify = "notify"
+	ModePoll   = "poll"
+)
+
+// Watcher watches a folder and sends the path of each file created or changed there, until the context is done
+type Watcher interface {
+	Watch(ctx context.Context, watchPath string, fileName chan string)
+}
+
+// ForFolder selects the Watcher of a folder: polling for the folders listed at
+// globals.PollFolders and, for the others, the one of the configured mode
+func ForFolder(watchPath string) Watcher {
+	polling := PollingWatcher{Interval: globals.PollInterval}
+	if isPollFolder(watchPath) {
+		return polling
+	}
+	switch globals.WatcherMode {
+	case ModePoll:
+		return polling
+	case ModeNotify:
+		return NotifyWatcher{}
+	}
+	if fsType, unreliable := unreliableFilesystem(watchPath); unreliable {
+		logrus.Infof("Folder %s is on a %s filesystem, where file events are unreliable. Watching it by polling every %s", watchPath, fsType, polling.Interval)
+		return polling
+	}
+	return NotifyWatcher{}
+}
+
+// isPollFolder tells whether the folder is one of globals.PollFolders (or is inside one), relative to the incoming data folder
+func isPollFolder(watchPath string) bool {
+	rel, err := filepath.Rel(globals.IncomingDataFolder, watchPath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, folder := range globals.PollFolders {
+		folder = strings.Trim(filepath.ToSlash(filepath.Clean(folder)), "/")
+		if rel == folder || strings.HasPrefix(rel, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // StartPipeline starts an automatic data ingestion pipeline in Warehouse Database
-// where files placed at incomingDataFolder will be processed and, if they are OK, the will
+// where files placed at incomingDataFolder (or any of its subfolders) will be processed and, if they are OK, the will
 // be POSTed to the Warehouse API and moved to the sucessfullFolder. Otherwhise they won't be
-// POSTed and they will be moved to the failProcessedFolder
+// POSTed and they will be moved to the failProcessedFolder. The subfolders of the files are kept in both
 func StartPipeline(incomingDataFolder string, successProcessedFolder string, failProcessedFolder string, handleIncomingData func(string, string, string) error) {
+	RunPipeline(context.Background(), incomingDataFolder, successProcessedFolder, failProcessedFolder, handleIncomingData)
+}
+
+// RunPipeline runs the pipeline of StartPipeline until the context is done. Then it stops watching the
+// folders and returns once the files being handled are done
+func RunPipeline(ctx context.Context, incomingDataFolder string, successProcessedFolder string, failProcessedFolder string, handleIncomingData func(string, string, string) error) {
 	pendingFile := make(chan string)
 	successFile := make(chan string)
 	failFile := make(chan string)
+	handledFile := make(chan string)
 
 	// Watch for events at the three folders of the pipeline in parallel
-	go watchForNewFiles(incomingDataFolder, pendingFile)
-	go watchForNewFiles(successProcessedFolder, successFile)
-	go watchForNewFiles(failProcessedFolder, failFile)
+	go ForFolder(incomingDataFolder).Watch(ctx, incomingDataFolder, pendingFile)
+	go ForFolder(successProcessedFolder).Watch(ctx, successProcessedFolder, successFile)
+	go ForFolder(failProcessedFolder).Watch(ctx, failProcessedFolder, failFile)
+
+	// a file fires several events while it's written (create, write...), but it's handled only once at a time
+	inFlight := map[string]bool{}
+	var handling sync.WaitGroup
+	defer handling.Wait()
 
 	for {
 
@@ -27,8 +95,31 @@ func StartPipeline(incomingDataFolder string, successProcessedFolder string, fai
 		// case a new data file has arrived
 		case arrivedFilePath := <-pendingFile:
 			logrus.Debugf("New pending file change detected: %s", arrivedFilePath)
+			// the checksum and signature files are not data, they are read by the handlers of the files they belong to
+			if checksums.IsChecksumFile(arrivedFilePath) || encryption.IsSignature(arrivedFilePath) {
+				continue
+			}
+			if inFlight[arrivedFilePath] {
+				logrus.Debugf("The file is already being handled: %s", arrivedFilePath)
+				continue
+			}
+			inFlight[arrivedFilePath] = true
+			// files of subfolders are moved to the same subfolder of the success or fail folder
+			successFolder, failFolder := processedFolders(incomingDataFolder, successProcessedFolder, failProcessedFolder, arrivedFilePath)
 			// invoke the specialized function that will handle this kind of function
-			go handleIncomingData(arrivedFilePath, successProcessedFolder, failProcessedFolder)
+			handling.Add(1)
+			go func() {
+				defer handling.Done()
+				handleIncomingData(arrivedFilePath, successFolder, failFolder)
+				select {
+				case handledFile <- arrivedFilePath:
+				case <-ctx.Done():
+				}
+			}()
+
+		// case a file was handled, so it's taken again if it's placed once more
+		case handledFilePath := <-handledFile:
+			delete(inFlight, handledFilePath)
 
 		// case a new data has been successly ingested
 		case successFilePath := <-successFile:
@@ -37,13 +128,35 @@ func StartPipeline(incomingDataFolder string, successProcessedFolder string, fai
 		// case a the received data couldn't be ingested
 		case failFilePath := <-failFile:
 			logrus.Debugf("There were an error on the data ingestion of the following file: %s", failFilePath)
+
+		case <-ctx.Done():
+			logrus.Debugf("Stopping the pipeline of %s", incomingDataFolder)
+			return
 		}
 	}
 }
 
-// watchForNewFiles fires a folder content watcher for new files created and
-// sends this file name to the chan passed as param
-func watchForNewFiles(watchPath string, fileName chan string) {
+// processedFolders resolves the success and fail folders of a file, keeping
+// the path of the file relative to the incoming folder. The folders are created if needed
+func processedFolders(incomingDataFolder, successProcessedFolder, failProcessedFolder, filePath string) (string, string) {
+	rel, err := filepath.Rel(incomingDataFolder, filepath.Dir(filePath))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return successProcessedFolder, failProcessedFolder
+	}
+	successFolder := filepath.Join(successProcessedFolder, rel)
+	failFolder := filepath.Join(failProcessedFolder, rel)
+	os.MkdirAll(successFolder, 0777)
+	os.MkdirAll(failFolder, 0777)
+	return successFolder, failFolder
+}
+
+// NotifyWatcher watches the folder with filesystem events (inotify on Linux)
+type NotifyWatcher struct{}
+
+// Watch fires a folder content watcher for new files created and
+// sends this file name to the chan passed as param. The subfolders are
+// watched too, including the ones created after the watch started
+func (NotifyWatcher) Watch(ctx context.Context, watchPath string, fileName chan string) {
 
 	logrus.Debugf("Watching for changes at %s", watchPath)
 
@@ -59,8 +172,8 @@ func watchForNewFiles(watchPath string, fileName chan string) {
 	}
 	defer watcher.Close()
 
-	// adds the path as parameter to be watched
-	if err := watcher.Add(watchPath); err != nil {
+	// adds the path and its subfolders to be watched
+	if err := addFolders(ctx, watcher, watchPath, nil); err != nil {
 		logrus.Errorf("Error adding folder to watch. Folder: %s. Error details: %s", watchPath, err)
 		return
 	}
@@ -72,14 +185,58 @@ func watchForNewFiles(watchPath string, fileName chan string) {
 		case event := <-watcher.Events:
 			// send the file name only if the detected change was a
 			// file creation
-			if event.Op == fsnotify.Create || event.Op == fsnotify.Rename || event.Op == fsnotify.Write {
-				fileName <- event.Name
+			if event.Op != fsnotify.Create && event.Op != fsnotify.Rename && event.Op != fsnotify.Write {
+				continue
+			}
+			// a file moved away, like the ones moved to the success or fail folder, fires a
+			// rename event with its old name. It's gone, so there's nothing to handle
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			// a new subfolder is watched too. The files placed in it before the watch
+			// was added don't fire events, so they are sent right away
+			if info.IsDir() {
+				if err := addFolders(ctx, watcher, event.Name, fileName); err != nil && ctx.Err() == nil {
+					logrus.Errorf("Error adding folder to watch. Folder: %s. Error details: %s", event.Name, err)
+				}
+				continue
+			}
+			select {
+			case fileName <- event.Name:
+			case <-ctx.Done():
+				return
 			}
 
 		// watch for errors
 		case err := <-watcher.Errors:
 			logrus.Errorf("Error on watching folder/path. Path: %s. Error: %s", watchPath, err)
+
+		case <-ctx.Done():
+			return
 		}
 	}
 
 }
+
+// addFolders adds the folder and all its subfolders to the watcher. If the
+// fileName chan is provided, the files found in them are sent to it
+func addFolders(ctx context.Context, watcher *fsnotify.Watcher, folder string, fileName chan string) error {
+	return filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			logrus.Debugf("Watching for changes at %s", path)
+			return watcher.Add(path)
+		}
+		if fileName != nil && info.Mode().IsRegular() {
+			select {
+			case fileName <- path:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
@@ -1,15 +1,20 @@
 package watchers
 
 import (
+	"context"
 	"database-autoupdater/globals"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var baseTestFolder, incomingDataFolder, successProcessedFolder, failProcessedFolder, domain string
 
 func setup() error {
-	globals.WarehouseArticleEndpoint = "http://localhost:4000/article"
 	domain = "dummy"
 	baseTestFolder = "dummy-test"
 	incomingDataFolder = baseTestFolder + "/incoming/" + domain
@@ -44,11 +49,91 @@ func teardown() {
 	os.RemoveAll(baseTestFolder)
 }
 
-func TestStartPipeline(t *testing.T) {
+func TestPollingWatcher(t *testing.T) {
 	err := setup()
 	if err != nil {
 		t.Fail()
 	}
+	defer teardown()
+
+	// a file already at the folder is not taken, like with fsnotify
+	ioutil.WriteFile(filepath.Join(incomingDataFolder, "old.json"), []byte("{}"), 0666)
+
+	fileName := make(chan string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go PollingWatcher{Interval: 10 * time.Millisecond}.Watch(ctx, incomingDataFolder, fileName)
+	time.Sleep(30 * time.Millisecond)
+
+	newFile := filepath.Join(incomingDataFolder, "inventory.json")
+	ioutil.WriteFile(newFile, []byte("{}"), 0666)
+
+	select {
+	case arrived := <-fileName:
+		assert.Equal(t, newFile, arrived)
+	case <-time.After(time.Second):
+		t.Error("the new file was not detected")
+	}
+}
+
+func TestForFolder(t *testing.T) {
+	globals.IncomingDataFolder = "incoming"
+	globals.PollFolders = []string{"article/acme"}
+	globals.WatcherMode = ModeNotify
+	defer func() {
+		globals.PollFolders = nil
+		globals.WatcherMode = ""
+	}()
+
+	assert.IsType(t, PollingWatcher{}, ForFolder("incoming/article/acme"))
+	assert.IsType(t, PollingWatcher{}, ForFolder("incoming/article/acme/2021"))
+	assert.IsType(t, NotifyWatcher{}, ForFolder("incoming/article"))
+
+	globals.WatcherMode = ModePoll
+	assert.IsType(t, PollingWatcher{}, ForFolder("incoming/article"))
+}
+
+func TestNotifyWatcherSubfolders(t *testing.T) {
+	err := setup()
+	if err != nil {
+		t.Fail()
+	}
+	defer teardown()
+
+	fileName := make(chan string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NotifyWatcher{}.Watch(ctx, incomingDataFolder, fileName)
+	time.Sleep(50 * time.Millisecond)
+
+	// a supplier folder created after the watch started, with a nested date folder
+	nestedFolder := filepath.Join(incomingDataFolder, "acme", "2021-10-01")
+	os.MkdirAll(nestedFolder, 0777)
+	time.Sleep(50 * time.Millisecond)
+	newFile := filepath.Join(nestedFolder, "inventory.json")
+	ioutil.WriteFile(newFile, []byte("{}"), 0666)
+
+	select {
+	case arrived := <-fileName:
+		assert.Equal(t, newFile, arrived)
+	case <-time.After(time.Second):
+		t.Error("the file of the subfolder was not detected")
+	}
+}
+
+func TestProcessedFolders(t *testing.T) {
+	err := setup()
+	if err != nil {
+		t.Fail()
+	}
+	defer teardown()
+
+	successFolder, failFolder := processedFolders(incomingDataFolder, successProcessedFolder, failProcessedFolder, incomingDataFolder+"/acme/2021-10-01/inventory.json")
+	assert.Equal(t, filepath.Join(successProcessedFolder, "acme/2021-10-01"), successFolder)
+	assert.Equal(t, filepath.Join(failProcessedFolder, "acme/2021-10-01"), failFolder)
+	_, err = os.Stat(failFolder)
+	assert.Nil(t, err)
 
-	teardown()
+	successFolder, _ = processedFolders(incomingDataFolder, successProcessedFolder, failProcessedFolder, incomingDataFolder+"/inventory.json")
+	assert.Equal(t, successProcessedFolder, successFolder)
 }
@@ -63,3 +63,29 @@ CREATE UNIQUE INDEX "Article.identification_unique" ON "Article"("identification
 
 -- AlterTable
 ALTER TABLE "Article" ALTER COLUMN "identification" SET DATA TYPE BIGINT;
+
+-- CreateTable
+CREATE TABLE "StockMovement" (
+    "id" SERIAL NOT NULL,
+    "articleId" INTEGER NOT NULL,
+    "delta" INTEGER NOT NULL,
+    "reason" TEXT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY ("id")
+);
+
+-- AddForeignKey
+ALTER TABLE "StockMovement" ADD FOREIGN KEY ("articleId") REFERENCES "Article"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+/*
+  Warnings:
+
+  - A unique constraint covering the columns `[sku]` on the table `Product` will be added. If there are existing duplicate values, this will fail.
+
+*/
+-- AlterTable
+ALTER TABLE "Product" ADD COLUMN     "sku" TEXT;
+
+-- CreateIndex
+CREATE UNIQUE INDEX "Product.sku_unique" ON "Product"("sku");